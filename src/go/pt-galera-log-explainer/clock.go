@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/pkg/errors"
+)
+
+// skews below this are expected between nodes logging the same event: network latency, buffered writes, ...
+// applying them would only add noise
+const minimumEstimatedSkew = time.Second
+
+// every members log the same vote around the same time
+var regexSimultaneousVote = regexp.MustCompile("Member .* vote on (?P<uuid>[a-z0-9-]+):(?P<seqno>[0-9]+)")
+
+// fileClocks returns how to adjust dates for each path, from --time-offsets and --estimate-skew
+// paths without any adjustment are not included
+func fileClocks(paths []string) (map[string]*types.FileClock, error) {
+	clocks, err := parseTimeOffsets(paths, CLI.TimeOffsets)
+	if err != nil {
+		return nil, err
+	}
+	if !CLI.EstimateSkew {
+		return clocks, nil
+	}
+
+	events := map[string]map[string]time.Time{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		events[path], err = simultaneousEventsFromLog(f, clocks[path])
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not estimate clock skew for %s", path)
+		}
+	}
+
+	for path, offset := range estimateClockSkews(paths, events) {
+		// an offset given by the user is more trustworthy
+		if clocks[path] != nil && clocks[path].Offset != 0 {
+			continue
+		}
+		if offset < minimumEstimatedSkew && offset > -minimumEstimatedSkew {
+			continue
+		}
+		if clocks[path] == nil {
+			clocks[path] = &types.FileClock{}
+		}
+		clocks[path].Offset = offset
+		clocks[path].Estimated = true
+	}
+	return clocks, nil
+}
+
+// parseTimeOffsets reads --time-offsets values
+// keys are either a path, or a file name. Values are separated by commas, each of them being
+// a duration to add (-2m30s), a fixed offset (+02:00) or a timezone name (Europe/Paris)
+func parseTimeOffsets(paths []string, offsets map[string]string) (map[string]*types.FileClock, error) {
+	clocks := map[string]*types.FileClock{}
+	for key, value := range offsets {
+		clock := &types.FileClock{}
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if d, err := time.ParseDuration(item); err == nil {
+				clock.Offset += d
+				continue
+			}
+			if t, err := time.Parse("-07:00", item); err == nil {
+				_, offset := t.Zone()
+				clock.Location = time.FixedZone("UTC"+item, offset)
+				continue
+			}
+			loc, err := time.LoadLocation(item)
+			if err != nil {
+				return nil, errors.Errorf("invalid time offset for %s: %s is neither a duration, an offset or a timezone", key, item)
+			}
+			clock.Location = loc
+		}
+
+		found := false
+		for _, path := range paths {
+			if path == key || filepath.Base(path) == key {
+				clocks[path] = clock
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("invalid time offset: %s does not match any given file", key)
+		}
+	}
+	return clocks, nil
+}
+
+// simultaneousEventsFromLog finds events that every involved nodes logged at the same time: view changes, and inconsistency votes
+// it returns the earliest date for each event
+func simultaneousEventsFromLog(r io.Reader, clock *types.FileClock) (map[string]time.Time, error) {
+	events := map[string]time.Time{}
+	add := func(key string, date time.Time) {
+		if date.IsZero() {
+			return
+		}
+		if previous, ok := events[key]; !ok || date.Before(previous) {
+			events[key] = date
+		}
+	}
+
+	parser := &viewParser{clock: clock}
+	err := iterateLogLines(r, func(line string) {
+		parser.parseLine(line)
+		if submatches := regexSimultaneousVote.FindStringSubmatch(line); submatches != nil {
+			add("vote/"+submatches[1]+":"+submatches[2], parser.date)
+		}
+	})
+	for _, obs := range parser.observations {
+		if obs.view != nil {
+			add("view/"+obs.view.key(), obs.date)
+		}
+	}
+	return events, err
+}
+
+// estimateClockSkews uses the first path with events as the reference clock, then finds the offset
+// of every other path sharing events with an already aligned path, so that files which do not share
+// anything with the reference can still be aligned through another one
+// the median of differences is used, so that a single badly placed event cannot skew the result
+func estimateClockSkews(paths []string, events map[string]map[string]time.Time) map[string]time.Duration {
+	offsets := map[string]time.Duration{}
+	for _, path := range paths {
+		if len(events[path]) > 0 {
+			offsets[path] = 0
+			break
+		}
+	}
+	if len(offsets) == 0 {
+		return offsets
+	}
+
+	for progress := true; progress; {
+		progress = false
+		for _, path := range paths {
+			if _, ok := offsets[path]; ok {
+				continue
+			}
+			diffs := []time.Duration{}
+			for aligned, offset := range offsets {
+				for key, date := range events[path] {
+					if alignedDate, ok := events[aligned][key]; ok {
+						diffs = append(diffs, alignedDate.Add(offset).Sub(date))
+					}
+				}
+			}
+			if len(diffs) == 0 {
+				continue
+			}
+			sort.Slice(diffs, func(i, j int) bool { return diffs[i] < diffs[j] })
+			offsets[path] = diffs[len(diffs)/2]
+			progress = true
+		}
+	}
+	return offsets
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseTimeOffsets(t *testing.T) {
+	paths := []string{"logs/node1.log", "logs/node2.log", "other/node3.log"}
+
+	clocks, err := parseTimeOffsets(paths, map[string]string{
+		"node1.log":       "Europe/Paris",
+		"logs/node2.log":  "-1m30s",
+		"other/node3.log": "+02:00, 2s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clocks["logs/node1.log"] == nil || clocks["logs/node1.log"].Location.String() != "Europe/Paris" {
+		t.Errorf("unexpected clock for node1: %v", clocks["logs/node1.log"])
+	}
+	if clocks["logs/node2.log"] == nil || clocks["logs/node2.log"].Offset != -90*time.Second {
+		t.Errorf("unexpected clock for node2: %v", clocks["logs/node2.log"])
+	}
+	if clock := clocks["other/node3.log"]; clock == nil || clock.String() != "UTC+02:00 +2s" {
+		t.Errorf("unexpected clock for node3: %v", clock)
+	}
+
+	for _, offsets := range []map[string]string{
+		{"node4.log": "1m"},
+		{"node1.log": "not a timezone"},
+	} {
+		if _, err := parseTimeOffsets(paths, offsets); err == nil {
+			t.Errorf("expected an error for %v", offsets)
+		}
+	}
+}
+
+func TestEstimateClockSkews(t *testing.T) {
+	paths := []string{"tests/logs/upgrade/node1.log", "tests/logs/upgrade/node2.log", "tests/logs/upgrade/node3.log"}
+	events := map[string]map[string]time.Time{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[path], err = simultaneousEventsFromLog(f, nil)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// simulate a node with a clock 5 minutes ahead
+	skew := 5 * time.Minute
+	for key, date := range events[paths[2]] {
+		events[paths[2]][key] = date.Add(skew)
+	}
+
+	offsets := estimateClockSkews(paths, events)
+	if len(offsets) != 3 {
+		t.Fatalf("expected every files to be aligned, got %v", offsets)
+	}
+	for _, path := range paths[:2] {
+		if offset := offsets[path]; offset > minimumEstimatedSkew || offset < -minimumEstimatedSkew {
+			t.Errorf("%s: expected no skew, got %s", path, offset)
+		}
+	}
+	if diff := offsets[paths[2]] + skew; diff > minimumEstimatedSkew || diff < -minimumEstimatedSkew {
+		t.Errorf("%s: expected -%s, got %s", paths[2], skew, offsets[paths[2]])
+	}
+}
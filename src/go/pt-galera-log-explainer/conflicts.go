@@ -3,96 +3,305 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/Ladicle/tabwriter"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
 	"golang.org/x/exp/slices"
 	"gopkg.in/yaml.v2"
 )
 
 type conflicts struct {
-	Paths []string `arg:"" name:"paths" help:"paths of the log to use"`
-	Yaml  bool     `xor:"format"`
-	Json  bool     `xor:"format"`
+	Paths     []string `arg:"" name:"paths" help:"paths of the log to use"`
+	Yaml      bool     `xor:"format"`
+	Json      bool     `xor:"format"`
+	Aggregate bool     `help:"With --json or --yaml, output a single object with every nodes' conflicts and the aggregated views, instead of one list of conflicts per node"`
 }
 
 func (c *conflicts) Help() string {
-	return "Summarize every replication conflicts, from every node's point of view"
+	return fmt.Sprintf(`Summarize every replication conflicts, from every node's point of view
+
+Conflicts are listed for each node, followed by aggregated views across nodes:
+	- conflicts over time, per hour
+	- conflicts per table or schema, when the error names one
+	- conflicts per initiating node
+	- nodes which lost votes
+
+--json and --yaml print the list of conflicts of each node, add --aggregate to get the aggregated views as well.
+
+Usage:
+	%[1]s conflicts <list of files>
+	%[1]s conflicts --json *.log
+	%[1]s conflicts --json --aggregate *.log
+	`, toolname)
+}
+
+// conflictsReport is what is printed with --aggregate, along with --yaml or --json
+type conflictsReport struct {
+	Nodes       map[string]types.Conflicts `json:"nodes" yaml:"nodes"`
+	OverTime    []conflictsCount           `json:"overTime" yaml:"overTime"`
+	ByObject    []conflictsCount           `json:"byObject" yaml:"byObject"`
+	ByInitiator []conflictsCount           `json:"byInitiator" yaml:"byInitiator"`
+	LostVotes   []conflictsCount           `json:"lostVotes" yaml:"lostVotes"`
+}
+
+type conflictsCount struct {
+	Name  string `json:"name" yaml:"name"`
+	Count int    `json:"count" yaml:"count"`
 }
 
 func (c *conflicts) Run() error {
 
-	regexes := regex.IdentsMap.Merge(regex.ApplicativeMap)
+	regexes := types.RegexMap{}.Merge(regex.IdentsMap).Merge(regex.ApplicativeMap)
 	timeline, err := timelineFromPaths(c.Paths, regexes)
 	if err != nil {
 		return err
 	}
 
-	logCtxs := timeline.GetLatestContextsByNodes()
-	for _, logCtx := range logCtxs {
-		if len(logCtx.Conflicts) == 0 {
+	report := conflictsReport{Nodes: map[string]types.Conflicts{}}
+	for node, logCtx := range timeline.GetLatestContextsByNodes() {
+		if len(logCtx.Conflicts) > 0 {
+			report.Nodes[node] = logCtx.Conflicts
+		}
+	}
+	if len(report.Nodes) == 0 {
+		return nil
+	}
+	report.aggregate()
+
+	if !c.Yaml && !c.Json {
+		printConflictsReport(os.Stdout, report)
+		return nil
+	}
+	if c.Aggregate {
+		return c.print(report)
+	}
+
+	nodes := make([]string, 0, len(report.Nodes))
+	for node := range report.Nodes {
+		nodes = append(nodes, node)
+	}
+	slices.Sort(nodes)
+	for _, node := range nodes {
+		if err := c.print(report.Nodes[node]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conflicts) print(v interface{}) error {
+	if c.Yaml {
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// aggregate fills aggregated views, the same conflict seen from several nodes is only counted once
+func (report *conflictsReport) aggregate() {
+	overTime := map[string]int{}
+	byObject := map[string]int{}
+	byInitiator := map[string]int{}
+	lostVotes := map[string]int{}
+
+	for _, c := range mergeNodesConflicts(report.Nodes) {
+		if !c.Date.IsZero() {
+			overTime[c.Date.UTC().Truncate(time.Hour).Format("2006-01-02 15:04")]++
+		}
+
+		objects := map[string]struct{}{}
+		for _, vote := range c.VotePerNode {
+			if object := conflictObject(vote.Error); object != "" {
+				objects[object] = struct{}{}
+			}
+		}
+		for object := range objects {
+			byObject[object]++
+		}
+
+		for _, node := range c.InitiatedBy {
+			byInitiator[node]++
+		}
+
+		if c.Winner == "" {
 			continue
 		}
-		var out string
+		for node, vote := range c.VotePerNode {
+			if vote.MD5 != c.Winner {
+				lostVotes[node]++
+			}
+		}
+	}
+
+	report.OverTime = sortedCounts(overTime, false)
+	report.ByObject = sortedCounts(byObject, true)
+	report.ByInitiator = sortedCounts(byInitiator, true)
+	report.LostVotes = sortedCounts(lostVotes, true)
+}
+
+// mergeNodesConflicts merges conflicts by seqno, combining votes from every nodes
+// conflicts are copied, so that nodes' contexts are not modified
+func mergeNodesConflicts(nodes map[string]types.Conflicts) types.Conflicts {
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	// do not iterate over maps
+	// map accesses are random, it will make regression tests harder
+	slices.Sort(names)
 
-		switch {
-		case c.Yaml:
-			tmp, err := yaml.Marshal(logCtx.Conflicts)
-			if err != nil {
-				return err
+	merged := types.Conflicts{}
+	for _, node := range names {
+		for _, c := range nodes[node] {
+			cpy := *c
+			cpy.VotePerNode = make(map[string]types.ConflictVote, len(c.VotePerNode))
+			for n, vote := range c.VotePerNode {
+				cpy.VotePerNode[n] = vote
 			}
-			out = string(tmp)
-		case c.Json:
-			tmp, err := json.Marshal(logCtx.Conflicts)
-			if err != nil {
-				return err
+
+			existing := merged.ConflictWithSeqno(c.Seqno)
+			merged = merged.Merge(cpy)
+			if existing == nil {
+				continue
 			}
-			out = string(tmp)
-
-		default:
-			var b strings.Builder
-			for _, conflict := range logCtx.Conflicts {
-				b.WriteString("\n\n")
-				b.WriteString(utils.Paint(utils.BlueText, "seqno: "))
-				b.WriteString(conflict.Seqno)
-				b.WriteString("\n\t")
-				b.WriteString(utils.Paint(utils.BlueText, "winner: "))
-				b.WriteString(conflict.Winner)
-				b.WriteString("\n\t")
-				b.WriteString(utils.Paint(utils.BlueText, "votes per nodes:"))
-
-				nodes := []string{}
-				for node := range conflict.VotePerNode {
-					nodes = append(nodes, node)
-				}
-				// do not iterate over VotePerNode map
-				// map accesses are random, it will make regression tests harder
-				slices.Sort(nodes)
-
-				for _, node := range nodes {
-					vote := conflict.VotePerNode[node]
-					displayVote := utils.Paint(utils.RedText, vote.MD5)
-					if vote.MD5 == conflict.Winner {
-						displayVote = utils.Paint(utils.GreenText, vote.MD5)
-					}
-					b.WriteString("\n\t\t")
-					b.WriteString(utils.Paint(utils.BlueText, node))
-					b.WriteString(": (")
-					b.WriteString(displayVote)
-					b.WriteString(") ")
-					b.WriteString(vote.Error)
+			if existing.Winner == "" {
+				existing.Winner = c.Winner
+			}
+			for _, initiator := range c.InitiatedBy {
+				if !utils.SliceContains(existing.InitiatedBy, initiator) {
+					existing.InitiatedBy = append(existing.InitiatedBy, initiator)
 				}
-				b.WriteString("\n\t")
-				b.WriteString(utils.Paint(utils.BlueText, "initiated by: "))
-				b.WriteString(fmt.Sprintf("%v", conflict.InitiatedBy))
-				out = b.String()[2:]
 			}
+		}
+	}
+	return merged
+}
 
+// sortedCounts sorts by descending counts when byCount, else by names
+func sortedCounts(m map[string]int, byCount bool) []conflictsCount {
+	counts := make([]conflictsCount, 0, len(m))
+	for name, count := range m {
+		counts = append(counts, conflictsCount{Name: name, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if byCount && counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
+
+// the usual errors naming a table or a schema
+// Table 'db.t1' doesn't exist, Unknown table 'db.t1', Can't find record in 't1'
+// Duplicate entry '1' for key 't1.PRIMARY': keys are prefixed by their table since 8.0
+// Unknown database 'db', Can't create database 'db'; database exists
+var conflictObjectRegexes = []*regexp.Regexp{
+	regexp.MustCompile("(?:[Tt]able|record in) '(?P<object>[^']+)'"),
+	regexp.MustCompile("for key '(?P<object>[^'.]+)\\.[^']+'"),
+	regexp.MustCompile("database '(?P<object>[^']+)'"),
+}
+
+// conflictObject returns the table or the schema an error is about, empty when it does not name any
+func conflictObject(errorText string) string {
+	for _, r := range conflictObjectRegexes {
+		if r.MatchString(errorText) {
+			return submatch(r, "object", errorText)
 		}
-		fmt.Println(out)
-		return nil
 	}
+	return ""
+}
 
-	return nil
+func printConflictsReport(out io.Writer, report conflictsReport) {
+	nodes := make([]string, 0, len(report.Nodes))
+	for node := range report.Nodes {
+		nodes = append(nodes, node)
+	}
+	slices.Sort(nodes)
+
+	for i, node := range nodes {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintln(out, utils.Paint(utils.BlueText, "node: ")+node)
+		fmt.Fprintln(out, conflictsDetails(report.Nodes[node]))
+	}
+
+	w := tabwriter.NewWriter(out, 8, 8, 3, ' ', 0)
+	defer w.Flush()
+	for _, section := range []struct {
+		title  string
+		counts []conflictsCount
+	}{
+		{"conflicts over time (UTC, per hour)", report.OverTime},
+		{"conflicts per table or schema", report.ByObject},
+		{"conflicts per initiating node", report.ByInitiator},
+		{"lost votes per node", report.LostVotes},
+	} {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, utils.Paint(utils.BlueText, section.title+":"))
+		if len(section.counts) == 0 {
+			fmt.Fprintln(w, "\tnone")
+		}
+		for _, count := range section.counts {
+			fmt.Fprintf(w, "\t%s\t%d\n", count.Name, count.Count)
+		}
+	}
+}
+
+func conflictsDetails(conflicts types.Conflicts) string {
+	var b strings.Builder
+	for _, conflict := range conflicts {
+		b.WriteString("\n\n")
+		b.WriteString(utils.Paint(utils.BlueText, "seqno: "))
+		b.WriteString(conflict.Seqno)
+		b.WriteString("\n\t")
+		b.WriteString(utils.Paint(utils.BlueText, "winner: "))
+		b.WriteString(conflict.Winner)
+		b.WriteString("\n\t")
+		b.WriteString(utils.Paint(utils.BlueText, "votes per nodes:"))
+
+		nodes := []string{}
+		for node := range conflict.VotePerNode {
+			nodes = append(nodes, node)
+		}
+		// do not iterate over VotePerNode map
+		// map accesses are random, it will make regression tests harder
+		slices.Sort(nodes)
+
+		for _, node := range nodes {
+			vote := conflict.VotePerNode[node]
+			displayVote := utils.Paint(utils.RedText, vote.MD5)
+			if vote.MD5 == conflict.Winner {
+				displayVote = utils.Paint(utils.GreenText, vote.MD5)
+			}
+			b.WriteString("\n\t\t")
+			b.WriteString(utils.Paint(utils.BlueText, node))
+			b.WriteString(": (")
+			b.WriteString(displayVote)
+			b.WriteString(") ")
+			b.WriteString(vote.Error)
+		}
+		b.WriteString("\n\t")
+		b.WriteString(utils.Paint(utils.BlueText, "initiated by: "))
+		b.WriteString(fmt.Sprintf("%v", conflict.InitiatedBy))
+	}
+	return b.String()[2:]
 }
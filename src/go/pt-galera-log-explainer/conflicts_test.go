@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+)
+
+func TestConflictObject(t *testing.T) {
+	tests := map[string]string{
+		"Table 'db1.t1' doesn't exist": "db1.t1",
+		"Unknown table 'db1.t2'":       "db1.t2",
+		"Could not execute Delete_rows event on table db1.t1; Can't find record in 't1'": "t1",
+		"Duplicate entry '1' for key 't3.PRIMARY'":                                       "t3",
+		"Duplicate entry '1' for key 'PRIMARY'":                                          "",
+		"Can't create database 'db2'; database exists":                                   "db2",
+		"File '/var/log/mysqld-slow.log' not found (OS errno 13 - Permission denied)":    "",
+		"Success": "",
+	}
+	for errorText, expected := range tests {
+		if object := conflictObject(errorText); object != expected {
+			t.Errorf("%q: expected %q, got %q", errorText, expected, object)
+		}
+	}
+}
+
+func TestConflictsReportAggregate(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse(time.RFC3339, s)
+		return d
+	}
+	failed := types.ConflictVote{MD5: "cd3bd7de926232d8", Error: "Table 'db1.t1' doesn't exist"}
+	success := types.ConflictVote{MD5: "0000000000000000", Error: "Success"}
+
+	// the same conflict seen by node1 and node2, each only knowing part of the votes
+	report := conflictsReport{Nodes: map[string]types.Conflicts{
+		"node1": {
+			{Seqno: "10", Date: date("2023-10-21T04:01:00Z"), InitiatedBy: []string{"node1"}, Winner: "0000000000000000",
+				VotePerNode: map[string]types.ConflictVote{"node1": failed, "node2": success}},
+			{Seqno: "20", Date: date("2023-10-21T05:30:00Z"), InitiatedBy: []string{"node3"},
+				VotePerNode: map[string]types.ConflictVote{"node3": failed}},
+		},
+		"node2": {
+			{Seqno: "10", Date: date("2023-10-21T04:01:01Z"), InitiatedBy: []string{"node1"},
+				VotePerNode: map[string]types.ConflictVote{"node2": success, "node3": success}},
+			{Seqno: "30", Date: date("2023-10-21T05:45:00Z"), InitiatedBy: []string{"node2"}, Winner: "0000000000000000",
+				VotePerNode: map[string]types.ConflictVote{"node2": {MD5: "aaaaaaaaaaaaaaaa", Error: "Can't create database 'db2'; database exists"}, "node3": success}},
+		},
+	}}
+	report.aggregate()
+
+	expected := conflictsReport{
+		OverTime:    []conflictsCount{{"2023-10-21 04:00", 1}, {"2023-10-21 05:00", 2}},
+		ByObject:    []conflictsCount{{"db1.t1", 2}, {"db2", 1}},
+		ByInitiator: []conflictsCount{{"node1", 1}, {"node2", 1}, {"node3", 1}},
+		LostVotes:   []conflictsCount{{"node1", 1}, {"node2", 1}},
+	}
+	report.Nodes = nil
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %v, got %v", expected, report)
+	}
+}
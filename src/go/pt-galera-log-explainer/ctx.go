@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
-	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
 )
 
 type ctx struct {
@@ -27,7 +26,7 @@ func (c *ctx) Run() error {
 		DB       any
 		Contexts []any
 	}{}
-	out.DB = translate.GetDB()
+	out.DB = timeline.DB()
 
 	for _, t := range timeline {
 		out.Contexts = append(out.Contexts, t[len(t)-1].LogCtx)
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os/exec"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/rs/zerolog/log"
+)
+
+// detectFlavor will assume every files are from MariaDB if one is found
+func detectFlavor(paths []string) types.Flavor {
+
+	for _, path := range paths {
+
+		cmd := exec.Command(CLI.GrepCmd, "-q", "-a", "-m", "1", "-E", types.MariaDBDetectionRegex, path)
+		err := cmd.Run()
+		if err == nil {
+			return types.FlavorMariaDB
+		}
+		log.Debug().Err(err).Str("path", path).Msg("flavor detection result")
+	}
+	return types.FlavorPXC
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/display"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
+	"github.com/pkg/errors"
+)
+
+type diagnose struct {
+	Paths        []string `arg:"" name:"paths" help:"paths of the log to use"`
+	Json         bool     `help:"Output findings as json"`
+	MaxEvidences int      `help:"Maximum number of supporting log lines to print per finding" default:"5"`
+}
+
+func (d *diagnose) Help() string {
+	return fmt.Sprintf(`Detect known failure patterns and summarize them, most severe first
+
+It currently detects:
+	- loss of the primary component (split-brain, network partitions)
+	- SST failures, and restart loops following them
+	- IST not applicable, falling back to SST (gcache too small)
+	- inconsistency votes
+	- unsafe bootstraps
+	- bind address already used
+
+Findings are only as good as the logs provided: partitions can only be told apart
+from a complete loss of quorum when every nodes' logs are given.
+
+Usage:
+	%[1]s diagnose <list of files>
+	%[1]s diagnose --json *.log
+	`, toolname)
+}
+
+type severity int
+
+const (
+	severityWarning severity = iota + 1
+	severityHigh
+	severityCritical
+)
+
+func (s severity) String() string {
+	switch s {
+	case severityCritical:
+		return "critical"
+	case severityHigh:
+		return "high"
+	default:
+		return "warning"
+	}
+}
+
+func (s severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s severity) paint() string {
+	switch s {
+	case severityCritical:
+		return utils.Paint(utils.BrightRedText, s.String())
+	case severityHigh:
+		return utils.Paint(utils.RedText, s.String())
+	default:
+		return utils.Paint(utils.YellowText, s.String())
+	}
+}
+
+// finding is a failure pattern found in the timeline, with the log lines supporting it
+type finding struct {
+	Severity    severity        `json:"severity"`
+	Title       string          `json:"title"`
+	Explanation string          `json:"explanation"`
+	Nodes       []string        `json:"nodes"`
+	FirstSeen   *time.Time      `json:"firstSeen,omitempty"`
+	LastSeen    *time.Time      `json:"lastSeen,omitempty"`
+	Evidences   []display.Event `json:"evidences"`
+}
+
+// add stores the event as an evidence, it returns false if it was already known
+func (f *finding) add(event display.Event) bool {
+	// a single log line can be matched by several regexes
+	for _, evidence := range f.Evidences {
+		if evidence.FilePath == event.FilePath && evidence.LineNumber == event.LineNumber && evidence.Log == event.Log {
+			return false
+		}
+	}
+	f.Evidences = append(f.Evidences, event)
+	f.Nodes = utils.SliceMergeDeduplicate(f.Nodes, []string{event.Node})
+	if event.Timestamp == nil {
+		return true
+	}
+	if f.FirstSeen == nil || event.Timestamp.Before(*f.FirstSeen) {
+		f.FirstSeen = event.Timestamp
+	}
+	if f.LastSeen == nil || event.Timestamp.After(*f.LastSeen) {
+		f.LastSeen = event.Timestamp
+	}
+	return true
+}
+
+func (d *diagnose) Run() error {
+
+	// messages are only used as a short description for evidences
+	utils.SkipColor = utils.SkipColor || d.Json
+
+	timeline, err := timelineFromPaths(d.Paths, regex.AllRegexes())
+	if err != nil {
+		return errors.Wrap(err, "could not diagnose")
+	}
+
+	// every events are useful here, even the ones usually hidden
+	findings := diagnoseEvents(display.TimelineEvents(timeline, types.Debug))
+
+	if d.Json {
+		out, err := json.MarshalIndent(findings, "", "\t")
+		if err != nil {
+			return errors.Wrap(err, "could not marshal findings")
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if len(findings) == 0 {
+		fmt.Println("No known failure pattern found")
+		return nil
+	}
+
+	fmt.Print(findingsToText(findings, d.MaxEvidences))
+	return nil
+}
+
+// diagnoseEvents runs every detectors on the chronological list of events
+// and returns findings ranked by severity, then by first occurrence
+func diagnoseEvents(events []display.Event) []finding {
+	findings := []finding{}
+
+	for _, detector := range []func([]display.Event) []finding{
+		detectNonPrimary,
+		detectSSTFailures,
+		detectISTFallback,
+		detectInconsistencies,
+		detectUnsafeBootstrap,
+		detectBindAddressConflicts,
+	} {
+		findings = append(findings, detector(events)...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return findings[i].Severity > findings[j].Severity
+		}
+		if findings[i].FirstSeen == nil || findings[j].FirstSeen == nil {
+			return findings[j].FirstSeen == nil && findings[i].FirstSeen != nil
+		}
+		return findings[i].FirstSeen.Before(*findings[j].FirstSeen)
+	})
+	return findings
+}
+
+func isPrimaryState(state string) bool {
+	return utils.SliceContains([]string{"SYNCED", "DONOR", "DESYNCED", "JOINER", "JOINED", "PRIMARY"}, state)
+}
+
+// detectNonPrimary looks for nodes switching to a non-primary component.
+// If any other node was still in a primary component at that time, it is a partition
+// else the whole cluster lost quorum, which is what split-brains end up with in Galera
+func detectNonPrimary(events []display.Event) []finding {
+	partition := finding{
+		Severity:    severityHigh,
+		Title:       "node(s) partitioned from the primary component",
+		Explanation: "Some nodes switched to non-primary while others kept a primary component. Check the network between nodes, and evs.suspect_timeout/evs.inactive_timeout values.",
+	}
+	splitbrain := finding{
+		Severity:    severityCritical,
+		Title:       "no primary component left (split-brain / loss of quorum)",
+		Explanation: "Every known node was non-primary at the same time: the cluster stopped accepting writes. A manual bootstrap with pc.bootstrap=1 from the most advanced node is usually required.",
+	}
+
+	currentStates := map[string]string{}
+	// nodes shutting down, until they start again
+	leaving := map[string]bool{}
+	for i, event := range events {
+		currentStates[event.Node] = event.StateAfter
+
+		switch {
+		case event.RegexKey == "RegexStarting":
+			leaving[event.Node] = false
+		case utils.SliceContains(shutdownRegexes, event.RegexKey), strings.Contains(event.Log, ", LEAVING,"):
+			leaving[event.Node] = true
+		}
+
+		if event.RegexKey == "RegexWsrepNonPrimary" {
+			splitbrain.add(event)
+			continue
+		}
+		if event.RegexKey != "RegexNewComponent" || event.StateAfter != "NON-PRIMARY" {
+			continue
+		}
+
+		// nodes starting or shutting down will always go through a non-primary view, this is expected
+		// only nodes that actually lost their primary component are relevant
+		if !isPrimaryState(event.StateBefore) || leaving[event.Node] || selfLeaveFollows(events, i) {
+			continue
+		}
+
+		stillPrimary := false
+		for node, state := range currentStates {
+			if node != event.Node && isPrimaryState(state) {
+				stillPrimary = true
+				break
+			}
+		}
+		if stillPrimary {
+			partition.add(event)
+		} else {
+			splitbrain.add(event)
+		}
+	}
+
+	findings := []finding{}
+	// "failed to reach primary view" is not enough by itself, a node can log it while joining
+	if len(splitbrain.Evidences) > 0 && hasRegexKey(splitbrain.Evidences, "RegexNewComponent") {
+		findings = append(findings, splitbrain)
+	}
+	if len(partition.Evidences) > 0 {
+		findings = append(findings, partition)
+	}
+	return findings
+}
+
+var shutdownRegexes = []string{
+	"RegexShutdownSignal",
+	"RegexShutdownComplete",
+}
+
+// selfLeaveFollows returns whether the node of events[i] left the group by itself right after,
+// before installing any other view. Galera logs the non-primary view first, then the self-leave
+func selfLeaveFollows(events []display.Event, i int) bool {
+	for _, event := range events[i+1:] {
+		if event.Node != events[i].Node {
+			continue
+		}
+		switch event.RegexKey {
+		case "RegexSelfLeave":
+			return true
+		case "RegexNewComponent", "RegexStarting":
+			return false
+		}
+	}
+	return false
+}
+
+// sstFailureRegexes are failures of state transfers, seen either by the joiner, the donor, or any other member
+var sstFailureRegexes = []string{
+	"RegexSSTStateTransferFailed",
+	"RegexSSTFailedUnknown",
+	"RegexSSTError",
+	"RegexWillNeverReceive",
+	"RegexTimeoutReceivingFirstData",
+	"RegexISTFailed",
+}
+
+// isJoinerFailure returns whether the event is a state transfer failure of the node itself, as a joiner.
+// Donors and other members log failures too, they must not be counted against them
+func isJoinerFailure(event display.Event) bool {
+	if !utils.SliceContains(sstFailureRegexes, event.RegexKey) {
+		return false
+	}
+	if strings.Contains(event.Log, "--role 'donor'") {
+		return false
+	}
+	return event.StateBefore == "JOINER"
+}
+
+// detectSSTFailures reports failed joins per node
+// a node restarting after its own failed join, and failing again, is in a restart loop
+func detectSSTFailures(events []display.Event) []finding {
+
+	type nodeSSTs struct {
+		finding
+		failures       int
+		failedJoin     bool // the last join failed, and the node did not sync since
+		restarted      bool // restarted since the last failed join
+		failedRestarts int  // restarts followed by yet another failure
+	}
+	perNode := map[string]*nodeSSTs{}
+	nodes := []string{}
+
+	for _, event := range events {
+		n, ok := perNode[event.Node]
+
+		switch {
+		case isJoinerFailure(event):
+			if !ok {
+				n = &nodeSSTs{}
+				perNode[event.Node] = n
+				nodes = append(nodes, event.Node)
+			}
+			if !n.add(event) {
+				continue
+			}
+			// a single failed join is usually logged several times, by the SST script and by Galera
+			if n.failedJoin && !n.restarted {
+				continue
+			}
+			n.failures++
+			if n.restarted {
+				n.failedRestarts++
+				n.restarted = false
+			}
+			n.failedJoin = true
+
+		case ok && n.failedJoin && event.RegexKey == "RegexStarting":
+			n.add(event)
+			n.restarted = true
+
+		case ok && event.StateAfter == "SYNCED":
+			n.failedJoin = false
+			n.restarted = false
+		}
+	}
+
+	findings := []finding{}
+	for _, node := range nodes {
+		n := perNode[node]
+		n.Title = fmt.Sprintf("%d failed state transfer(s) on joiner %s", n.failures, node)
+		n.Severity = severityHigh
+		n.Explanation = "State transfers failed. Check the SST logs (innobackup.*.log, socat/ssl errors) on both the donor and the joiner."
+		if n.failedRestarts > 0 {
+			n.Title = fmt.Sprintf("SST restart loop on %s: failed again after %d restart(s)", node, n.failedRestarts)
+			n.Severity = severityCritical
+			n.Explanation = "The node keeps restarting and failing its state transfer. It will not recover by itself: the root cause of the first failure has to be fixed."
+		}
+		findings = append(findings, n.finding)
+	}
+	return findings
+}
+
+// detectISTFallback reports joiners that could not use IST and had to go through a full SST instead
+func detectISTFallback(events []display.Event) []finding {
+	f := finding{
+		Severity:    severityWarning,
+		Title:       "IST was not applicable, fell back to SST",
+		Explanation: "The donor gcache did not contain every missing writesets anymore. Consider increasing gcache.size so that restarted nodes can rejoin using IST.",
+	}
+
+	waitingForSST := map[string]bool{}
+	for _, event := range events {
+		switch event.RegexKey {
+		case "RegexFailedToPrepareIST":
+			waitingForSST[event.Node] = true
+			f.add(event)
+		case "RegexGcacheScan":
+			f.add(event)
+		case "RegexSSTProceeding":
+			if waitingForSST[event.Node] {
+				f.add(event)
+				waitingForSST[event.Node] = false
+			}
+		}
+	}
+
+	if !hasRegexKey(f.Evidences, "RegexFailedToPrepareIST") {
+		return nil
+	}
+	return []finding{f}
+}
+
+var inconsistencyRegexes = []string{
+	"RegexInconsistencyVoteInit",
+	"RegexInconsistencyVoteInconsistentWithGroup",
+	"RegexInconsistencyVoted",
+	"RegexReversingHistory",
+}
+
+func detectInconsistencies(events []display.Event) []finding {
+	f := finding{
+		Severity:    severityCritical,
+		Title:       "data inconsistency detected",
+		Explanation: "Nodes voted on a replication error, nodes on the losing side left the cluster. Use the 'conflicts' subcommand for the details of each vote.",
+	}
+	for _, event := range events {
+		if utils.SliceContains(inconsistencyRegexes, event.RegexKey) {
+			f.add(event)
+		}
+	}
+	if len(f.Evidences) == 0 {
+		return nil
+	}
+	return []finding{f}
+}
+
+func detectUnsafeBootstrap(events []display.Event) []finding {
+	return singleRegexFinding(events, "RegexWsrepUnsafeBootstrap", finding{
+		Severity:    severityHigh,
+		Title:       "bootstrap refused: not safe to bootstrap",
+		Explanation: "The node may not have the latest data (safe_to_bootstrap: 0 in grastate.dat). Bootstrap from the most advanced node, check wsrep recovery positions before forcing it.",
+	})
+}
+
+func detectBindAddressConflicts(events []display.Event) []finding {
+	return singleRegexFinding(events, "RegexBindAddressAlreadyUsed", finding{
+		Severity:    severityWarning,
+		Title:       "bind address already used",
+		Explanation: "Another process, often a previous mysqld instance that did not stop, is still listening on the Galera port.",
+	})
+}
+
+func singleRegexFinding(events []display.Event, regexKey string, f finding) []finding {
+	for _, event := range events {
+		if event.RegexKey == regexKey {
+			f.add(event)
+		}
+	}
+	if len(f.Evidences) == 0 {
+		return nil
+	}
+	return []finding{f}
+}
+
+func hasRegexKey(events []display.Event, regexKey string) bool {
+	for _, event := range events {
+		if event.RegexKey == regexKey {
+			return true
+		}
+	}
+	return false
+}
+
+func findingsToText(findings []finding, maxEvidences int) string {
+	var b strings.Builder
+	for i, f := range findings {
+		b.WriteString(fmt.Sprintf("%d. [%s] %s\n", i+1, f.Severity.paint(), utils.Paint(utils.BrightText, f.Title)))
+		b.WriteString("\t" + utils.Paint(utils.BlueText, "nodes: ") + strings.Join(f.Nodes, ", ") + "\n")
+		if f.FirstSeen != nil {
+			b.WriteString("\t" + utils.Paint(utils.BlueText, "first seen: ") + f.FirstSeen.Format(time.RFC3339Nano) + "\n")
+			b.WriteString("\t" + utils.Paint(utils.BlueText, "last seen: ") + f.LastSeen.Format(time.RFC3339Nano) + "\n")
+		}
+		b.WriteString("\t" + f.Explanation + "\n")
+		b.WriteString("\t" + utils.Paint(utils.BlueText, "supporting logs:") + "\n")
+		for j, event := range f.Evidences {
+			if maxEvidences > 0 && j >= maxEvidences {
+				b.WriteString(fmt.Sprintf("\t\t... and %d more\n", len(f.Evidences)-maxEvidences))
+				break
+			}
+			b.WriteString(fmt.Sprintf("\t\t%s:%d: %s\n", event.FilePath, event.LineNumber, event.Log))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
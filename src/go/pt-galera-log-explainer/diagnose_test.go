@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/display"
+)
+
+func TestDiagnoseEvents(t *testing.T) {
+	date := func(sec int) *time.Time {
+		d := time.Date(2023, 3, 12, 7, 0, sec, 0, time.UTC)
+		return &d
+	}
+
+	tests := []struct {
+		name           string
+		events         []display.Event
+		expectedTitles []string
+	}{
+		{
+			name: "node starting is not a partition",
+			events: []display.Event{
+				{Node: "node1", Timestamp: date(1), RegexKey: "RegexNewComponent", StateBefore: "OPEN", StateAfter: "NON-PRIMARY", LineNumber: 1},
+			},
+			expectedTitles: []string{},
+		},
+		{
+			name: "partition then loss of quorum",
+			events: []display.Event{
+				{Node: "node1", Timestamp: date(1), RegexKey: "RegexShift", StateBefore: "", StateAfter: "SYNCED", LineNumber: 1},
+				{Node: "node2", Timestamp: date(2), RegexKey: "RegexShift", StateBefore: "", StateAfter: "SYNCED", LineNumber: 1},
+				{Node: "node1", Timestamp: date(3), RegexKey: "RegexNewComponent", StateBefore: "SYNCED", StateAfter: "NON-PRIMARY", LineNumber: 2},
+				{Node: "node2", Timestamp: date(4), RegexKey: "RegexNewComponent", StateBefore: "SYNCED", StateAfter: "NON-PRIMARY", LineNumber: 2},
+			},
+			expectedTitles: []string{"no primary component left (split-brain / loss of quorum)", "node(s) partitioned from the primary component"},
+		},
+		{
+			name: "sst restart loop",
+			events: []display.Event{
+				{Node: "node1", Timestamp: date(1), RegexKey: "RegexSSTError", StateBefore: "JOINER", StateAfter: "JOINER", LineNumber: 1},
+				{Node: "node1", Timestamp: date(2), RegexKey: "RegexStarting", LineNumber: 2},
+				{Node: "node1", Timestamp: date(3), RegexKey: "RegexSSTError", StateBefore: "JOINER", StateAfter: "JOINER", LineNumber: 3},
+				{Node: "node1", Timestamp: date(4), RegexKey: "RegexBindAddressAlreadyUsed", LineNumber: 4},
+			},
+			expectedTitles: []string{"SST restart loop on node1: failed again after 1 restart(s)", "bind address already used"},
+		},
+		{
+			name: "donor failures are not a restart loop",
+			events: []display.Event{
+				{Node: "node1", Timestamp: date(1), RegexKey: "RegexSSTError", StateBefore: "DONOR", StateAfter: "DONOR", LineNumber: 1,
+					Log: "Process completed with error: wsrep_sst_xtrabackup-v2 --role 'donor' --address '172.17.0.3:4444/xtrabackup_sst//1'"},
+				{Node: "node1", Timestamp: date(2), RegexKey: "RegexSSTFailedUnknown", StateBefore: "SYNCED", StateAfter: "SYNCED", LineNumber: 2},
+				{Node: "node1", Timestamp: date(3), RegexKey: "RegexStarting", LineNumber: 3},
+				{Node: "node1", Timestamp: date(4), RegexKey: "RegexSSTError", StateBefore: "JOINER", StateAfter: "JOINER", LineNumber: 4},
+			},
+			expectedTitles: []string{"1 failed state transfer(s) on joiner node1"},
+		},
+		{
+			name: "clean shutdown is not a split-brain",
+			events: []display.Event{
+				{Node: "node1", Timestamp: date(1), RegexKey: "RegexShift", StateBefore: "", StateAfter: "SYNCED", LineNumber: 1},
+				{Node: "node1", Timestamp: date(2), RegexKey: "RegexShutdownSignal", StateBefore: "SYNCED", StateAfter: "CLOSED", LineNumber: 2},
+				{Node: "node1", Timestamp: date(3), RegexKey: "RegexShift", StateBefore: "CLOSED", StateAfter: "SYNCED", LineNumber: 3},
+				{Node: "node1", Timestamp: date(4), RegexKey: "RegexNewComponent", StateBefore: "SYNCED", StateAfter: "NON-PRIMARY", LineNumber: 4},
+			},
+			expectedTitles: []string{},
+		},
+		{
+			name: "self-leave is not a partition",
+			events: []display.Event{
+				{Node: "node1", Timestamp: date(1), RegexKey: "RegexShift", StateBefore: "", StateAfter: "SYNCED", LineNumber: 1},
+				{Node: "node2", Timestamp: date(2), RegexKey: "RegexShift", StateBefore: "", StateAfter: "JOINER", LineNumber: 1},
+				{Node: "node2", Timestamp: date(3), RegexKey: "RegexNewComponent", StateBefore: "JOINER", StateAfter: "NON-PRIMARY", LineNumber: 2},
+				{Node: "node2", Timestamp: date(3), RegexKey: "RegexSelfLeave", StateBefore: "NON-PRIMARY", StateAfter: "NON-PRIMARY", LineNumber: 3},
+			},
+			expectedTitles: []string{},
+		},
+		{
+			name: "ist fallback",
+			events: []display.Event{
+				{Node: "node1", Timestamp: date(1), RegexKey: "RegexFailedToPrepareIST", LineNumber: 1},
+				{Node: "node1", Timestamp: date(2), RegexKey: "RegexSSTProceeding", LineNumber: 2},
+			},
+			expectedTitles: []string{"IST was not applicable, fell back to SST"},
+		},
+	}
+
+	for _, test := range tests {
+		findings := diagnoseEvents(test.events)
+		if len(findings) != len(test.expectedTitles) {
+			t.Fatalf("%s: expected %d findings, got %d: %v", test.name, len(test.expectedTitles), len(findings), findings)
+		}
+		for i, title := range test.expectedTitles {
+			if findings[i].Title != title {
+				t.Errorf("%s: expected finding %d to be %q, got %q", test.name, i, title, findings[i].Title)
+			}
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -19,59 +20,149 @@ func TimelineCLI(timeline types.Timeline, verbosity types.Verbosity) {
 
 	timeline = removeEmptyColumns(timeline, verbosity)
 
+	w := tabwriter.NewWriter(os.Stdout, 8, 8, 3, ' ', tabwriter.DiscardEmptyColumns)
+	defer w.Flush()
+
+	t := newTimelineCLI(w, timeline, verbosity)
+	t.header()
+	t.rows(timeline)
+
+	// footer
+	// only having a header is not fast enough to read when there are too many lines
+	if t.linecount >= 50 {
+		t.footer()
+	}
+
+	// TODO: where to print conflicts details ?
+}
+
+// TimelineCLIFollow prints a timeline like TimelineCLI, then prints every update as soon as it is received
+// Columns are given a fixed width, as rows printed separately would not be aligned otherwise
+// Events from nodes absent of the initial timeline are ignored, as they would not have any column
+// The footer is printed once updates is closed
+func TimelineCLIFollow(timeline types.Timeline, verbosity types.Verbosity, updates <-chan types.Timeline) {
+
+	t := newTimelineCLI(nil, timeline, verbosity)
+	// DiscardEmptyColumns is not used: a single row without date would lose its date column
+	t.w = tabwriter.NewWriter(os.Stdout, t.followColumnWidth(timeline), 8, 3, ' ', 0)
+
+	t.header()
+	t.rows(timeline)
+	t.w.Flush()
+
+	for update := range updates {
+		newNodes := []string{}
+		for node := range update {
+			if !utils.SliceContains(t.keys, node) {
+				newNodes = append(newNodes, node)
+				t.currentContext[node] = update[node][0].LogCtx
+			}
+			t.latestContext[node] = update[node][len(update[node])-1].LogCtx
+		}
+		// files which had no events at first get their own columns from now on
+		if len(newNodes) > 0 {
+			sort.Strings(newNodes)
+			t.keys = append(t.keys, newNodes...)
+			t.header()
+		}
+		t.rows(update)
+		t.w.Flush()
+	}
+
+	t.footer()
+	t.w.Flush()
+}
+
+// timelineCLI keeps what is needed to print rows, so that rows can be printed as they come
+type timelineCLI struct {
+	w         *tabwriter.Writer
+	verbosity types.Verbosity
+
 	// to hold the current context for each node
 	// "keys" is needed, because iterating over a map must give a different order each time
 	// a slice keeps its order
-	keys, currentContext := initKeysContext(timeline)           // currentcontext to follow when important thing changed
-	latestContext := timeline.GetLatestContextsByNodes()        // so that we have fully updated context when we print
-	lastContext := make(map[string]types.LogCtx, len(timeline)) // just to follow when important thing changed
+	keys           []string
+	currentContext map[string]types.LogCtx // currentcontext to follow when important thing changed
+	latestContext  map[string]types.LogCtx // so that we have fully updated context when we print
+	lastContext    map[string]types.LogCtx // just to follow when important thing changed
 
-	w := tabwriter.NewWriter(os.Stdout, 8, 8, 3, ' ', tabwriter.DiscardEmptyColumns)
-	defer w.Flush()
+	linecount int
+}
+
+func newTimelineCLI(w *tabwriter.Writer, timeline types.Timeline, verbosity types.Verbosity) *timelineCLI {
+	keys, currentContext := initKeysContext(timeline)
+	return &timelineCLI{
+		w:              w,
+		verbosity:      verbosity,
+		keys:           keys,
+		currentContext: currentContext,
+		latestContext:  timeline.GetLatestContextsByNodes(),
+		lastContext:    make(map[string]types.LogCtx, len(timeline)),
+	}
+}
+
+func (t *timelineCLI) header() {
+	fmt.Fprintln(t.w, headerNodes(t.keys))
+	fmt.Fprintln(t.w, headerFilePath(t.keys, t.currentContext))
+	fmt.Fprintln(t.w, headerIP(t.keys, t.latestContext))
+	fmt.Fprintln(t.w, headerName(t.keys, t.latestContext))
+	fmt.Fprintln(t.w, headerVersion(t.keys, t.latestContext))
+	if hasClocks(t.currentContext) {
+		fmt.Fprintln(t.w, headerClock(t.keys, t.currentContext))
+	}
+	fmt.Fprintln(t.w, separator(t.keys))
+}
+
+func (t *timelineCLI) footer() {
+	fmt.Fprintln(t.w, separator(t.keys))
+	fmt.Fprintln(t.w, headerNodes(t.keys))
+	fmt.Fprintln(t.w, headerFilePath(t.keys, t.currentContext))
+	fmt.Fprintln(t.w, headerIP(t.keys, t.currentContext))
+	fmt.Fprintln(t.w, headerName(t.keys, t.currentContext))
+	fmt.Fprintln(t.w, headerVersion(t.keys, t.currentContext))
+	if hasClocks(t.currentContext) {
+		fmt.Fprintln(t.w, headerClock(t.keys, t.currentContext))
+	}
+}
 
-	// header
-	fmt.Fprintln(w, headerNodes(keys))
-	fmt.Fprintln(w, headerFilePath(keys, currentContext))
-	fmt.Fprintln(w, headerIP(keys, latestContext))
-	fmt.Fprintln(w, headerName(keys, latestContext))
-	fmt.Fprintln(w, headerVersion(keys, latestContext))
-	fmt.Fprintln(w, separator(keys))
+// rows dequeues the timeline chronologically, printing a row for each event to display
+func (t *timelineCLI) rows(timeline types.Timeline) {
 
-	var (
-		args      []string // stuff to print
-		linecount int
-	)
+	var args []string // stuff to print
 
 	// as long as there is a next event to print
 	for nextNodes := timeline.IterateNode(); len(nextNodes) != 0; nextNodes = timeline.IterateNode() {
 
 		// Date column
-		date := timeline[nextNodes[0]][0].Date
+		// some nodes could have logs without dates
 		args = []string{""}
-		if date != nil {
-			args = []string{date.DisplayTime}
+		for _, node := range nextNodes {
+			if date := timeline[node][0].Date; date != nil {
+				args = []string{date.DisplayTime}
+				break
+			}
 		}
 
 		displayedValue := 0
 
 		// node values
-		for _, node := range keys {
+		for _, node := range t.keys {
 
 			if !utils.SliceContains(nextNodes, node) {
 				// if there are no events, having a | is needed for tabwriter
 				// A few color can also help highlighting how the node is doing
-				logCtx := currentContext[node]
+				logCtx := t.currentContext[node]
 				args = append(args, utils.PaintForState("| ", logCtx.State()))
 				continue
 			}
 			loginfo := timeline[node][0]
-			lastContext[node] = currentContext[node]
-			currentContext[node] = loginfo.LogCtx
+			t.lastContext[node] = t.currentContext[node]
+			t.currentContext[node] = loginfo.LogCtx
 
 			timeline.Dequeue(node)
 
-			msg := loginfo.Msg(latestContext[node])
-			if verbosity >= loginfo.Verbosity && msg != "" {
+			msg := loginfo.Msg(t.latestContext[node])
+			if t.verbosity >= loginfo.Verbosity && msg != "" {
 				args = append(args, msg)
 				displayedValue++
 			} else {
@@ -79,15 +170,15 @@ func TimelineCLI(timeline types.Timeline, verbosity types.Verbosity) {
 			}
 		}
 
-		if sep := transitionSeparator(keys, lastContext, currentContext); sep != "" {
+		if sep := transitionSeparator(t.keys, t.lastContext, t.currentContext); sep != "" {
 			// reset current context, so that we avoid duplicating transitions
 			// lastContext/currentContext is only useful for that anyway
-			lastContext = map[string]types.LogCtx{}
-			for k, v := range currentContext {
-				lastContext[k] = v
+			t.lastContext = map[string]types.LogCtx{}
+			for k, v := range t.currentContext {
+				t.lastContext[k] = v
 			}
 			// print transition
-			fmt.Fprintln(w, sep)
+			fmt.Fprintln(t.w, sep)
 		}
 
 		// If line is not filled with default placeholder values
@@ -97,25 +188,52 @@ func TimelineCLI(timeline types.Timeline, verbosity types.Verbosity) {
 		}
 
 		// Print tabwriter line
-		_, err := fmt.Fprintln(w, strings.Join(args, "\t")+"\t")
+		_, err := fmt.Fprintln(t.w, strings.Join(args, "\t")+"\t")
 		if err != nil {
 			log.Println("Failed to write a line", err)
 		}
-		linecount++
+		t.linecount++
 	}
+}
 
-	// footer
-	// only having a header is not fast enough to read when there are too many lines
-	if linecount >= 50 {
-		fmt.Fprintln(w, separator(keys))
-		fmt.Fprintln(w, headerNodes(keys))
-		fmt.Fprintln(w, headerFilePath(keys, currentContext))
-		fmt.Fprintln(w, headerIP(keys, currentContext))
-		fmt.Fprintln(w, headerName(keys, currentContext))
-		fmt.Fprintln(w, headerVersion(keys, currentContext))
-	}
+// minFollowColumnWidth leaves room for usual messages when the initial timeline only has short ones
+const minFollowColumnWidth = 30
 
-	// TODO: where to print conflicts details ?
+var colorRegex = regexp.MustCompile("\x1b\\[[0-9]*m")
+
+// followColumnWidth is the width of the widest cell in headers and in the initial timeline
+// new events will be aligned as long as they are not wider
+func (t *timelineCLI) followColumnWidth(timeline types.Timeline) int {
+	width := minFollowColumnWidth
+	for _, node := range t.keys {
+		cells := []string{node, t.latestContext[node].Version}
+		if path := t.currentContext[node].FilePath; len(path) < 50 {
+			cells = append(cells, path)
+		} else {
+			cells = append(cells, "..."+path[len(path)-50:])
+		}
+		if ips := t.latestContext[node].OwnIPs; len(ips) > 0 {
+			cells = append(cells, ips[len(ips)-1])
+		}
+		if names := t.latestContext[node].OwnNames; len(names) > 0 {
+			cells = append(cells, names[len(names)-1])
+		}
+		for _, li := range timeline[node] {
+			if li.Date != nil {
+				cells = append(cells, li.Date.DisplayTime)
+			}
+			if t.verbosity >= li.Verbosity {
+				cells = append(cells, colorRegex.ReplaceAllString(li.Msg(t.latestContext[node]), ""))
+			}
+		}
+		for _, cell := range cells {
+			if len(cell) > width {
+				width = len(cell)
+			}
+		}
+	}
+	// padding is included in tabwriter minwidth
+	return width + 3
 }
 
 func initKeysContext(timeline types.Timeline) ([]string, map[string]types.LogCtx) {
@@ -183,6 +301,28 @@ func headerVersion(keys []string, logCtxs map[string]types.LogCtx) string {
 	return header
 }
 
+// hasClocks is used to only display clock adjustments when there are some
+func hasClocks(logCtxs map[string]types.LogCtx) bool {
+	for _, logCtx := range logCtxs {
+		if logCtx.Clock != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func headerClock(keys []string, logCtxs map[string]types.LogCtx) string {
+	header := "clock adjustment\t"
+	for _, node := range keys {
+		if logCtx, ok := logCtxs[node]; ok && logCtx.Clock != nil {
+			header += logCtx.Clock.String() + "\t"
+		} else {
+			header += " \t"
+		}
+	}
+	return header
+}
+
 func headerName(keys []string, logCtxs map[string]types.LogCtx) string {
 	header := "last known name\t"
 	for _, node := range keys {
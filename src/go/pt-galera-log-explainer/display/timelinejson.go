@@ -0,0 +1,92 @@
+package display
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
+)
+
+// Event is the machine-readable version of a single timeline row for a node
+// It is meant to be exported to external tools, so field names should be kept stable
+type Event struct {
+	Node        string          `json:"node"`
+	Timestamp   *time.Time      `json:"timestamp,omitempty"`
+	RegexKey    string          `json:"regex"`
+	RegexType   types.RegexType `json:"regexType"`
+	Message     string          `json:"message"`
+	StateBefore string          `json:"stateBefore"`
+	StateAfter  string          `json:"stateAfter"`
+	FilePath    string          `json:"filePath"`
+	FileType    string          `json:"fileType,omitempty"`
+	LineNumber  int             `json:"lineNumber,omitempty"`
+	Log         string          `json:"log"`
+}
+
+// TimelineEvents dequeues the timeline chronologically, the same way TimelineCLI does,
+// and returns one Event per log info that is visible with the given verbosity
+func TimelineEvents(timeline types.Timeline, verbosity types.Verbosity) []Event {
+
+	latestContext := timeline.GetLatestContextsByNodes()
+	lastState := make(map[string]string, len(timeline))
+	events := []Event{}
+
+	timeline.Chronological(func(node string, loginfo types.LogInfo) {
+
+		stateBefore := lastState[node]
+		lastState[node] = loginfo.LogCtx.State()
+
+		if verbosity < loginfo.Verbosity {
+			return
+		}
+
+		event := Event{
+			Node:        node,
+			RegexKey:    loginfo.RegexUsed,
+			RegexType:   loginfo.RegexType,
+			Message:     loginfo.Msg(latestContext[node]),
+			StateBefore: stateBefore,
+			StateAfter:  loginfo.LogCtx.State(),
+			FilePath:    loginfo.LogCtx.FilePath,
+			FileType:    loginfo.LogCtx.FileType,
+			LineNumber:  loginfo.LineNumber,
+			Log:         loginfo.Log,
+		}
+		if loginfo.Date != nil {
+			t := loginfo.Date.Time
+			event.Timestamp = &t
+		}
+		events = append(events, event)
+	})
+	return events
+}
+
+// TimelineJSON prints the timeline events either as a single indented JSON array,
+// or as newline-delimited JSON (one event per line) when ndjson is set
+// Colors are always removed, as they have no meaning outside of a terminal
+func TimelineJSON(timeline types.Timeline, verbosity types.Verbosity, ndjson bool) error {
+
+	skipColor := utils.SkipColor
+	utils.SkipColor = true
+	defer func() { utils.SkipColor = skipColor }()
+
+	events := TimelineEvents(timeline, verbosity)
+
+	enc := json.NewEncoder(os.Stdout)
+	// logs are full of "->", keep them readable
+	enc.SetEscapeHTML(false)
+
+	if ndjson {
+		for _, event := range events {
+			if err := enc.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	enc.SetIndent("", "\t")
+	return enc.Encode(events)
+}
@@ -0,0 +1,59 @@
+package display
+
+import (
+	"testing"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+)
+
+func TestTimelineEvents(t *testing.T) {
+
+	regex := &types.LogRegex{Type: types.StatesRegexType}
+	date1 := types.NewDate(time.Date(2023, 3, 12, 7, 24, 13, 0, time.UTC), "2006-01-02T15:04:05.000000Z")
+	date2 := types.NewDate(time.Date(2023, 3, 12, 7, 24, 14, 0, time.UTC), "2006-01-02T15:04:05.000000Z")
+
+	ctx1 := types.NewLogCtx()
+	ctx1.FilePath = "node1.log"
+	ctx1.SetState("OPEN")
+	ctx2 := ctx1
+	ctx2.SetState("PRIMARY")
+
+	ctx3 := types.NewLogCtx()
+	ctx3.FilePath = "node2.log"
+	ctx3.SetState("SYNCED")
+
+	li1 := types.NewLogInfo(date1, types.SimpleDisplayer("CLOSED -> OPEN"), "log1", regex, "RegexShift", ctx1, "")
+	li1.LineNumber = 3
+	li2 := types.NewLogInfo(date2, types.SimpleDisplayer("OPEN -> PRIMARY"), "log2", regex, "RegexShift", ctx2, "")
+	li3 := types.NewLogInfo(date1, types.SimpleDisplayer("JOINED -> SYNCED"), "log3", regex, "RegexShift", ctx3, "")
+
+	timeline := types.Timeline{
+		"node1": types.LocalTimeline{li1, li2},
+		"node2": types.LocalTimeline{li3},
+	}
+
+	events := TimelineEvents(timeline, types.Info)
+
+	expected := []struct {
+		node, msg, before, after string
+		line                     int
+	}{
+		{node: "node1", msg: "CLOSED -> OPEN", before: "", after: "OPEN", line: 3},
+		{node: "node2", msg: "JOINED -> SYNCED", before: "", after: "SYNCED"},
+		{node: "node1", msg: "OPEN -> PRIMARY", before: "OPEN", after: "PRIMARY"},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %v", len(expected), len(events), events)
+	}
+	for i, e := range expected {
+		event := events[i]
+		if event.Node != e.node || event.Message != e.msg || event.StateBefore != e.before || event.StateAfter != e.after || event.LineNumber != e.line {
+			t.Errorf("event %d: expected %+v, got %+v", i, e, event)
+		}
+		if event.RegexKey != "RegexShift" || event.RegexType != types.StatesRegexType {
+			t.Errorf("event %d: unexpected regex %s (%s)", i, event.RegexKey, event.RegexType)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ladicle/tabwriter"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
+	"github.com/pkg/errors"
+)
+
+type gcache struct {
+	Paths []string `arg:"" name:"paths" help:"paths of the log to use"`
+	Json  bool     `help:"Output seqnos, gcache ranges, decision points and desync periods as json"`
+}
+
+func (g *gcache) Help() string {
+	return fmt.Sprintf(`Report write-set replication health, to help size gcache.size and explain why a joiner could not use IST
+
+For each node, it shows:
+	- the committed seqnos known over time and the resulting write-set rate
+	- the gcache seqno range found at startup, and the time it would cover at the observed rate
+	- IST and SST decision points, with the gcache ranges known from other nodes
+	- desync and resync periods
+
+Usage:
+	%[1]s gcache <list of files>
+	%[1]s gcache --json *.log
+	`, toolname)
+}
+
+const (
+	gcacheEventSeqno        = "seqno"
+	gcacheEventRange        = "gcache range"
+	gcacheEventSize         = "gcache.size"
+	gcacheEventISTRequest   = "IST requested"
+	gcacheEventSSTRequired  = "SST required"
+	gcacheEventISTServed    = "IST served"
+	gcacheEventISTReceived  = "IST received"
+	gcacheEventSSTProceeded = "SST proceeding"
+	gcacheEventDesync       = "desync"
+	gcacheEventResync       = "resync"
+	gcacheEventStarting     = "starting"
+)
+
+// gcacheEvent is a single fact extracted from a log
+// Subject is the node the event is about when it is not the node logging it: the desynced member, the IST joiner
+type gcacheEvent struct {
+	Date    time.Time `json:"date"`
+	Node    string    `json:"node"`
+	Type    string    `json:"type"`
+	Subject string    `json:"subject,omitempty"`
+	First   int64     `json:"first"`
+	Last    int64     `json:"last"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// seqnoSample is a seqno known by a node at a date
+// Discontinuous is set when the seqno could have jumped since the previous sample: restarts, state transfers
+type seqnoSample struct {
+	Date          time.Time `json:"date"`
+	Seqno         int64     `json:"seqno"`
+	Discontinuous bool      `json:"discontinuous,omitempty"`
+}
+
+type seqnoRange struct {
+	Date   time.Time `json:"date"`
+	First  int64     `json:"first"`
+	Last   int64     `json:"last"`
+	Source string    `json:"source"`
+}
+
+func (sr seqnoRange) String() string {
+	return strconv.FormatInt(sr.First, 10) + "-" + strconv.FormatInt(sr.Last, 10)
+}
+
+type gcacheNode struct {
+	Name         string        `json:"name"`
+	GcacheSize   string        `json:"gcacheSize,omitempty"`
+	Seqnos       []seqnoSample `json:"seqnos"`
+	GcacheRanges []seqnoRange  `json:"gcacheRanges"`
+
+	// the next seqno sample will come after a restart or a state transfer
+	discontinued bool
+}
+
+// addSeqno with discontinuous set is for seqnos not following the previous and next ones
+func (gn *gcacheNode) addSeqno(date time.Time, seqno int64, discontinuous bool) {
+	gn.Seqnos = append(gn.Seqnos, seqnoSample{Date: date, Seqno: seqno, Discontinuous: discontinuous || gn.discontinued})
+	gn.discontinued = discontinuous
+}
+
+// WriteSetsPerHour returns 0 when not enough seqnos are known
+// It is only computed between consecutive samples, as seqnos can jump after restarts or state transfers
+func (gn *gcacheNode) WriteSetsPerHour() float64 {
+	var (
+		writesets int64
+		d         time.Duration
+	)
+	for i := 1; i < len(gn.Seqnos); i++ {
+		previous, sample := gn.Seqnos[i-1], gn.Seqnos[i]
+		if sample.Discontinuous || sample.Seqno < previous.Seqno || !sample.Date.After(previous.Date) {
+			continue
+		}
+		writesets += sample.Seqno - previous.Seqno
+		d += sample.Date.Sub(previous.Date)
+	}
+	if d <= 0 || writesets == 0 {
+		return 0
+	}
+	return float64(writesets) / d.Hours()
+}
+
+// LatestRecoveredRange returns the latest gcache range found at startup, nil if never logged
+// ranges known from IST are not used, they only tell what was sent
+func (gn *gcacheNode) LatestRecoveredRange() *seqnoRange {
+	for i := len(gn.GcacheRanges) - 1; i >= 0; i-- {
+		if gn.GcacheRanges[i].Source == "recovery" {
+			return &gn.GcacheRanges[i]
+		}
+	}
+	return nil
+}
+
+// Retention estimates how long the gcache could cover at the observed write-set rate
+func (gn *gcacheNode) Retention() time.Duration {
+	rate := gn.WriteSetsPerHour()
+	sr := gn.LatestRecoveredRange()
+	if rate == 0 || sr == nil || sr.Last <= sr.First {
+		return 0
+	}
+	return time.Duration(float64(sr.Last-sr.First+1) / rate * float64(time.Hour))
+}
+
+// recoveredRangeBefore returns the latest gcache range found at startup before date
+func (gn *gcacheNode) recoveredRangeBefore(date time.Time) *seqnoRange {
+	for i := len(gn.GcacheRanges) - 1; i >= 0; i-- {
+		if gn.GcacheRanges[i].Source == "recovery" && !gn.GcacheRanges[i].Date.After(date) {
+			return &gn.GcacheRanges[i]
+		}
+	}
+	return nil
+}
+
+type stateTransferDecision struct {
+	Date         time.Time `json:"date"`
+	Node         string    `json:"node"`
+	Decision     string    `json:"decision"`
+	Peer         string    `json:"peer,omitempty"`
+	First        int64     `json:"first"`
+	Last         int64     `json:"last"`
+	Reason       string    `json:"reason,omitempty"`
+	KnownGcaches []string  `json:"knownGcaches,omitempty"`
+}
+
+type desyncPeriod struct {
+	Node       string     `json:"node"`
+	Start      *time.Time `json:"start,omitempty"`
+	End        *time.Time `json:"end,omitempty"`
+	ReportedBy []string   `json:"reportedBy"`
+}
+
+// Duration returns 0 when either the start or the end is unknown
+func (dp *desyncPeriod) Duration() time.Duration {
+	if dp.Start == nil || dp.End == nil {
+		return 0
+	}
+	return dp.End.Sub(*dp.Start)
+}
+
+type gcacheReport struct {
+	Nodes         []*gcacheNode            `json:"nodes"`
+	Decisions     []*stateTransferDecision `json:"decisions"`
+	DesyncPeriods []*desyncPeriod          `json:"desyncPeriods"`
+}
+
+func (g *gcache) Run() error {
+
+	timeline, err := timelineFromPaths(g.Paths, regex.AllRegexes())
+	if err != nil {
+		return errors.Wrap(err, "could not build the gcache report")
+	}
+
+	db := timeline.DB()
+	events := gcacheEventsFromTimeline(timeline)
+
+	// the donor only logs the joiner address
+	for i, e := range events {
+		if e.Type == gcacheEventISTServed && regex.IsNodeIP(e.Subject) {
+			events[i].Subject = db.SimplestInfoFromIP(e.Subject, e.Date)
+		}
+	}
+
+	report := gcacheReportFromEvents(events)
+
+	if g.Json {
+		out, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			return errors.Wrap(err, "could not marshal gcache report")
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	printGcacheReport(os.Stdout, report)
+	return nil
+}
+
+// gcacheEventsFromTimeline extracts every seqno related facts from the timeline, which will be empty afterward
+// undated lines, such as "Local state" ones, use the latest date known for their node
+func gcacheEventsFromTimeline(timeline types.Timeline) []gcacheEvent {
+	events := []gcacheEvent{}
+	dates := map[string]time.Time{}
+
+	timeline.Chronological(func(node string, li types.LogInfo) {
+		if li.Date != nil {
+			dates[node] = li.Date.Time
+		}
+		e, ok := gcacheEventFromLogInfo(li)
+		if !ok {
+			return
+		}
+		e.Date = dates[node]
+		e.Node = node
+		events = append(events, e)
+	})
+	return events
+}
+
+// gcacheEventFromLogInfo returns false when the event is not related to seqnos
+func gcacheEventFromLogInfo(li types.LogInfo) (gcacheEvent, bool) {
+	switch li.RegexUsed {
+	case "RegexShift":
+		seqno := parseSeqno(submatch(regex.StatesMap[li.RegexUsed].InternalRegex, "seqno", li.Log))
+		// "(TO: 0)" is logged before the node knows about any seqno
+		if seqno > 0 {
+			return gcacheEvent{Type: gcacheEventSeqno, First: seqno, Last: seqno, Detail: "state change"}, true
+		}
+
+	case "RegexWsrepRecovery":
+		if seqno := parseSeqno(submatch(regex.EventsMap[li.RegexUsed].InternalRegex, "seqno", li.Log)); seqno >= 0 {
+			return gcacheEvent{Type: gcacheEventSeqno, First: seqno, Last: seqno, Detail: "recovered position"}, true
+		}
+
+	case "RegexLocalState":
+		if seqno := parseSeqno(submatch(regex.SSTMap[li.RegexUsed].InternalRegex, "seqno", li.Log)); seqno >= 0 {
+			return gcacheEvent{Type: gcacheEventSeqno, First: seqno, Last: seqno, Detail: "local state"}, true
+		}
+
+	case "RegexGcacheRecovered":
+		r := regex.SSTMap[li.RegexUsed].InternalRegex
+		first := parseSeqno(submatch(r, "startingseqno", li.Log))
+		last := parseSeqno(submatch(r, "seqno", li.Log))
+		return gcacheEvent{Type: gcacheEventRange, First: first, Last: last, Detail: "recovery"}, true
+
+	case "RegexGcacheSize":
+		return gcacheEvent{Type: gcacheEventSize, Detail: submatch(regex.SSTMap[li.RegexUsed].InternalRegex, "size", li.Log)}, true
+
+	case "RegexISTSender":
+		r := regex.SSTMap[li.RegexUsed].InternalRegex
+		first := parseSeqno(submatch(r, "startingseqno", li.Log))
+		last := parseSeqno(submatch(r, "seqno", li.Log))
+		if first < 0 || last < 0 {
+			return gcacheEvent{}, false
+		}
+		return gcacheEvent{Type: gcacheEventISTServed, Subject: submatch(r, "nodeip", li.Log), First: first, Last: last}, true
+
+	case "RegexISTReceiver":
+		r := regex.SSTMap[li.RegexUsed].InternalRegex
+		first := parseSeqno(submatch(r, "startingseqno", li.Log))
+		last := parseSeqno(submatch(r, "seqno", li.Log))
+		// "for 0-x" means the joiner has no state to start from
+		if first == 0 {
+			return gcacheEvent{Type: gcacheEventSSTRequired, First: first, Last: last, Detail: "no local state to start from"}, true
+		}
+		if first > 0 {
+			return gcacheEvent{Type: gcacheEventISTRequest, First: first, Last: last}, true
+		}
+
+	case "RegexFailedToPrepareIST":
+		return gcacheEvent{Type: gcacheEventSSTRequired, First: -1, Last: -1, Detail: submatch(regex.SSTMap[li.RegexUsed].InternalRegex, "reason", li.Log)}, true
+
+	case "RegexISTReceived":
+		seqno := parseSeqno(submatch(regex.SSTMap[li.RegexUsed].InternalRegex, "seqno", li.Log))
+		return gcacheEvent{Type: gcacheEventISTReceived, First: seqno, Last: seqno}, true
+
+	case "RegexSSTProceeding":
+		return gcacheEvent{Type: gcacheEventSSTProceeded}, true
+
+	case "RegexStarting":
+		return gcacheEvent{Type: gcacheEventStarting}, true
+
+	case "RegexDesync":
+		return gcacheEvent{Type: gcacheEventDesync, Subject: submatch(regex.ApplicativeMap[li.RegexUsed].InternalRegex, "nodename", li.Log)}, true
+
+	case "RegexResync":
+		return gcacheEvent{Type: gcacheEventResync, Subject: submatch(regex.ApplicativeMap[li.RegexUsed].InternalRegex, "nodename", li.Log)}, true
+	}
+	return gcacheEvent{}, false
+}
+
+func parseSeqno(s string) int64 {
+	seqno, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return seqno
+}
+
+// gcacheReportFromEvents replays events from every nodes chronologically
+func gcacheReportFromEvents(events []gcacheEvent) gcacheReport {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Date.Before(events[j].Date) })
+
+	report := gcacheReport{}
+	nodes := map[string]*gcacheNode{}
+	getNode := func(name string) *gcacheNode {
+		gn, ok := nodes[name]
+		if !ok {
+			gn = &gcacheNode{Name: name}
+			nodes[name] = gn
+			report.Nodes = append(report.Nodes, gn)
+		}
+		return gn
+	}
+
+	for _, e := range events {
+		gn := getNode(e.Node)
+
+		switch e.Type {
+		case gcacheEventSeqno:
+			// a recovered position or a local state is the seqno of the node before joining
+			// while state changes are logged with the seqno of the group
+			gn.addSeqno(e.Date, e.First, e.Detail == "recovered position" || e.Detail == "local state")
+
+		case gcacheEventRange:
+			gn.GcacheRanges = append(gn.GcacheRanges, seqnoRange{Date: e.Date, First: e.First, Last: e.Last, Source: e.Detail})
+
+		case gcacheEventSize:
+			gn.GcacheSize = e.Detail
+
+		case gcacheEventISTServed:
+			// the donor had at least this range in its gcache
+			gn.GcacheRanges = append(gn.GcacheRanges, seqnoRange{Date: e.Date, First: e.First, Last: e.Last, Source: "IST to " + e.Subject})
+			report.Decisions = append(report.Decisions, &stateTransferDecision{Date: e.Date, Node: e.Node, Decision: e.Type, Peer: e.Subject, First: e.First, Last: e.Last})
+
+		case gcacheEventISTRequest, gcacheEventSSTRequired:
+			gn.discontinued = true
+			decision := &stateTransferDecision{Date: e.Date, Node: e.Node, Decision: e.Type, First: e.First, Last: e.Last, Reason: e.Detail}
+			decision.KnownGcaches = knownGcachesAt(report.Nodes, e.Node, e.Date)
+			if e.Type == gcacheEventISTRequest && decision.Reason == "" {
+				decision.Reason = istUnavailableReason(report.Nodes, e.Node, e.First, e.Date)
+			}
+			report.Decisions = append(report.Decisions, decision)
+
+		case gcacheEventISTReceived:
+			// the joiner is now at the seqno of the group
+			gn.discontinued = true
+			gn.addSeqno(e.Date, e.First, false)
+			report.Decisions = append(report.Decisions, &stateTransferDecision{Date: e.Date, Node: e.Node, Decision: e.Type, First: e.First, Last: e.Last})
+
+		case gcacheEventSSTProceeded:
+			gn.discontinued = true
+			report.Decisions = append(report.Decisions, &stateTransferDecision{Date: e.Date, Node: e.Node, Decision: e.Type, First: -1, Last: -1})
+
+		case gcacheEventStarting:
+			gn.discontinued = true
+
+		case gcacheEventDesync:
+			report.DesyncPeriods = desyncPeriodsAdd(report.DesyncPeriods, e, true)
+
+		case gcacheEventResync:
+			report.DesyncPeriods = desyncPeriodsAdd(report.DesyncPeriods, e, false)
+		}
+	}
+
+	sort.SliceStable(report.Nodes, func(i, j int) bool { return report.Nodes[i].Name < report.Nodes[j].Name })
+	return report
+}
+
+// knownGcachesAt lists the latest gcache range found at startup for every other nodes
+func knownGcachesAt(nodes []*gcacheNode, joiner string, date time.Time) []string {
+	known := []string{}
+	for _, gn := range nodes {
+		if gn.Name == joiner {
+			continue
+		}
+		if sr := gn.recoveredRangeBefore(date); sr != nil {
+			known = append(known, gn.Name+":"+sr.String())
+		}
+	}
+	sort.Strings(known)
+	return known
+}
+
+// istUnavailableReason explains why an IST could not happen, when it can be deduced
+// gcache first seqnos only grow, so a range found earlier than the request is enough to know the needed seqno was already purged
+func istUnavailableReason(nodes []*gcacheNode, joiner string, needed int64, date time.Time) string {
+	if needed <= 0 {
+		return ""
+	}
+	lowest := int64(-1)
+	lowestNode := ""
+	for _, gn := range nodes {
+		if gn.Name == joiner {
+			continue
+		}
+		sr := gn.recoveredRangeBefore(date)
+		if sr == nil {
+			// nothing known about this node, it could have been able to serve
+			return ""
+		}
+		if lowest == -1 || sr.First < lowest {
+			lowest = sr.First
+			lowestNode = gn.Name
+		}
+	}
+	if lowest == -1 || lowest <= needed {
+		return ""
+	}
+	return fmt.Sprintf("seqno %d already purged from every known gcache, lowest is %d on %s", needed, lowest, lowestNode)
+}
+
+// desyncPeriodsAdd tracks desyncs of the subject node, every members logging them
+// The same event from other nodes' logs will only extend the list of reporters
+func desyncPeriodsAdd(periods []*desyncPeriod, e gcacheEvent, desync bool) []*desyncPeriod {
+	date := e.Date
+
+	var latest *desyncPeriod
+	for i := len(periods) - 1; i >= 0; i-- {
+		if periods[i].Node == e.Subject {
+			latest = periods[i]
+			break
+		}
+	}
+
+	report := func(dp *desyncPeriod) []*desyncPeriod {
+		if !utils.SliceContains(dp.ReportedBy, e.Node) {
+			dp.ReportedBy = append(dp.ReportedBy, e.Node)
+		}
+		return periods
+	}
+
+	if desync {
+		if latest != nil && (latest.End == nil || withinMatchingWindow(latest.Start, &date)) {
+			return report(latest)
+		}
+		dp := &desyncPeriod{Node: e.Subject, Start: &date}
+		periods = append(periods, dp)
+		return report(dp)
+	}
+
+	if latest != nil && (latest.End == nil || withinMatchingWindow(latest.End, &date)) {
+		if latest.End == nil {
+			latest.End = &date
+		}
+		return report(latest)
+	}
+	// the beginning of the desync was not logged
+	dp := &desyncPeriod{Node: e.Subject, End: &date}
+	periods = append(periods, dp)
+	return report(dp)
+}
+
+func printGcacheReport(out io.Writer, report gcacheReport) {
+	if len(report.Nodes) == 0 {
+		fmt.Fprintln(out, "No seqno found")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 8, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "node\tgcache.size\tfirst seqno\tlast seqno\twrite-sets/h\tgcache at startup\tgcache retention\t")
+	for _, gn := range report.Nodes {
+		firstSeqno, lastSeqno := "?", "?"
+		if len(gn.Seqnos) > 0 {
+			first, last := gn.Seqnos[0], gn.Seqnos[len(gn.Seqnos)-1]
+			firstSeqno = fmt.Sprintf("%d (%s)", first.Seqno, first.Date.Format(time.RFC3339))
+			lastSeqno = fmt.Sprintf("%d (%s)", last.Seqno, last.Date.Format(time.RFC3339))
+		}
+		rate := "?"
+		if r := gn.WriteSetsPerHour(); r > 0 {
+			rate = strconv.FormatFloat(r, 'f', 1, 64)
+		}
+		startup := "?"
+		if sr := gn.LatestRecoveredRange(); sr != nil {
+			startup = sr.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", gn.Name, valueOrUnknown(gn.GcacheSize), firstSeqno, lastSeqno, rate, startup, displayDuration(gn.Retention()))
+	}
+	w.Flush()
+
+	fmt.Fprintln(out)
+	if len(report.Decisions) == 0 {
+		fmt.Fprintln(out, "No IST/SST decision found")
+	} else {
+		w = tabwriter.NewWriter(out, 8, 8, 3, ' ', 0)
+		fmt.Fprintln(w, "date\tnode\tdecision\tseqnos\tpeer\treason\tknown gcaches\t")
+		for _, d := range report.Decisions {
+			seqnos := ""
+			if d.First >= 0 && d.Last >= 0 {
+				seqnos = strconv.FormatInt(d.First, 10) + "-" + strconv.FormatInt(d.Last, 10)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", d.Date.Format(time.RFC3339Nano), d.Node, paintDecision(d.Decision), seqnos, d.Peer, d.Reason, strings.Join(d.KnownGcaches, ", "))
+		}
+		w.Flush()
+	}
+
+	fmt.Fprintln(out)
+	if len(report.DesyncPeriods) == 0 {
+		fmt.Fprintln(out, "No desync found")
+		return
+	}
+	w = tabwriter.NewWriter(out, 8, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "node\tdesync\tresync\tduration\treported by\t")
+	for _, dp := range report.DesyncPeriods {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", dp.Node, displayTime(dp.Start), displayTime(dp.End), displayDuration(dp.Duration()), strings.Join(dp.ReportedBy, ", "))
+	}
+	w.Flush()
+}
+
+func paintDecision(decision string) string {
+	switch decision {
+	case gcacheEventISTServed, gcacheEventISTReceived:
+		return utils.Paint(utils.GreenText, decision)
+	case gcacheEventSSTRequired, gcacheEventSSTProceeded:
+		return utils.Paint(utils.YellowText, decision)
+	default:
+		return decision
+	}
+}
+
+func valueOrUnknown(s string) string {
+	if s == "" {
+		return "?"
+	}
+	return s
+}
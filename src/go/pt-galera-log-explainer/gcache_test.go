@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/parser"
+)
+
+func TestGcacheEventsFromTimeline(t *testing.T) {
+	log := `2023-03-12T11:24:33.321223Z 0 [Note] [MY-000000] [Galera] Recovering GCache ring buffer: found gapless sequence 170403896-170403896
+2023-03-12T11:24:33.322783Z 0 [Note] [MY-000000] [Galera] Passing config to GCS: base_dir = /var/lib/mysql; gcache.page_size = 128M; gcache.recover = yes; gcache.size = 50G; gcomm.thread_prio = ;
+2023-03-12T11:24:33.334384Z 0 [Note] [MY-000000] [Galera] Shifting CLOSED -> OPEN (TO: 0)
+2023-03-12T11:24:33.334761Z 0 [Note] [MY-000000] [Galera] Shifting JOINED -> SYNCED (TO: 170403897)
+2023-03-12T11:35:16.321642Z 0 [Note] [MY-000000] [Galera] Member 0.0 (node2) desyncs itself from group
+2023-03-12T11:35:16.342707Z 0 [Note] [MY-000000] [Galera] async IST sender starting to serve ssl://172.17.0.4:4568 sending 170403897-170403898, preload starts from 170403898
+2023-03-12T11:35:18.140768Z 0 [Note] [MY-000000] [Galera] Member 0.0 (node2) resyncs itself to group
+2023-03-12T12:48:43.822001Z 0 [Note] [MY-000000] [Galera] State transfer required:
+	Group state: 9db0bcdf-b31a-11ed-a398-2a4cfdd82049:170403905
+	Local state: 9db0bcdf-b31a-11ed-a398-2a4cfdd82049:170403896
+2023-03-12T12:48:44.597299Z 2 [Note] [MY-000000] [Galera] Prepared IST receiver for 170403897-170403905, listening at: ssl://172.17.0.4:4568
+2023-03-12T12:48:54.233973Z 3 [Note] [MY-000000] [Galera] Recovered position from storage: 9db0bcdf-b31a-11ed-a398-2a4cfdd82049:170403896
+2023-03-12T12:48:54.269978Z 2 [Note] [MY-000000] [Galera] IST received: 9db0bcdf-b31a-11ed-a398-2a4cfdd82049:170403905
+2023-03-12T13:00:00.000000Z 2 [Warning] [MY-000000] [Galera] Failed to prepare for incremental state transfer: Local state seqno is undefined: 1 (Operation not permitted)
+`
+
+	path := filepath.Join(t.TempDir(), "node2.log")
+	if err := os.WriteFile(path, []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	timeline, err := parser.Options{SkipMerge: true}.Parse([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := gcacheEventsFromTimeline(timeline)
+
+	type short struct {
+		typ, subject string
+		first, last  int64
+		detail       string
+	}
+	expected := []short{
+		{gcacheEventRange, "", 170403896, 170403896, "recovery"},
+		{gcacheEventSize, "", 0, 0, "50G"},
+		{gcacheEventSeqno, "", 170403897, 170403897, "state change"},
+		{gcacheEventDesync, "node2", 0, 0, ""},
+		{gcacheEventISTServed, "172.17.0.4", 170403897, 170403898, ""},
+		{gcacheEventResync, "node2", 0, 0, ""},
+		{gcacheEventSeqno, "", 170403896, 170403896, "local state"},
+		{gcacheEventISTRequest, "", 170403897, 170403905, ""},
+		{gcacheEventSeqno, "", 170403896, 170403896, "recovered position"},
+		{gcacheEventISTReceived, "", 170403905, 170403905, ""},
+		{gcacheEventSSTRequired, "", -1, -1, "Local state seqno is undefined: 1 (Operation not permitted)"},
+	}
+	got := []short{}
+	for _, e := range events {
+		if e.Node != path || e.Date.IsZero() {
+			t.Errorf("event %v should be dated and from %s", e, path)
+		}
+		got = append(got, short{e.Type, e.Subject, e.First, e.Last, e.Detail})
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestGcacheReportFromEvents(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse(time.RFC3339, s)
+		return d
+	}
+	events := []gcacheEvent{
+		{Date: date("2023-03-12T10:00:00Z"), Node: "node1", Type: gcacheEventRange, First: 130, Last: 200, Detail: "recovery"},
+		{Date: date("2023-03-12T10:00:00Z"), Node: "node1", Type: gcacheEventSeqno, First: 200, Last: 200},
+		{Date: date("2023-03-12T12:00:00Z"), Node: "node1", Type: gcacheEventSeqno, First: 400, Last: 400},
+		{Date: date("2023-03-12T11:00:00Z"), Node: "node2", Type: gcacheEventRange, First: 150, Last: 250, Detail: "recovery"},
+
+		// the same desync seen by both nodes
+		{Date: date("2023-03-12T11:10:00Z"), Node: "node1", Type: gcacheEventDesync, Subject: "node2"},
+		{Date: date("2023-03-12T11:10:01Z"), Node: "node2", Type: gcacheEventDesync, Subject: "node2"},
+		{Date: date("2023-03-12T11:15:00Z"), Node: "node2", Type: gcacheEventResync, Subject: "node2"},
+		{Date: date("2023-03-12T11:15:01Z"), Node: "node1", Type: gcacheEventResync, Subject: "node2"},
+
+		{Date: date("2023-03-12T12:30:00Z"), Node: "node3", Type: gcacheEventISTRequest, First: 120, Last: 400},
+		{Date: date("2023-03-12T12:40:00Z"), Node: "node3", Type: gcacheEventISTRequest, First: 160, Last: 400},
+	}
+
+	report := gcacheReportFromEvents(events)
+
+	if len(report.Nodes) != 3 || report.Nodes[0].Name != "node1" {
+		t.Fatalf("expected 3 sorted nodes, got %v", report.Nodes)
+	}
+	if rate := report.Nodes[0].WriteSetsPerHour(); rate != 100 {
+		t.Errorf("expected 100 write-sets/h, got %f", rate)
+	}
+	if retention := report.Nodes[0].Retention(); retention != 71*36*time.Second {
+		t.Errorf("expected a retention of 42m36s, got %s", retention)
+	}
+
+	if len(report.DesyncPeriods) != 1 {
+		t.Fatalf("expected a single desync period, got %d", len(report.DesyncPeriods))
+	}
+	dp := report.DesyncPeriods[0]
+	if dp.Node != "node2" || dp.Duration() != 5*time.Minute || !reflect.DeepEqual(dp.ReportedBy, []string{"node1", "node2"}) {
+		t.Errorf("unexpected desync period: %v, duration %s", dp, dp.Duration())
+	}
+
+	if len(report.Decisions) != 2 {
+		t.Fatalf("expected 2 decisions, got %d", len(report.Decisions))
+	}
+	if !strings.Contains(report.Decisions[0].Reason, "seqno 120 already purged") {
+		t.Errorf("expected seqno 120 to be purged, got reason %q", report.Decisions[0].Reason)
+	}
+	if report.Decisions[1].Reason != "" {
+		t.Errorf("node1 gcache could have served seqno 160, got reason %q", report.Decisions[1].Reason)
+	}
+	if !reflect.DeepEqual(report.Decisions[1].KnownGcaches, []string{"node1:130-200", "node2:150-250"}) {
+		t.Errorf("unexpected known gcaches: %v", report.Decisions[1].KnownGcaches)
+	}
+}
+
+func TestWriteSetsPerHourDiscontinuities(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse(time.RFC3339, s)
+		return d
+	}
+	events := []gcacheEvent{
+		{Date: date("2023-03-12T10:00:00Z"), Node: "node1", Type: gcacheEventRange, First: 101, Last: 200, Detail: "recovery"},
+		{Date: date("2023-03-12T10:00:00Z"), Node: "node1", Type: gcacheEventSeqno, First: 200, Last: 200, Detail: "state change"},
+		{Date: date("2023-03-12T11:00:00Z"), Node: "node1", Type: gcacheEventSeqno, First: 300, Last: 300, Detail: "state change"},
+
+		// down for hours, then the seqno jumps through SST
+		{Date: date("2023-03-12T20:00:00Z"), Node: "node1", Type: gcacheEventSeqno, First: 300, Last: 300, Detail: "recovered position"},
+		{Date: date("2023-03-12T20:00:01Z"), Node: "node1", Type: gcacheEventSSTRequired, First: -1, Last: -1},
+		{Date: date("2023-03-12T20:10:00Z"), Node: "node1", Type: gcacheEventSeqno, First: 50000, Last: 50000, Detail: "state change"},
+		{Date: date("2023-03-12T21:10:00Z"), Node: "node1", Type: gcacheEventSeqno, First: 50100, Last: 50100, Detail: "state change"},
+
+		// a single sample does not tell anything
+		{Date: date("2023-03-12T10:00:00Z"), Node: "node2", Type: gcacheEventSeqno, First: 200, Last: 200, Detail: "state change"},
+		{Date: date("2023-03-12T12:00:00Z"), Node: "node2", Type: gcacheEventISTReceived, First: 400, Last: 400},
+	}
+
+	report := gcacheReportFromEvents(events)
+	if rate := report.Nodes[0].WriteSetsPerHour(); rate != 100 {
+		t.Errorf("expected 100 write-sets/h, got %f", rate)
+	}
+	if retention := report.Nodes[0].Retention(); retention != time.Hour {
+		t.Errorf("expected a retention of 1h, got %s", retention)
+	}
+	if rate := report.Nodes[1].WriteSetsPerHour(); rate != 0 {
+		t.Errorf("expected an unknown rate, got %f", rate)
+	}
+}
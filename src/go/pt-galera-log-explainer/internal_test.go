@@ -4,6 +4,8 @@ import (
 	"errors"
 	"os"
 	"testing"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/parser"
 )
 
 func TestTimelineFromPaths(t *testing.T) {
@@ -13,7 +15,7 @@ func TestTimelineFromPaths(t *testing.T) {
 	}{
 		{
 			path:        "tests/logs/",
-			expectedErr: errDirectoriesUnsupported,
+			expectedErr: parser.ErrDirectoriesUnsupported,
 		},
 		{
 			path:        "tests/logs/non_existing",
@@ -1,25 +1,34 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/display"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
-	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
 	"github.com/pkg/errors"
 )
 
 type list struct {
 	// Paths is duplicated because it could not work as variadic with kong cli if I set it as CLI object
-	Paths                  []string `arg:"" name:"paths" help:"paths of the log to use"`
-	SkipStateColoredColumn bool     `help:"avoid having the placeholder colored with mysql state, which is guessed using several regexes that will not be displayed"`
-	All                    bool     `help:"List everything" xor:"states,views,events,sst,applicative"`
-	States                 bool     `help:"List WSREP state changes(SYNCED, DONOR, ...)" xor:"states"`
-	Views                  bool     `help:"List how Galera views evolved (who joined, who left)" xor:"views"`
-	Events                 bool     `help:"List generic mysql events (start, shutdown, assertion failures)" xor:"events"`
-	SST                    bool     `help:"List Galera synchronization event" xor:"sst"`
-	Applicative            bool     `help:"List applicative events (resyncs, desyncs, conflicts). Events tied to one's usage of Galera" xor:"applicative"`
+	Paths                  []string      `arg:"" name:"paths" help:"paths of the log to use"`
+	SkipStateColoredColumn bool          `help:"avoid having the placeholder colored with mysql state, which is guessed using several regexes that will not be displayed"`
+	All                    bool          `help:"List everything" xor:"states,views,events,sst,applicative"`
+	States                 bool          `help:"List WSREP state changes(SYNCED, DONOR, ...)" xor:"states"`
+	Views                  bool          `help:"List how Galera views evolved (who joined, who left)" xor:"views"`
+	Events                 bool          `help:"List generic mysql events (start, shutdown, assertion failures)" xor:"events"`
+	SST                    bool          `help:"List Galera synchronization event" xor:"sst"`
+	Applicative            bool          `help:"List applicative events (resyncs, desyncs, conflicts). Events tied to one's usage of Galera" xor:"applicative"`
+	Json                   bool          `help:"Export the merged timeline as a JSON array, one object per event" xor:"format"`
+	Ndjson                 bool          `help:"Export the merged timeline as newline-delimited JSON, one object per line" xor:"format"`
+	Follow                 bool          `help:"Keep reading logs as they are written, and print new events as they arrive. Stops on Ctrl-C" xor:"format"`
+	FollowInterval         time.Duration `help:"How often files are checked for new lines with --follow" default:"1s"`
 }
 
 func (l *list) Help() string {
@@ -33,6 +42,8 @@ Usage:
 	%[1]s list --all *.log
 	%[1]s list --sst --views --states <list of files>
 	%[1]s list --events --views *.log
+	%[1]s list --all --ndjson *.log
+	%[1]s list --all --follow /var/lib/mysql/*.log
 	`, toolname)
 }
 
@@ -42,35 +53,64 @@ func (l *list) Run() error {
 		return errors.New("flag required: --all, or any parameters from: --sst --views --events --states --applicative")
 	}
 
+	// colors are painted when handling logs, so it has to be disabled before
+	if l.Json || l.Ndjson {
+		utils.SkipColor = true
+	}
+
 	toCheck := l.regexesToUse()
 
+	if l.Follow {
+		return l.follow(toCheck)
+	}
+
 	timeline, err := timelineFromPaths(CLI.List.Paths, toCheck)
 	if err != nil {
 		return errors.Wrap(err, "could not list events")
 	}
 
 	if CLI.Verbosity == types.Debug {
-		out, err := translate.DBToJson()
+		out, err := timeline.DB().ToJson()
 		if err != nil {
 			return errors.Wrap(err, "could not dump translation structs to json")
 		}
 		fmt.Println(out)
 	}
 
+	if l.Json || l.Ndjson {
+		return display.TimelineJSON(timeline, CLI.Verbosity, l.Ndjson)
+	}
+
 	display.TimelineCLI(timeline, CLI.Verbosity)
 
 	return nil
 }
 
+func (l *list) follow(toCheck types.RegexMap) error {
+	if l.FollowInterval <= 0 {
+		return errors.New("--follow-interval should be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	timeline, updates, err := followTimelineFromPaths(ctx, CLI.List.Paths, toCheck, l.FollowInterval)
+	if err != nil {
+		return errors.Wrap(err, "could not follow events")
+	}
+
+	display.TimelineCLIFollow(timeline, CLI.Verbosity, updates)
+	return nil
+}
+
 func (l *list) regexesToUse() types.RegexMap {
 
 	// IdentRegexes is always needed: we would not be able to identify the node where the file come from
-	toCheck := regex.IdentsMap
+	toCheck := types.RegexMap{}.Merge(regex.IdentsMap)
 	if l.States || l.All {
 		toCheck.Merge(regex.StatesMap)
 	} else if !l.SkipStateColoredColumn {
-		regex.SetVerbosity(types.DebugMySQL, regex.StatesMap)
-		toCheck.Merge(regex.StatesMap)
+		toCheck.Merge(regex.WithVerbosity(types.DebugMySQL, regex.StatesMap))
 	}
 	if l.Views || l.All {
 		toCheck.Merge(regex.ViewsMap)
@@ -84,9 +124,7 @@ func (l *list) regexesToUse() types.RegexMap {
 	if l.Events || l.All {
 		toCheck.Merge(regex.EventsMap)
 	} else if !l.SkipStateColoredColumn {
-		regex.SetVerbosity(types.DebugMySQL, regex.EventsMap)
-		toCheck.Merge(regex.EventsMap)
+		toCheck.Merge(regex.WithVerbosity(types.DebugMySQL, regex.EventsMap))
 	}
-	toCheck.Merge(regex.CustomMap)
 	return toCheck
 }
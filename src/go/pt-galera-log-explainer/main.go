@@ -7,7 +7,6 @@ import (
 
 	"github.com/alecthomas/kong"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
-	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
 	"github.com/rs/zerolog"
@@ -26,31 +25,42 @@ var (
 	Commit    string //nolint
 )
 
+// customRules are loaded from --custom-rules files once, then given to every analysis
+var customRules []regex.Rule
+
 var buildInfo = fmt.Sprintf("%s\nVersion %s\nBuild: %s using %s\nCommit: %s", toolname, Version, Build, GoVersion, Commit)
 
 var CLI struct {
 	NoColor               bool
-	Since                 *time.Time      `help:"Only list events after this date, format: 2023-01-23T03:53:40Z (RFC3339)"`
-	Until                 *time.Time      `help:"Only list events before this date"`
-	Verbosity             types.Verbosity `type:"counter" short:"v" default:"0" help:"-v: DebugMySQL (add every mysql info the tool used), -vv: Debug (internal tool debug)"`
-	PxcOperator           bool            `default:"false" help:"Analyze logs from Percona PXC operator. Will cause slow performance on non-k8s setups"`
-	SkipOperatorDetection bool            `default:"false" help:"Skip auto detection of Percona PXC operator logs"`
-	ExcludeRegexes        []string        `help:"Remove regexes from analysis. List regexes using 'pt-galera-log-explainer regex-list'"`
-	MergeByDirectory      bool            `help:"Instead of relying on identification, merge contexts and columns by base directory. Very useful when dealing with many small logs organized per directories."`
-	SkipMerge             bool            `help:"Disable the ability to merge log files together. Can be used when every nodes have the same wsrep_node_name"`
-
-	List  list  `cmd:""`
-	Whois whois `cmd:""`
-	//	Sed       sed       `cmd:""`
+	Since                 *time.Time        `help:"Only list events after this date, format: 2023-01-23T03:53:40Z (RFC3339)"`
+	Until                 *time.Time        `help:"Only list events before this date"`
+	Verbosity             types.Verbosity   `type:"counter" short:"v" default:"0" help:"-v: DebugMySQL (add every mysql info the tool used), -vv: Debug (internal tool debug)"`
+	PxcOperator           bool              `default:"false" help:"Analyze logs from Percona PXC operator. Will cause slow performance on non-k8s setups"`
+	SkipOperatorDetection bool              `default:"false" help:"Skip auto detection of Percona PXC operator logs"`
+	Flavor                types.Flavor      `default:"auto" enum:"auto,pxc,mariadb" help:"Galera distribution the logs are coming from, to use its own log formats (mariadbd binary name, mariabackup errors, ...). 'auto' will detect MariaDB logs"`
+	ExcludeRegexes        []string          `help:"Remove regexes from analysis. List regexes using 'pt-galera-log-explainer regex-list'"`
+	MergeByDirectory      bool              `help:"Instead of relying on identification, merge contexts and columns by base directory. Very useful when dealing with many small logs organized per directories."`
+	SkipMerge             bool              `help:"Disable the ability to merge log files together. Can be used when every nodes have the same wsrep_node_name"`
+	TimeOffsets           map[string]string `help:"Adjust dates of some files, separated by semi-colons: file=adjustment. The adjustment is a duration to add (-2m30s), and/or the timezone of dates logged without one (Europe/Paris, +02:00), separated by commas. Example: --time-offsets=\"node1.log=Europe/Paris;node2.log=-1m30s\""`
+	EstimateSkew          bool              `help:"Estimate clock skews between files using events every nodes log at the same time (view changes, inconsistency votes), and align dates accordingly"`
+
+	List      list      `cmd:""`
+	Whois     whois     `cmd:""`
+	Sed       sed       `cmd:""`
 	Ctx       ctx       `cmd:""`
 	RegexList regexList `cmd:""`
 	Conflicts conflicts `cmd:""`
+	Diagnose  diagnose  `cmd:""`
+	SST       sst       `cmd:""`
+	Gcache    gcache    `cmd:""`
+	Views     views     `cmd:""`
 
 	Version kong.VersionFlag
 
 	GrepCmd string `help:"'grep' command path. Could need to be set to 'ggrep' for darwin systems" default:"grep"`
 
 	CustomRegexes map[string]string `help:"Add custom regexes, printed in magenta. Format: (golang regex string)=[optional static message to display]. If the static message is left empty, the captured string will be printed instead. Custom regexes are separated using semi-colon. Example: --custom-regexes=\"Page cleaner took [0-9]*ms to flush [0-9]* pages=;doesn't recommend.*pxc_strict_mode=unsafe query used\""`
+	CustomRules   []string          `help:"Add regexes from YAML rules files, with internal regexes, message templates using named captures, and optional state changes. See the documentation for the file format" type:"existingfile"`
 }
 
 func main() {
@@ -66,14 +76,18 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: CLI.NoColor, FormatTimestamp: func(_ interface{}) string { return "" }})
-	initComponentLogger()
 	if CLI.Verbosity == types.Debug {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
 	utils.SkipColor = CLI.NoColor
 
-	err := regex.AddCustomRegexes(CLI.CustomRegexes)
+	var err error
+	customRules, err = regex.RulesFromFiles(CLI.CustomRules)
+	kongcli.FatalIfErrorf(err)
+
+	// invalid custom regexes and conflicting rules are reported before searching anything
+	_, err = regex.Resolve(regex.AllRegexes().Merge(regex.PXCOperatorMap), types.FlavorAuto, CLI.CustomRegexes, customRules)
 	kongcli.FatalIfErrorf(err)
 
 	for _, path := range kongcli.Path {
@@ -83,11 +97,15 @@ func main() {
 				CLI.PxcOperator = true
 				log.Info().Msg("Detected logs coming from Percona XtraDB Cluster Operator, enabling --pxc-operator")
 			}
+			if ok && CLI.Flavor == types.FlavorAuto {
+				CLI.Flavor = detectFlavor(paths)
+				if CLI.Flavor == types.FlavorMariaDB {
+					log.Info().Msg("Detected logs coming from MariaDB, enabling --flavor=mariadb")
+				}
+			}
 		}
 	}
 
-	translate.AssumeIPStable = !CLI.PxcOperator
-
 	err = kongcli.Run()
 	kongcli.FatalIfErrorf(err)
 }
@@ -116,12 +116,91 @@ func TestMain(t *testing.T) {
 			path: "tests/logs/conflict/*",
 		},
 
+		{
+			name: "conflict_conflicts_json",
+			cmd:  []string{"conflicts", "--json"},
+			path: "tests/logs/conflict/*",
+		},
+		{
+			name: "conflict_conflicts_json_aggregate",
+			cmd:  []string{"conflicts", "--json", "--aggregate"},
+			path: "tests/logs/conflict/*",
+		},
+
 		{
 			name: "conflict_list_all_no_color",
 			cmd:  []string{"list", "--all", "--no-color"},
 			path: "tests/logs/conflict/*",
 		},
 
+		{
+			name: "conflict_list_all_ndjson",
+			cmd:  []string{"list", "--all", "--ndjson"},
+			path: "tests/logs/conflict/*",
+		},
+
+		{
+			name: "upgrade_sst_no_color",
+			cmd:  []string{"sst", "--no-color"},
+			path: "tests/logs/upgrade/*.log",
+		},
+		{
+			name: "operator_concurrent_ssts_sst_no_color",
+			cmd:  []string{"sst", "--pxc-operator", "--no-color"},
+			path: "tests/logs/operator_concurrent_ssts/*",
+		},
+
+		{
+			name: "upgrade_diagnose_no_color",
+			cmd:  []string{"diagnose", "--no-color"},
+			path: "tests/logs/upgrade/*.log",
+		},
+		{
+			name: "conflict_diagnose_no_color",
+			cmd:  []string{"diagnose", "--no-color"},
+			path: "tests/logs/conflict/*",
+		},
+		{
+			name: "shutdown_diagnose_no_color",
+			cmd:  []string{"diagnose", "--no-color"},
+			path: "tests/logs/shutdown/*",
+		},
+		{
+			name: "upgrade_sed_script",
+			cmd:  []string{"sed", "--script"},
+			path: "tests/logs/upgrade/*.log",
+		},
+		{
+			name: "upgrade_sed_script_by_ip",
+			cmd:  []string{"sed", "--script", "--by-ip"},
+			path: "tests/logs/upgrade/*.log",
+		},
+		{
+			name: "upgrade_views_no_color",
+			cmd:  []string{"views", "--no-color"},
+			path: "tests/logs/upgrade/*.log",
+		},
+		{
+			name: "upgrade_views_at_no_color",
+			cmd:  []string{"views", "--no-color", "--at=2023-03-12T19:40:00Z"},
+			path: "tests/logs/upgrade/*.log",
+		},
+		{
+			name: "operator_split_views_no_color",
+			cmd:  []string{"views", "--no-color", "--pxc-operator"},
+			path: "tests/logs/operator_split/*",
+		},
+		{
+			name: "upgrade_gcache_no_color",
+			cmd:  []string{"gcache", "--no-color"},
+			path: "tests/logs/upgrade/*.log",
+		},
+		{
+			name: "upgrade_list_views_time_offsets_no_color",
+			cmd:  []string{"list", "--views", "--no-color", "--estimate-skew", "--time-offsets=node3.log=-2m"},
+			path: "tests/logs/upgrade/*.log",
+		},
+
 		{
 			name: "merge_rotated_daily_list_all_custom_regex_dynamic_output_no_color",
 			cmd:  []string{"list", "--all", "--custom-regexes=Page cleaner took [0-9]*ms to flush 2000=", "--no-color"},
@@ -164,6 +243,22 @@ func TestMain(t *testing.T) {
 			cmd:  []string{"whois", "10.16.27.98", "--pxc-operator", "--json"},
 			path: "tests/logs/operator_ambiguous_ips/*",
 		},
+
+		{
+			name: "mariadb_list_all_no_color",
+			cmd:  []string{"list", "--all", "--no-color"},
+			path: "tests/logs/mariadb/*",
+		},
+		{
+			name: "mariadb_list_all_flavor_pxc_no_color",
+			cmd:  []string{"list", "--all", "--no-color", "--flavor=pxc"},
+			path: "tests/logs/mariadb/*",
+		},
+		{
+			name: "mariadb_whois_node3",
+			cmd:  []string{"whois", "node3", "--no-color"},
+			path: "tests/logs/mariadb/*",
+		},
 	}
 
 TESTS:
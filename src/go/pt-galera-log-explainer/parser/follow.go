@@ -0,0 +1,247 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+)
+
+// Follow parses paths like Parse, then keeps reading what is appended to them every interval
+// Events found afterward are sent grouped by the node their file was merged with in the returned timeline,
+// and handled with the context the file had so far, so that states and translations stay up to date
+// Paths without any events at first are still followed, their node is found once they have some
+// The channel is closed once ctx is done
+func (o Options) Follow(ctx context.Context, paths []string, interval time.Duration) (types.Timeline, <-chan types.Timeline, error) {
+	p, err := o.newParse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	followers := map[string]*follower{}
+	timeline, err := p.parsePaths(paths, followers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// timelines can be dequeued by callers, nodes have to be found before giving it
+	for node, lt := range timeline {
+		for _, li := range lt {
+			if f, ok := followers[li.LogCtx.FilePath]; ok {
+				f.node = node
+			}
+		}
+	}
+	for path, f := range followers {
+		if f.node == "" {
+			p.logger.Info().Str("path", path).Msg("no events found yet, its node will be found once there are some")
+		}
+	}
+
+	updates := make(chan types.Timeline)
+	go p.follow(ctx, followers, interval, updates)
+	return timeline, updates, nil
+}
+
+func (p *parse) follow(ctx context.Context, followers map[string]*follower, interval time.Duration, updates chan<- types.Timeline) {
+	defer close(updates)
+
+	// files are read in the same order every time, so that merges are stable
+	paths := make([]string, 0, len(followers))
+	for path := range followers {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		update := types.Timeline{}
+		for _, path := range paths {
+			f := followers[path]
+			if f.done {
+				continue
+			}
+			lt, err := f.poll()
+			if err != nil {
+				p.logger.Warn().Str("path", path).Err(err).Msg("failed to follow file")
+				continue
+			}
+			if len(lt) == 0 {
+				continue
+			}
+			if f.done {
+				p.logger.Info().Str("path", path).Msg("reached --until, stopped following file")
+			}
+			if f.node == "" {
+				f.node = p.nodeOf(path, lt)
+			}
+			if lt2, ok := update[f.node]; ok {
+				lt = types.MergeTimeline(lt2, lt)
+			}
+			update[f.node] = lt
+		}
+		if len(update) == 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case updates <- update:
+		}
+	}
+}
+
+// nodeOf is the node parsePaths would have merged a file with, given its first events
+func (p *parse) nodeOf(path string, lt types.LocalTimeline) string {
+	switch {
+	case p.SkipMerge:
+		return path
+	case p.PxcOperator:
+		if metadata := lt[len(lt)-1].LogCtx.OperatorMetadata; metadata != nil {
+			return metadata.PodName
+		}
+		return path
+	case p.MergeByDirectory:
+		return filepath.Base(filepath.Dir(path))
+	}
+	return lt.Identifier()
+}
+
+// follower reads a file incrementally, starting where the previous read ended
+type follower struct {
+	path    string
+	node    string
+	handler *lineHandler
+
+	info       os.FileInfo
+	offset     int64
+	linenumber int
+
+	// the end of a line which is still being written
+	partial []byte
+
+	// set once --until is reached
+	done bool
+}
+
+// newFollower opens path, the returned file must be closed once its initial content has been read
+func newFollower(path string) (*follower, *os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	offset, err := lastCompleteLine(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return &follower{path: path, info: info, offset: offset}, file, nil
+}
+
+// initialContent is the content of the file up to its last complete line when it was opened
+// lines are counted while it is read, so that line numbers keep going when following
+func (f *follower) initialContent(file *os.File) io.Reader {
+	return &lineCounter{r: io.NewSectionReader(file, 0, f.offset), count: &f.linenumber}
+}
+
+// poll handles every complete lines appended since the last call
+func (f *follower) poll() (types.LocalTimeline, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !os.SameFile(info, f.info) || info.Size() < f.offset {
+		// rotated or truncated: the new content starts from the beginning
+		f.offset, f.linenumber, f.partial = 0, 0, nil
+	}
+	f.info = info
+	if info.Size() == f.offset {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(file, f.offset, info.Size()-f.offset))
+	if err != nil {
+		return nil, err
+	}
+	f.offset += int64(len(data))
+	data = append(f.partial, data...)
+
+	var (
+		lt types.LocalTimeline
+		ok bool
+	)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(data[:i])
+		data = data[i+1:]
+		f.linenumber++
+
+		lt, ok = f.handler.handle(lt, f.linenumber, sanitizeLine(line))
+		if !ok {
+			f.done = true
+			return lt, nil
+		}
+	}
+	f.partial = append([]byte(nil), data...)
+	return lt, nil
+}
+
+// lastCompleteLine returns the offset following the last newline before size
+// a line still being written must not be read half-way
+func lastCompleteLine(file io.ReaderAt, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		n, err := file.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+type lineCounter struct {
+	r     io.Reader
+	count *int
+}
+
+func (c *lineCounter) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	*c.count += bytes.Count(b[:n], []byte{'\n'})
+	return n, err
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+)
+
+func TestFollow(t *testing.T) {
+	content, err := os.ReadFile("../tests/logs/mariadb/node2.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	initial := bytes.Join(lines[:30], nil)
+	appended := bytes.Join(lines[30:], nil)
+
+	path := filepath.Join(t.TempDir(), "node2.log")
+	// the last line is still being written, it should not be read yet
+	if err := os.WriteFile(path, append(initial, appended[:20]...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	timeline, updates, err := Options{}.Follow(ctx, []string{path}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeline) != 1 {
+		t.Fatalf("expected a single node, got %d", len(timeline))
+	}
+	var node string
+	for node = range timeline {
+	}
+	initialLen := len(timeline[node])
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(appended[20:]); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	expected, err := Options{}.Parse([]string{"../tests/logs/mariadb/node2.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastExpected := expected["node2"][len(expected["node2"])-1]
+
+	var last types.LogInfo
+	followed := 0
+	for update := range updates {
+		if len(update[node]) == 0 {
+			t.Fatalf("expected events for %s, got %v", node, update)
+		}
+		followed += len(update[node])
+		last = update[node][len(update[node])-1]
+		if last.LineNumber == lastExpected.LineNumber {
+			cancel()
+		}
+	}
+
+	if last.LineNumber != lastExpected.LineNumber || last.Msg(last.LogCtx) != lastExpected.Msg(lastExpected.LogCtx) {
+		t.Errorf("expected to end on line %d %q, got line %d %q", lastExpected.LineNumber, lastExpected.Msg(lastExpected.LogCtx), last.LineNumber, last.Msg(last.LogCtx))
+	}
+	if last.LogCtx.State() != lastExpected.LogCtx.State() {
+		t.Errorf("expected state %s, got %s", lastExpected.LogCtx.State(), last.LogCtx.State())
+	}
+	if initialLen+followed < len(expected["node2"]) {
+		t.Errorf("expected at least %d events, got %d initially and %d followed", len(expected["node2"]), initialLen, followed)
+	}
+}
+
+func TestFollowTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.log")
+	line := "2023-03-12T19:35:05.840743Z 0 [System] [MY-010116] [Server] /usr/sbin/mysqld (mysqld 8.0.28-19.1) starting as process 2070978\n"
+	if err := os.WriteFile(path, []byte(line+line+line), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, updates, err := Options{}.Follow(ctx, []string{path}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// as if it was rotated using copytruncate
+	if err := os.WriteFile(path, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	update, ok := <-updates
+	if !ok {
+		t.Fatal("expected the truncated file to be read again")
+	}
+	for _, lt := range update {
+		if len(lt) != 1 || lt[0].LineNumber != 1 {
+			t.Errorf("expected the truncated file to be read from its first line, got %v", lt)
+		}
+	}
+}
+
+func TestFollowEmpty(t *testing.T) {
+	content, err := os.ReadFile("../tests/logs/mariadb/node2.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "node2.log")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// nothing has been logged yet, it should not fail
+	timeline, updates, err := Options{}.Follow(ctx, []string{path}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeline) != 0 {
+		t.Fatalf("expected no nodes yet, got %d", len(timeline))
+	}
+
+	// written at once, so that the first lines read can identify the node
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+
+	update, ok := <-updates
+	if !ok {
+		t.Fatal("expected the file to be followed")
+	}
+	if len(update["node2"]) == 0 {
+		t.Errorf("expected events to be attached to node2, got %v", update)
+	}
+}
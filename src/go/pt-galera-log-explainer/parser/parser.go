@@ -0,0 +1,412 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrDirectoriesUnsupported = errors.New("directories are not supported")
+	ErrNoData                 = errors.New("could not find data")
+)
+
+// Options drives how logs are searched and merged into a timeline
+// The zero value searches every builtin regexes and merges files by node identifiers
+type Options struct {
+	// Regexes to search for. Every builtin regexes are used when nil
+	// They are copied for each call, along with everything below, so builtin maps are never modified
+	Regexes types.RegexMap
+
+	// Galera distribution, its variants replace the builtin regexes they are written for
+	Flavor types.Flavor
+
+	// Regexes from --custom-regexes: regex string to the static message to print, captured text is printed when empty
+	CustomRegexes map[string]string
+
+	// Rules from rules files, added when their type is selected in Regexes
+	Rules []regex.Rule
+
+	// Only keep events between those dates
+	Since *time.Time
+	Until *time.Time
+
+	// PxcOperator adds operator specific regexes, and stops merging files from different pods
+	PxcOperator bool
+
+	// Merge files by base directory instead of relying on identification
+	MergeByDirectory bool
+
+	// Never merge files together, every path will be its own node
+	SkipMerge bool
+
+	// Keys of regexes to ignore
+	ExcludeRegexes []string
+
+	// 'grep' command path, "grep" when empty
+	GrepCmd string
+
+	// How to adjust dates for each path, dates are used as logged for missing paths
+	Clocks map[string]*types.FileClock
+
+	// Where identities found in logs are stored
+	// A new one is created for each call when nil, so that analyses do not contaminate each other
+	Translations *translate.DB
+}
+
+// Parse searches every paths and organizes them in a timeline that will be ready to aggregate or read
+// Every contexts in the timeline share the translations, they can be used from any of them with LogCtx.DB()
+func (o Options) Parse(paths []string) (types.Timeline, error) {
+	p, err := o.newParse()
+	if err != nil {
+		return nil, err
+	}
+	return p.parsePaths(paths, nil)
+}
+
+// parsePaths searches every paths and merges them in a timeline
+// when followers is not nil, files are only read up to their last complete line
+// and a follower is stored for each path, to read what comes next later on
+func (p *parse) parsePaths(paths []string, followers map[string]*follower) (types.Timeline, error) {
+
+	timeline := make(types.Timeline)
+	found := false
+
+	compiledRegex := p.prepareGrepArgument()
+
+	for _, path := range paths {
+		osinfo, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if osinfo.IsDir() {
+			return nil, ErrDirectoriesUnsupported
+		}
+
+		var (
+			f     *follower
+			file  *os.File
+			input io.Reader
+		)
+		if followers != nil {
+			f, file, err = newFollower(path)
+			if err != nil {
+				return nil, err
+			}
+			followers[path] = f
+			input = f.initialContent(file)
+		}
+
+		stdout := make(chan string)
+
+		go func() {
+			err := p.execGrepAndIterate(path, compiledRegex, input, stdout)
+			if err != nil {
+				p.logger.Error().Str("path", path).Err(err).Msg("execGrepAndIterate returned error")
+			}
+			if file != nil {
+				file.Close()
+			}
+			close(stdout)
+		}()
+
+		// it will iterate on stdout pipe results
+		handler := p.newLineHandler(path, p.Clocks[path])
+		localTimeline, ok := handler.iterate(stdout)
+		if f != nil {
+			f.handler = handler
+			f.done = !ok
+		}
+		if len(localTimeline) == 0 {
+			continue
+		}
+		found = true
+		p.logger.Debug().Str("path", path).Msg("finished searching")
+
+		// Why it should not just identify using the file path:
+		// so that we are able to merge files that belong to the same nodes
+		// we wouldn't want them to be shown as from different nodes
+		if p.SkipMerge {
+			timeline[path] = localTimeline
+		} else if p.PxcOperator {
+			timeline.MergeByPodnameElsePath(path, localTimeline)
+		} else if p.MergeByDirectory {
+			timeline.MergeByDirectory(path, localTimeline)
+		} else {
+			timeline.MergeByIdentifier(localTimeline)
+		}
+	}
+	// when following, events can still be logged later
+	if !found && followers == nil {
+		return nil, ErrNoData
+	}
+	return timeline, nil
+}
+
+// parse holds what a single Parse call needs, nothing is shared between calls
+type parse struct {
+	Options
+	regexes types.RegexMap
+	logger  zerolog.Logger
+}
+
+func (o Options) newParse() (*parse, error) {
+	p := &parse{Options: o}
+
+	if p.GrepCmd == "" {
+		p.GrepCmd = "grep"
+	}
+	if p.Translations == nil {
+		p.Translations = translate.NewDB()
+		p.Translations.AssumeIPStable = !o.PxcOperator
+	}
+
+	selection := o.Regexes
+	if selection == nil {
+		selection = regex.AllRegexes()
+	}
+	if o.PxcOperator {
+		selection = types.RegexMap{}.Merge(selection).Merge(regex.PXCOperatorMap)
+	}
+	var err error
+	p.regexes, err = regex.Resolve(selection, o.Flavor, o.CustomRegexes, o.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger = log.With().Str("component", "extractor").Logger()
+	if o.Since != nil {
+		p.logger = p.logger.With().Time("since", *o.Since).Logger()
+	}
+	if o.Until != nil {
+		p.logger = p.logger.With().Time("until", *o.Until).Logger()
+	}
+	return p, nil
+}
+
+// prepareGrepArgument compiles every regexes into a single one for grep
+// --since is widened by clock offsets, as the grep prefilter is applied on dates as they were logged
+func (p *parse) prepareGrepArgument() string {
+
+	regexToSendSlice, operatorSlice := []string{}, []string{}
+	for _, r := range p.regexes {
+		if r.Type == types.PXCOperatorRegexType {
+			operatorSlice = append(operatorSlice, r.Regex.String())
+		} else {
+			regexToSendSlice = append(regexToSendSlice, r.Regex.String())
+		}
+	}
+
+	grepRegex := "^"
+	if p.PxcOperator {
+		// special case
+		// I'm not adding pxcoperator map the same way others are used, because they do not have the same formats and same place
+		// it needs to be put on the front so that it's not 'merged' with the '{"log":"' json prefix
+		// this is to keep things as close as '^' as possible to keep doing prefix searches
+		grepRegex += "((" + strings.Join(operatorSlice, "|") + ")|^" + types.OperatorLogPrefix
+	}
+	if p.Since != nil {
+		since := p.Since.Add(-grepSinceMargin(p.Clocks))
+		grepRegex += "(" + regex.BetweenDateRegex(&since, p.PxcOperator) + "|" + regex.NoDatesRegex(p.PxcOperator) + ")"
+	}
+	grepRegex += ".*"
+	grepRegex += "(" + strings.Join(regexToSendSlice, "|") + ")"
+	if p.PxcOperator {
+		grepRegex += ")"
+	}
+	p.logger.Debug().Str("grepArg", grepRegex).Msg("compiled grep arguments")
+	return grepRegex
+}
+
+// execGrepAndIterate reads from input instead of path when not nil
+func (p *parse) execGrepAndIterate(path, compiledRegex string, input io.Reader, stdout chan<- string) error {
+
+	// A first pass is done, with every regexes we want compiled in a single one.
+
+	/*
+		Regular grep is actually used
+
+		There are no great alternatives, even less as golang libraries.
+		grep itself do not have great alternatives: they are less performant for common use-cases, or are not easily portable, or are costlier to execute.
+		grep is everywhere, grep is good enough, it even enable to use the stdout pipe.
+
+		The usual bottleneck with grep is that it is single-threaded, but we actually benefit
+		from a sequential scan here as we will rely on the log order.
+
+		Also, being sequential also ensure this program is light enough to run without too much impacts
+		It also helps to be transparent and not provide an obscure tool that work as a blackbox
+	*/
+	if runtime.GOOS == "darwin" && p.GrepCmd == "grep" {
+		p.logger.Warn().Msg("On Darwin systems, use 'pt-galera-log-explainer --grep-cmd=ggrep' as it requires grep v3")
+	}
+
+	cmd := exec.Command(p.GrepCmd, "-a", "-n", "-P", compiledRegex, path)
+	if input != nil {
+		cmd = exec.Command(p.GrepCmd, "-a", "-n", "-P", compiledRegex, "-")
+		cmd.Stdin = input
+	}
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.Wrap(err, "could not open stdout pipe")
+	}
+	defer out.Close()
+
+	err = cmd.Start()
+	if err != nil {
+		return errors.Wrapf(err, "failed to search in %s", path)
+	}
+
+	// grep treatment
+	s := bufio.NewScanner(out)
+	for s.Scan() {
+		stdout <- s.Text()
+	}
+
+	// double-check it stopped correctly
+	if err = cmd.Wait(); err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok && exiterr.ExitCode() == 1 {
+			return nil
+		}
+		return errors.Wrap(err, "grep subprocess error")
+	}
+
+	return nil
+}
+
+// splitLineNumber separates the line number prefixed by "grep -n" from the actual log line
+func splitLineNumber(s string) (int, string) {
+	prefix, line, found := strings.Cut(s, ":")
+	if !found {
+		return 0, s
+	}
+	n, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, s
+	}
+	return n, line
+}
+
+func sanitizeLine(s string) string {
+	if len(s) > 0 && s[0] == '\t' {
+		return s[1:]
+	}
+	return s
+}
+
+// lineHandler keeps what is needed to handle the lines of a file one after the other
+// so that lines appended later can be handled with the context of previous ones
+type lineHandler struct {
+	p         *parse
+	logCtx    types.LogCtx
+	timestamp time.Time
+
+	// a line can match multiple regexes, they need to be handled in the same order every time
+	// else the output is not stable for logs with second-precision dates
+	keys []string
+}
+
+// dates are adjusted using the clock, which can be nil
+func (p *parse) newLineHandler(path string, clock *types.FileClock) *lineHandler {
+	logCtx := types.NewLogCtx()
+	logCtx.FilePath = path
+	logCtx.Clock = clock
+	logCtx.Translations = p.Translations
+
+	return &lineHandler{p: p, logCtx: logCtx, keys: p.regexes.SortedKeys()}
+}
+
+// iterate will take line by line each logs that matched regex
+// it will iterate on every regexes in slice, and apply the handler for each
+// it also filters out --since and --until rows
+// it returns false when the rest of the file is after --until
+func (h *lineHandler) iterate(grepStdout <-chan string) (types.LocalTimeline, bool) {
+	var lt types.LocalTimeline
+	for line := range grepStdout {
+		linenumber, line := splitLineNumber(line)
+
+		var ok bool
+		lt, ok = h.handle(lt, linenumber, sanitizeLine(line))
+		if !ok {
+			return lt, false
+		}
+	}
+	return lt, true
+}
+
+// handle searches a single line with every regexes, adding the results to lt
+// it returns false once --until is reached
+func (h *lineHandler) handle(lt types.LocalTimeline, linenumber int, line string) (types.LocalTimeline, bool) {
+	var (
+		displayer types.LogDisplayer
+		date      *types.Date
+	)
+
+	t, layout, ok := regex.SearchDateFromLog(line)
+	if ok {
+		t = h.logCtx.Clock.Adjust(t, layout)
+		// diff between date and timestamp:
+		// timestamp is an internal usage to handle translations, it must be non-empty
+		// date is something that will be displayed ultimately, it can empty
+		date = types.NewDate(t, layout)
+		h.timestamp = t
+	} // else, keep the previous timestamp
+
+	// If it's recentEnough, it means we already validated a log: every next logs necessarily happened later
+	// this is useful because not every logs have a date attached, and some without date are very useful
+	if h.p.Since != nil && h.p.Since.After(h.timestamp) {
+		return lt, true
+	}
+	if h.p.Until != nil && h.p.Until.Before(h.timestamp) {
+		return lt, false
+	}
+
+	filetype := regex.FileType(line, h.p.PxcOperator)
+	h.logCtx.FileType = filetype
+
+	// We have to find again what regex worked to get this log line
+	// it can match multiple regexes
+	for _, key := range h.keys {
+		regex := h.p.regexes[key]
+		if !regex.Regex.MatchString(line) || utils.SliceContains(h.p.ExcludeRegexes, key) {
+			continue
+		}
+		h.logCtx, displayer = regex.Handle(h.logCtx, line, h.timestamp)
+		li := types.NewLogInfo(date, displayer, line, regex, key, h.logCtx, filetype)
+		li.LineNumber = linenumber
+		lt = lt.Add(li)
+	}
+	return lt, true
+}
+
+// grepSinceMargin widens --since for the grep prefilter, which works on raw dates
+func grepSinceMargin(clocks map[string]*types.FileClock) time.Duration {
+	var margin time.Duration
+	for _, clock := range clocks {
+		offset := clock.Offset
+		if offset < 0 {
+			offset = -offset
+		}
+		if clock.Location != nil {
+			// timezones offsets are within a day
+			offset += 24 * time.Hour
+		}
+		if offset > margin {
+			margin = offset
+		}
+	}
+	return margin
+}
@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		path        string
+		expectedErr error
+	}{
+		{
+			path:        "../tests/logs/",
+			expectedErr: ErrDirectoriesUnsupported,
+		},
+		{
+			path:        "../tests/logs/non_existing",
+			expectedErr: os.ErrNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Options{}.Parse([]string{test.path})
+		if !errors.Is(err, test.expectedErr) {
+			t.Fatalf("with path %s, expected error %v, got %v", test.path, test.expectedErr, err)
+		}
+	}
+}
+
+func TestParseConcurrently(t *testing.T) {
+	tests := []struct {
+		paths     []string
+		knownIP   string
+		unknownIP string
+		timeline  types.Timeline
+	}{
+		{
+			paths:     []string{"../tests/logs/upgrade/node1.log", "../tests/logs/upgrade/node2.log", "../tests/logs/upgrade/node3.log"},
+			knownIP:   "172.17.0.2",
+			unknownIP: "172.18.0.2",
+		},
+		{
+			paths:     []string{"../tests/logs/mariadb/node1.log", "../tests/logs/mariadb/node2.log", "../tests/logs/mariadb/node3.log"},
+			knownIP:   "172.18.0.2",
+			unknownIP: "172.17.0.2",
+		},
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(tests))
+	for i := range tests {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tests[i].timeline, errs[i] = Options{}.Parse(tests[i].paths)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, test := range tests {
+		if errs[i] != nil {
+			t.Fatalf("failed to parse %v: %v", test.paths, errs[i])
+		}
+		if len(test.timeline) != 3 {
+			t.Fatalf("expected 3 nodes for %v, got %d", test.paths, len(test.timeline))
+		}
+		db := test.timeline["node1"][0].LogCtx.DB()
+		if db == translate.GetDB() {
+			t.Fatalf("%v: contexts should not use the package-level translations", test.paths)
+		}
+		if name := db.SimplestInfoFromIP(test.knownIP, test.timeline["node1"][0].Date.Time); name != "node1" {
+			t.Errorf("%v: expected %s to be node1, got %s", test.paths, test.knownIP, name)
+		}
+		if db.IsNodeNameKnown("node1") && db.SimplestInfoFromIP(test.unknownIP, test.timeline["node1"][0].Date.Time) != test.unknownIP {
+			t.Errorf("%v: %s should only be known by the other analysis", test.paths, test.unknownIP)
+		}
+	}
+	if ips := translate.KnownIPs(); len(ips) != 0 {
+		t.Errorf("package-level translations should be untouched, got %v", ips)
+	}
+}
+
+func TestParseKeepsRegexesUntouched(t *testing.T) {
+	builtin := regex.EventsMap["RegexShutdownComplete"]
+	builtinCopy := *builtin
+	selection := types.RegexMap{}.Merge(regex.IdentsMap).Merge(regex.EventsMap)
+
+	timeline, err := Options{
+		Regexes:       selection,
+		Flavor:        types.FlavorMariaDB,
+		CustomRegexes: map[string]string{"Shutdown complete": "custom shutdown"},
+		Rules:         []regex.Rule{{Name: "RegexTestRuleStarting", Regex: "starting as process", Type: "events"}},
+	}.Parse([]string{"../tests/logs/mariadb/node1.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeline) == 0 {
+		t.Fatal("expected events")
+	}
+
+	if regex.EventsMap["RegexShutdownComplete"] != builtin || builtin.Regex != builtinCopy.Regex || builtin.Verbosity != builtinCopy.Verbosity {
+		t.Error("builtin regexes should be untouched")
+	}
+	for _, key := range []string{"Shutdown complete", "RegexTestRuleStarting", "RegexMariabackupError"} {
+		if _, ok := selection[key]; ok {
+			t.Errorf("%s should not be added to the given regexes", key)
+		}
+		if _, ok := regex.AllRegexes()[key]; ok {
+			t.Errorf("%s should not be added to builtin regexes", key)
+		}
+	}
+}
+
+func TestSplitLineNumber(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedNum  int
+		expectedLine string
+	}{
+		{
+			input:        "12:2023-03-12T07:24:13.733958Z 0 [Note] WSREP: Shifting CLOSED -> OPEN (TO: 0)",
+			expectedNum:  12,
+			expectedLine: "2023-03-12T07:24:13.733958Z 0 [Note] WSREP: Shifting CLOSED -> OPEN (TO: 0)",
+		},
+		{
+			input:        "2023-03-12T07:24:13.733958Z 0 [Note] WSREP: Shifting CLOSED -> OPEN (TO: 0)",
+			expectedNum:  0,
+			expectedLine: "2023-03-12T07:24:13.733958Z 0 [Note] WSREP: Shifting CLOSED -> OPEN (TO: 0)",
+		},
+	}
+
+	for _, test := range tests {
+		num, line := splitLineNumber(test.input)
+		if num != test.expectedNum || line != test.expectedLine {
+			t.Fatalf("with input %s, expected (%d, %s), got (%d, %s)", test.input, test.expectedNum, test.expectedLine, num, line)
+		}
+	}
+}
@@ -58,6 +58,7 @@ var ApplicativeMap = types.RegexMap{
 			c := types.Conflict{
 				InitiatedBy: []string{node},
 				Seqno:       seqno,
+				Date:        date,
 				VotePerNode: map[string]types.ConflictVote{node: types.ConflictVote{MD5: errormd5, Error: errorstring}},
 			}
 
@@ -9,13 +9,13 @@ import (
 	"github.com/pkg/errors"
 )
 
-var CustomMap = types.RegexMap{}
-
-func AddCustomRegexes(regexes map[string]string) error {
+// CustomRegexes builds regexes from --custom-regexes, in a new map
+func CustomRegexes(regexes map[string]string) (types.RegexMap, error) {
+	customs := types.RegexMap{}
 	for regexstring, output := range regexes {
 		r, err := regexp.Compile(regexstring)
 		if err != nil {
-			return errors.Wrap(err, "failed to add custom regex")
+			return nil, errors.Wrap(err, "failed to add custom regex")
 		}
 
 		lr := &types.LogRegex{Regex: r, Type: types.CustomRegexType}
@@ -24,7 +24,7 @@ func AddCustomRegexes(regexes map[string]string) error {
 			// capture and print everything that matched, instead of a static message
 			lr.InternalRegex, err = regexp.Compile("(?P<all>" + regexstring + ")")
 			if err != nil {
-				return errors.Wrap(err, "failed to add custom regex: failed to generate dynamic output")
+				return nil, errors.Wrap(err, "failed to add custom regex: failed to generate dynamic output")
 			}
 
 			lr.Handler = func(submatch map[string]string, ctx types.LogCtx, _ string, _ time.Time) (types.LogCtx, types.LogDisplayer) {
@@ -37,7 +37,7 @@ func AddCustomRegexes(regexes map[string]string) error {
 			}
 		}
 
-		CustomMap[regexstring] = lr
+		customs[regexstring] = lr
 	}
-	return nil
+	return customs, nil
 }
@@ -3,6 +3,7 @@ package regex
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
@@ -20,6 +21,7 @@ var DateLayouts = []string{
 	"2006-01-02T15:04:05.000000-07:00", // 5.7
 	"2006-01-02T15:04:05Z",             // found in some crashes
 	"060102 15:04:05",                  // 5.5
+	"060102  15:04:05",                 // MariaDB crash reports, same extra space as 10.3
 	"2006-01-02 15:04:05",              // 5.6
 	"2006-01-02  15:04:05",             // 10.3, yes the extra space is needed
 	"2006/01/02 15:04:05",              // sometimes found in socat errors
@@ -95,9 +97,7 @@ func NoDatesRegex(skipLeadingCircumflex bool) string {
 }
 
 func SearchDateFromLog(logline string) (time.Time, string, bool) {
-	if logline[:len(types.OperatorLogPrefix)] == types.OperatorLogPrefix {
-		logline = logline[len(types.OperatorLogPrefix):]
-	}
+	logline = strings.TrimPrefix(logline, types.OperatorLogPrefix)
 	for _, layout := range DateLayouts {
 		if len(logline) < len(layout) {
 			continue
@@ -13,22 +13,27 @@ func init() {
 	setType(types.EventsRegexType, EventsMap)
 }
 
+var (
+	// startingFunc is shared with flavor variants
+	startingFunc = func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
+		logCtx.Version = submatches[groupVersion]
+
+		msg := "starting(" + logCtx.Version
+		if isShutdownReasonMissing(logCtx) {
+			msg += ", " + utils.Paint(utils.YellowText, "could not catch how/when it stopped")
+		}
+		msg += ")"
+		logCtx.SetState("OPEN")
+
+		return logCtx, types.SimpleDisplayer(msg)
+	}
+)
+
 var EventsMap = types.RegexMap{
 	"RegexStarting": &types.LogRegex{
 		Regex:         regexp.MustCompile("starting as process"),
 		InternalRegex: regexp.MustCompile("\\(mysqld " + regexVersion + ".*\\)"),
-		Handler: func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
-			logCtx.Version = submatches[groupVersion]
-
-			msg := "starting(" + logCtx.Version
-			if isShutdownReasonMissing(logCtx) {
-				msg += ", " + utils.Paint(utils.YellowText, "could not catch how/when it stopped")
-			}
-			msg += ")"
-			logCtx.SetState("OPEN")
-
-			return logCtx, types.SimpleDisplayer(msg)
-		},
+		Handler:       startingFunc,
 	},
 	"RegexShutdownComplete": &types.LogRegex{
 		Regex: regexp.MustCompile("mysqld: Shutdown complete"),
@@ -93,6 +98,9 @@ var EventsMap = types.RegexMap{
 	"RegexWsrepRecovery": &types.LogRegex{
 		//  INFO: WSREP: Recovered position 00000000-0000-0000-0000-000000000000:-1
 		Regex: regexp.MustCompile("Recovered position"),
+
+		// the seqno is only used by the gcache report, -1 when unknown
+		InternalRegex: regexp.MustCompile("Recovered position(( from storage)?:? [a-z0-9-]+:(?P<" + groupSeqno + ">-?[0-9]+))?"),
 		Handler: func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
 
 			msg := "wsrep recovery"
@@ -0,0 +1,82 @@
+package regex
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
+)
+
+var regexMariaDBVersion = "(?P<" + groupVersion + ">(10|11)\\.[0-9]{1,2}\\.[0-9]{1,2})"
+
+// MariaDBMap holds variants of builtin regexes, used when logs are coming from MariaDB
+// Keys are the same as the builtin regexes they are replacing
+// Verbosity is inherited from the builtin regex, and so is Handler when left empty
+// so that variants only have to describe what changes in the log format
+var MariaDBMap = types.RegexMap{
+
+	// 2023-06-20  9:15:01 0 [Note] Starting MariaDB 10.11.6-MariaDB-1:10.11.6+maria~ubu2204 source revision fecd78b83785d5ae96f2c6ff340375be803cd299 as process 1
+	// 2023-01-01  1:01:01 0 [Note] /usr/sbin/mariadbd (server 10.6.12-MariaDB-log) starting as process 1 ...
+	// 2023-01-01  1:01:01 0 [Note] /usr/sbin/mysqld (mysqld 10.4.25-MariaDB-log) starting as process 2 ...
+	"RegexStarting": &types.LogRegex{
+		Regex:         regexp.MustCompile("starting as process|Starting MariaDB .* as process"),
+		InternalRegex: regexp.MustCompile("(\\((mysqld|mariadbd|server) |Starting MariaDB )" + regexMariaDBVersion),
+		Type:          types.EventsRegexType,
+	},
+	"RegexShutdownComplete": &types.LogRegex{
+		Regex: regexp.MustCompile("(mysqld|mariadbd): Shutdown complete"),
+		Type:  types.EventsRegexType,
+	},
+	"RegexTerminated": &types.LogRegex{
+		Regex: regexp.MustCompile("(mysqld|mariadbd): Terminated"),
+		Type:  types.EventsRegexType,
+	},
+	"RegexGotSignal6": &types.LogRegex{
+		Regex: regexp.MustCompile("(mysqld|mariadbd) got signal 6"),
+		Type:  types.EventsRegexType,
+	},
+	"RegexGotSignal11": &types.LogRegex{
+		Regex: regexp.MustCompile("(mysqld|mariadbd) got signal 11"),
+		Type:  types.EventsRegexType,
+	},
+
+	// 2023-06-20  9:16:09 0 [ERROR] WSREP_SST: [ERROR] mariabackup finished with error: 1.  Check /var/lib/mysql//mariabackup.backup.log (20230620 09:16:09.204)
+	"RegexMariabackupError": &types.LogRegex{
+		Regex:         regexp.MustCompile("mariabackup finished with error"),
+		InternalRegex: regexp.MustCompile("finished with error: (?P<code>[0-9]+)"),
+		Type:          types.SSTRegexType,
+		Handler: func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
+
+			return logCtx, types.SimpleDisplayer(utils.Paint(utils.RedText, "mariabackup error") + "(code:" + submatches["code"] + ")")
+		},
+	},
+}
+
+var flavorVariants = map[types.Flavor]types.RegexMap{
+	types.FlavorMariaDB: MariaDBMap,
+}
+
+// variantsFor resolves the variants of a flavor for the regexes in base, without modifying them
+// flavor-only regexes are added when their type is in base, like the builtin regexes of that type
+func variantsFor(flavor types.Flavor, base types.RegexMap) types.RegexMap {
+	selectedTypes := map[types.RegexType]bool{}
+	for _, regex := range base {
+		selectedTypes[regex.Type] = true
+	}
+
+	variants := types.RegexMap{}
+	for key, variant := range flavorVariants[flavor] {
+		resolved := *variant
+		if selected, ok := base[key]; ok {
+			if resolved.Handler == nil {
+				resolved.Handler = selected.Handler
+			}
+			resolved.Verbosity = selected.Verbosity
+		} else if !selectedTypes[variant.Type] {
+			continue
+		}
+		variants[key] = &resolved
+	}
+	return variants
+}
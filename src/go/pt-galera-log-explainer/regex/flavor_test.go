@@ -0,0 +1,82 @@
+package regex
+
+import (
+	"testing"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+)
+
+func TestMariaDBRegex(t *testing.T) {
+	tests := []regexTest{
+		{
+			name: "10.11.6-MariaDB",
+			log:  "2023-06-20  9:15:01 0 [Note] Starting MariaDB 10.11.6-MariaDB-1:10.11.6+maria~ubu2204 source revision fecd78b83785d5ae96f2c6ff340375be803cd299 as process 1",
+			expected: regexTestState{
+				LogCtx: types.LogCtx{Version: "10.11.6"},
+				State:  "OPEN",
+			},
+			expectedOut: "starting(10.11.6)",
+			key:         "RegexStarting",
+		},
+		{
+			name: "10.6.12-MariaDB-log",
+			log:  "2023-01-01  1:01:01 0 [Note] /usr/sbin/mariadbd (server 10.6.12-MariaDB-log) starting as process 1 ...",
+			expected: regexTestState{
+				LogCtx: types.LogCtx{Version: "10.6.12"},
+				State:  "OPEN",
+			},
+			expectedOut: "starting(10.6.12)",
+			key:         "RegexStarting",
+		},
+		{
+			name: "10.4.25-MariaDB-log",
+			log:  "2001-01-01  01:01:01 0 [Note] /usr/sbin/mysqld (mysqld 10.4.25-MariaDB-log) starting as process 2 ...",
+			expected: regexTestState{
+				LogCtx: types.LogCtx{Version: "10.4.25"},
+				State:  "OPEN",
+			},
+			expectedOut: "starting(10.4.25)",
+			key:         "RegexStarting",
+		},
+		{
+			log: "2023-06-20 10:41:56 0 [Note] /usr/sbin/mariadbd: Shutdown complete",
+			expected: regexTestState{
+				State: "CLOSED",
+			},
+			expectedOut: "shutdown complete",
+			key:         "RegexShutdownComplete",
+		},
+		{
+			log: "2023-06-20  9:16:09 0 [Note] WSREP: mariadbd: Terminated.",
+			expected: regexTestState{
+				State: "CLOSED",
+			},
+			expectedOut: "terminated",
+			key:         "RegexTerminated",
+		},
+		{
+			log: "230620 10:02:40 [ERROR] mariadbd got signal 11 ;",
+			expected: regexTestState{
+				State: "CLOSED",
+			},
+			expectedOut: "crash: got signal 11",
+			key:         "RegexGotSignal11",
+		},
+		{
+			name: "still matching mysqld",
+			log:  "230620  9:16:09 [ERROR] mysqld got signal 6 ;",
+			expected: regexTestState{
+				State: "CLOSED",
+			},
+			expectedOut: "crash: got signal 6",
+			key:         "RegexGotSignal6",
+		},
+		{
+			log:         "2023-06-20  9:16:09 0 [ERROR] WSREP_SST: [ERROR] mariabackup finished with error: 1.  Check /var/lib/mysql//mariabackup.backup.log (20230620 09:16:09.204)",
+			expectedOut: "mariabackup error(code:1)",
+			key:         "RegexMariabackupError",
+		},
+	}
+
+	iterateRegexTest(t, variantsFor(types.FlavorMariaDB, AllRegexes()), tests)
+}
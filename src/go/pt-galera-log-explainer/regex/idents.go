@@ -5,7 +5,6 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
 )
@@ -58,7 +57,7 @@ var IdentsMap = types.RegexMap{
 			if len(nodename) == 31 {
 				return logCtx, nil
 			}
-			translate.AddHashToNodeName(hash, nodename, date)
+			logCtx.DB().AddHashToNodeName(hash, nodename, date)
 
 			if logCtx.MyIdx == idx && (logCtx.IsPrimary() || logCtx.MemberCount == 1) {
 				logCtx.AddOwnHash(hash, date)
@@ -1,12 +1,12 @@
 package regex
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 )
 
@@ -25,18 +25,76 @@ func setType(t types.RegexType, regexes types.RegexMap) {
 	return
 }
 
-// SetVerbosity accepts any LogRegex
+// WithVerbosity returns copies of regexes using another verbosity
 // Some can be useful to construct context, but we can choose not to display them
-func SetVerbosity(verbosity types.Verbosity, regexes types.RegexMap) {
-	for _, regex := range regexes {
-		regex.Verbosity = verbosity
+func WithVerbosity(verbosity types.Verbosity, regexes types.RegexMap) types.RegexMap {
+	copies := types.RegexMap{}
+	for key, regex := range regexes {
+		c := *regex
+		c.Verbosity = verbosity
+		copies[key] = &c
 	}
-	return
+	return copies
 }
 
+// AllRegexes returns every builtin regexes in a new map, so that builtin maps can be read concurrently
 func AllRegexes() types.RegexMap {
-	IdentsMap.Merge(ViewsMap).Merge(SSTMap).Merge(EventsMap).Merge(StatesMap).Merge(ApplicativeMap).Merge(CustomMap)
-	return IdentsMap
+	return types.RegexMap{}.Merge(IdentsMap).Merge(ViewsMap).Merge(SSTMap).Merge(EventsMap).Merge(StatesMap).Merge(ApplicativeMap)
+}
+
+// Resolve builds the regexes of a single analysis from a selection of builtin regexes, every builtin regexes when nil
+// Flavor variants replace the selected regexes they are written for, custom regexes are always added,
+// and rules are added when their type was selected
+// Every regexes are copied, so that neither builtin maps nor other analyses are affected
+func Resolve(selection types.RegexMap, flavor types.Flavor, customRegexes map[string]string, rules []Rule) (types.RegexMap, error) {
+	if selection == nil {
+		selection = AllRegexes()
+	}
+
+	resolved := types.RegexMap{}
+	for key, regex := range selection {
+		c := *regex
+		resolved[key] = &c
+	}
+	resolved.Merge(variantsFor(flavor, resolved))
+
+	customs, err := CustomRegexes(customRegexes)
+	if err != nil {
+		return nil, err
+	}
+	resolved.Merge(customs)
+
+	// rules follow the verbosity of their type, as some are selected only to build contexts
+	verbosities := map[types.RegexType]types.Verbosity{}
+	for _, regex := range selection {
+		if v, ok := verbosities[regex.Type]; !ok || regex.Verbosity < v {
+			verbosities[regex.Type] = regex.Verbosity
+		}
+	}
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if names[rule.Name] {
+			return nil, errors.Errorf("rule %s: name already used by another rule", rule.Name)
+		}
+		names[rule.Name] = true
+
+		lr, err := rule.LogRegex()
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %s", rule.Name)
+		}
+		verbosity, selected := verbosities[lr.Type]
+		if !selected && lr.Type != types.CustomRegexType {
+			continue
+		}
+		if _, ok := resolved[rule.Name]; ok {
+			return nil, errors.Errorf("rule %s: name already used by another regex", rule.Name)
+		}
+		if verbosity > lr.Verbosity {
+			lr.Verbosity = verbosity
+		}
+		resolved[rule.Name] = lr
+	}
+	return resolved, nil
 }
 
 // general building block wsrep regexes
@@ -0,0 +1,204 @@
+package regex
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Rule describes a regex coming from a user rules file
+//
+//	rules:
+//	  - name: RegexMyPluginCrash
+//	    regex: "myplugin: crashed"
+//	    internalRegex: "myplugin: crashed with code (?P<code>[0-9]+)"
+//	    type: events
+//	    verbosity: info
+//	    message: "myplugin crashed, code {{.code}}"
+//	    color: red
+//	    state: ERROR
+//	    desynced: false
+type Rule struct {
+	Name          string `yaml:"name"`
+	Regex         string `yaml:"regex"`         // sent to grep
+	InternalRegex string `yaml:"internalRegex"` // optional, named captures can be used in the message
+	Type          string `yaml:"type"`          // which group of regexes it belongs to, custom by default
+	Verbosity     string `yaml:"verbosity"`     // info, debugmysql or debug. info by default
+	Message       string `yaml:"message"`       // text/template using captures. Prints the matched text when empty
+	Color         string `yaml:"color"`         // magenta by default, as every custom regexes
+	State         string `yaml:"state"`         // optional wsrep state to set
+	Desynced      *bool  `yaml:"desynced"`      // optional, to mark the node as desynced or resynced
+}
+
+type RulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+var ruleColors = map[string]utils.Color{
+	"red":     utils.RedText,
+	"green":   utils.GreenText,
+	"yellow":  utils.YellowText,
+	"blue":    utils.BlueText,
+	"magenta": utils.MagentaText,
+	"cyan":    utils.CyanText,
+	"white":   utils.WhiteText,
+}
+
+var ruleVerbosities = map[string]types.Verbosity{
+	"info":       types.Info,
+	"debugmysql": types.DebugMySQL,
+	"debug":      types.Debug,
+}
+
+// regexTypes lists the types a rule can use, so that it is selected along with the
+// builtin regexes of its type
+var regexTypes = map[types.RegexType]bool{
+	types.EventsRegexType:      true,
+	types.SSTRegexType:         true,
+	types.ViewsRegexType:       true,
+	types.IdentRegexType:       true,
+	types.StatesRegexType:      true,
+	types.PXCOperatorRegexType: true,
+	types.ApplicativeRegexType: true,
+	types.CustomRegexType:      true,
+}
+
+// RulesFromFiles reads and validates rules files
+// They are only added to regexes when resolving them for an analysis, see Resolve
+func RulesFromFiles(paths []string) ([]Rule, error) {
+	rules := []Rule{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open rules file")
+		}
+		fileRules, err := ReadRules(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load rules from %s", path)
+		}
+		rules = append(rules, fileRules...)
+	}
+	return rules, nil
+}
+
+func ReadRules(r io.Reader) ([]Rule, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	rulesFile := RulesFile{}
+	err = yaml.UnmarshalStrict(content, &rulesFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid yaml")
+	}
+
+	for _, rule := range rulesFile.Rules {
+		if _, err := rule.LogRegex(); err != nil {
+			return nil, errors.Wrapf(err, "rule %s", rule.Name)
+		}
+	}
+	return rulesFile.Rules, nil
+}
+
+// LogRegex validates the rule and builds the equivalent of a builtin regex
+func (rule Rule) LogRegex() (*types.LogRegex, error) {
+	if rule.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if rule.Regex == "" {
+		return nil, errors.New("regex is required")
+	}
+
+	r, err := regexp.Compile(rule.Regex)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid regex")
+	}
+	lr := &types.LogRegex{Regex: r, Type: types.CustomRegexType}
+
+	if rule.Type != "" {
+		lr.Type = types.RegexType(rule.Type)
+		if !regexTypes[lr.Type] {
+			return nil, errors.Errorf("unknown type %s", rule.Type)
+		}
+	}
+
+	if rule.Verbosity != "" {
+		verbosity, ok := ruleVerbosities[strings.ToLower(rule.Verbosity)]
+		if !ok {
+			return nil, errors.Errorf("unknown verbosity %s, expected info, debugmysql or debug", rule.Verbosity)
+		}
+		lr.Verbosity = verbosity
+	}
+
+	var color utils.Color = utils.MagentaText
+	if rule.Color != "" {
+		var ok bool
+		color, ok = ruleColors[strings.ToLower(rule.Color)]
+		if !ok {
+			return nil, errors.Errorf("unknown color %s", rule.Color)
+		}
+	}
+
+	if rule.State != "" {
+		// SetState ignores unknown states, it is used to validate it
+		logCtx := types.NewLogCtx()
+		logCtx.SetState(rule.State)
+		if logCtx.State() != rule.State {
+			return nil, errors.Errorf("unknown state %s", rule.State)
+		}
+	}
+
+	internalRegex := rule.InternalRegex
+	if internalRegex == "" && rule.Message == "" {
+		// capture and print everything that matched, instead of a static message
+		internalRegex = "(?P<all>" + rule.Regex + ")"
+	}
+	if internalRegex != "" {
+		lr.InternalRegex, err = regexp.Compile(internalRegex)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid internalRegex")
+		}
+	}
+
+	var tmpl *template.Template
+	if rule.Message != "" {
+		tmpl, err = template.New(rule.Name).Option("missingkey=error").Parse(rule.Message)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid message template")
+		}
+	}
+
+	lr.Handler = func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
+		if rule.State != "" {
+			logCtx.SetState(rule.State)
+		}
+		if rule.Desynced != nil {
+			logCtx.Desynced = *rule.Desynced
+		}
+
+		msg := submatches["all"]
+		if msg == "" && tmpl == nil {
+			// internalRegex without message: print what it matched
+			msg = lr.InternalRegex.FindString(log)
+		}
+		if tmpl != nil {
+			buf := &bytes.Buffer{}
+			if err := tmpl.Execute(buf, submatches); err != nil {
+				return logCtx, types.SimpleDisplayer(utils.Paint(utils.RedText, "rule "+rule.Name+" failed: "+err.Error()))
+			}
+			msg = buf.String()
+		}
+		return logCtx, types.SimpleDisplayer(utils.Paint(color, msg))
+	}
+	return lr, nil
+}
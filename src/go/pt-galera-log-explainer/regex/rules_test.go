@@ -0,0 +1,180 @@
+package regex
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+)
+
+func TestRulesRegex(t *testing.T) {
+	desynced := true
+	rules := []Rule{
+		{
+			Name:          "RegexPluginCrash",
+			Regex:         "myplugin: crashed",
+			InternalRegex: "myplugin: crashed with code (?P<code>[0-9]+)",
+			Message:       "myplugin crashed, code {{.code}}",
+			State:         "ERROR",
+		},
+		{
+			Name:     "RegexPluginPause",
+			Regex:    "myplugin: pausing replication",
+			Message:  "myplugin paused replication",
+			Desynced: &desynced,
+		},
+		{
+			Name:  "RegexPluginAny",
+			Regex: "myplugin: [a-z]+ done",
+		},
+		{
+			Name:          "RegexPluginRestart",
+			Regex:         "myplugin: restarting",
+			InternalRegex: "restarting after (?P<seconds>[0-9]+)s",
+		},
+	}
+
+	regexes := types.RegexMap{}
+	for _, rule := range rules {
+		lr, err := rule.LogRegex()
+		if err != nil {
+			t.Fatalf("rule %s: %v", rule.Name, err)
+		}
+		regexes[rule.Name] = lr
+	}
+
+	tests := []regexTest{
+		{
+			log:         "2001-01-01T01:01:01.000000Z 0 [ERROR] myplugin: crashed with code 12",
+			expected:    regexTestState{State: "ERROR"},
+			expectedOut: "myplugin crashed, code 12",
+			key:         "RegexPluginCrash",
+		},
+		{
+			log:         "2001-01-01T01:01:01.000000Z 0 [Note] myplugin: pausing replication",
+			expected:    regexTestState{LogCtx: types.LogCtx{Desynced: true}},
+			expectedOut: "myplugin paused replication",
+			key:         "RegexPluginPause",
+		},
+		{
+			log:         "2001-01-01T01:01:01.000000Z 0 [Note] myplugin: cleanup done",
+			expectedOut: "myplugin: cleanup done",
+			key:         "RegexPluginAny",
+		},
+		{
+			log:         "2001-01-01T01:01:01.000000Z 0 [Note] myplugin: restarting after 5s",
+			expectedOut: "restarting after 5s",
+			key:         "RegexPluginRestart",
+		},
+	}
+
+	iterateRegexTest(t, regexes, tests)
+}
+
+func TestRuleLogRegexErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "missing name", rule: Rule{Regex: "a"}},
+		{name: "missing regex", rule: Rule{Name: "a"}},
+		{name: "invalid regex", rule: Rule{Name: "a", Regex: "("}},
+		{name: "unknown type", rule: Rule{Name: "a", Regex: "a", Type: "unknown"}},
+		{name: "unknown verbosity", rule: Rule{Name: "a", Regex: "a", Verbosity: "loud"}},
+		{name: "unknown color", rule: Rule{Name: "a", Regex: "a", Color: "pink"}},
+		{name: "unknown state", rule: Rule{Name: "a", Regex: "a", State: "SLEEPING"}},
+		{name: "invalid template", rule: Rule{Name: "a", Regex: "a", Message: "{{.a"}},
+	}
+
+	for _, test := range tests {
+		if _, err := test.rule.LogRegex(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestReadRules(t *testing.T) {
+	rules := `
+rules:
+  - name: RegexTestRulePluginSST
+    regex: "myplugin: sending snapshot"
+    type: sst
+    verbosity: debugmysql
+`
+	parsed, err := ReadRules(strings.NewReader(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 1 || parsed[0].Name != "RegexTestRulePluginSST" {
+		t.Fatalf("unexpected rules: %v", parsed)
+	}
+	if _, ok := SSTMap["RegexTestRulePluginSST"]; ok {
+		t.Fatal("reading rules should not modify builtin regexes")
+	}
+
+	if _, err := ReadRules(strings.NewReader("rules:\n  - name: a\n    regexp: typo\n")); err == nil {
+		t.Error("expected an error on unknown field")
+	}
+	if _, err := ReadRules(strings.NewReader("rules:\n  - name: a\n    regex: a\n    type: unknown\n")); err == nil {
+		t.Error("expected an error on invalid rule")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	rules := []Rule{
+		{Name: "RegexTestRuleSST", Regex: "myplugin: sending snapshot", Type: "sst"},
+		{Name: "RegexTestRuleEvents", Regex: "myplugin: started", Type: "events"},
+		{Name: "RegexTestRuleCustom", Regex: "myplugin: done"},
+	}
+	selection := types.RegexMap{}.Merge(SSTMap).Merge(WithVerbosity(types.DebugMySQL, EventsMap))
+
+	resolved, err := Resolve(selection, types.FlavorMariaDB, map[string]string{"custom": ""}, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"RegexTestRuleSST", "RegexTestRuleEvents", "RegexTestRuleCustom", "custom"} {
+		if _, ok := resolved[key]; !ok {
+			t.Errorf("%s should have been resolved", key)
+		}
+	}
+	if resolved["RegexTestRuleEvents"].Verbosity != types.DebugMySQL {
+		t.Errorf("rules should follow the verbosity of their type, got %d", resolved["RegexTestRuleEvents"].Verbosity)
+	}
+	if resolved["RegexShutdownComplete"].Regex.String() != MariaDBMap["RegexShutdownComplete"].Regex.String() {
+		t.Error("flavor variants should replace selected regexes")
+	}
+	if resolved["RegexShutdownComplete"].Verbosity != types.DebugMySQL {
+		t.Error("flavor variants should keep the verbosity of the selection")
+	}
+	if _, ok := resolved["RegexStarting"]; !ok {
+		t.Error("RegexStarting should be selected")
+	}
+
+	for key, lr := range resolved {
+		if lr == SSTMap[key] || lr == EventsMap[key] {
+			t.Errorf("%s should be a copy of the builtin regex", key)
+		}
+	}
+	if EventsMap["RegexShutdownComplete"].Regex.String() == MariaDBMap["RegexShutdownComplete"].Regex.String() || EventsMap["RegexShutdownComplete"].Verbosity != types.Info {
+		t.Error("builtin regexes should be untouched")
+	}
+
+	resolved, err = Resolve(types.RegexMap{}.Merge(IdentsMap), types.FlavorPXC, nil, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resolved["RegexTestRuleSST"]; ok {
+		t.Error("rules should not be added when their type is not selected")
+	}
+	if _, ok := resolved["RegexTestRuleCustom"]; !ok {
+		t.Error("custom rules should always be added")
+	}
+
+	if _, err := Resolve(nil, types.FlavorPXC, nil, append(rules, rules[0])); err == nil {
+		t.Error("expected an error when adding the same rule twice")
+	}
+	if _, err := Resolve(nil, types.FlavorPXC, nil, []Rule{{Name: "RegexShift", Regex: "a", Type: "states"}}); err == nil {
+		t.Error("expected an error when a rule uses the name of a builtin regex")
+	}
+}
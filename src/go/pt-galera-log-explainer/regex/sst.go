@@ -190,7 +190,7 @@ var SSTMap = types.RegexMap{
 		Regex: regexp.MustCompile("IST sender starting"),
 
 		// TODO: sometimes, it's a hostname here
-		InternalRegex: regexp.MustCompile("IST sender starting to serve " + regexNodeIPMethod + " sending [0-9]+-" + regexSeqno),
+		InternalRegex: regexp.MustCompile("IST sender starting to serve " + regexNodeIPMethod + " sending (?P<startingseqno>[0-9]+)-" + regexSeqno),
 		Handler: func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
 			logCtx.SetState("DONOR")
 			logCtx.SetSSTTypeMaybe("IST")
@@ -233,6 +233,9 @@ var SSTMap = types.RegexMap{
 
 	"RegexFailedToPrepareIST": &types.LogRegex{
 		Regex: regexp.MustCompile("Failed to prepare for incremental state transfer"),
+
+		// operator logs are json, the reason stops before the escaped newline
+		InternalRegex: regexp.MustCompile("Failed to prepare for incremental state transfer(: (?P<reason>[^\"\\\\]+))?"),
 		Handler: func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
 			logCtx.SetSSTTypeMaybe("SST")
 			return logCtx, types.SimpleDisplayer("IST is not applicable")
@@ -286,6 +289,37 @@ var SSTMap = types.RegexMap{
 		},
 	},
 
+	// logged undated, after "State transfer required:" and "Group state:"
+	//	Local state: 9db0bcdf-b31a-11ed-a398-2a4cfdd82049:170407336
+	"RegexLocalState": &types.LogRegex{
+		Regex:         regexp.MustCompile("Local state: "),
+		InternalRegex: regexp.MustCompile("Local state: " + regexUUID + ":(?P<" + groupSeqno + ">-?[0-9]+)"),
+		Handler: func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
+			return logCtx, types.SimpleDisplayer("local state(seqno:" + submatches[groupSeqno] + ")")
+		},
+		Verbosity: types.DebugMySQL,
+	},
+
+	// 2023-03-18T21:18:19.270318+02:00 0 [Note] [MY-000000] [Galera] Recovering GCache ring buffer: found gapless sequence 20123204-23109522
+	"RegexGcacheRecovered": &types.LogRegex{
+		Regex:         regexp.MustCompile("found gapless sequence"),
+		InternalRegex: regexp.MustCompile("found gapless sequence (?P<startingseqno>-?[0-9]+)-(?P<" + groupSeqno + ">-?[0-9]+)"),
+		Handler: func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
+			return logCtx, types.SimpleDisplayer("gcache recovered(seqnos:" + submatches["startingseqno"] + "-" + submatches[groupSeqno] + ")")
+		},
+		Verbosity: types.DebugMySQL,
+	},
+
+	// it is part of the "Passing config to GCS" line
+	"RegexGcacheSize": &types.LogRegex{
+		Regex:         regexp.MustCompile("gcache\\.size = "),
+		InternalRegex: regexp.MustCompile("gcache\\.size = (?P<size>[0-9]+[a-zA-Z]?)"),
+		Handler: func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
+			return logCtx, types.SimpleDisplayer("gcache.size=" + submatches["size"])
+		},
+		Verbosity: types.DebugMySQL,
+	},
+
 	"RegexISTFailed": &types.LogRegex{
 		Regex:         regexp.MustCompile("async IST sender failed to serve"),
 		InternalRegex: regexp.MustCompile("IST sender failed to serve " + regexNodeIPMethod + ":.*asio error '.*: [0-9]+ \\((?P<error>[\\w\\s]+)\\)"),
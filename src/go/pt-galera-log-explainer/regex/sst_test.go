@@ -476,6 +476,29 @@ func TestSSTRegex(t *testing.T) {
 			expectedOut: "IST to 172.17.0.2 failed: Protocol error",
 			key:         "RegexISTFailed",
 		},
+
+		{
+			log:         "	Local state: 9db0bcdf-b31a-11ed-a398-2a4cfdd82049:170407336",
+			expectedOut: "local state(seqno:170407336)",
+			key:         "RegexLocalState",
+		},
+		{
+			log:         "	Local state: 00000000-0000-0000-0000-000000000000:-1",
+			expectedOut: "local state(seqno:-1)",
+			key:         "RegexLocalState",
+		},
+
+		{
+			log:         "2023-03-18T21:18:19.270318+02:00 0 [Note] [MY-000000] [Galera] Recovering GCache ring buffer: found gapless sequence 20123204-23109522",
+			expectedOut: "gcache recovered(seqnos:20123204-23109522)",
+			key:         "RegexGcacheRecovered",
+		},
+
+		{
+			log:         "2001-01-01T01:01:01.000000Z 0 [Note] [MY-000000] [Galera] Passing config to GCS: base_dir = /var/lib/mysql/; base_host = 127.0.0.1; gcache.page_size = 128M; gcache.recover = yes; gcache.size = 128M; gcomm.thread_prio = ;",
+			expectedOut: "gcache.size=128M",
+			key:         "RegexGcacheSize",
+		},
 	}
 
 	iterateRegexTest(t, SSTMap, tests)
@@ -26,7 +26,8 @@ var (
 
 		return logCtx, types.SimpleDisplayer(log)
 	}
-	shiftRegex = regexp.MustCompile("(?P<state1>[A-Z]+) -> (?P<state2>[A-Z]+)")
+	// the seqno is only logged when shifting, it is used by the gcache report
+	shiftRegex = regexp.MustCompile("(?P<state1>[A-Z]+) -> (?P<state2>[A-Z]+)(/[A-Z]+)?( \\(TO: " + regexSeqno + "\\))?")
 )
 
 var StatesMap = types.RegexMap{
@@ -6,7 +6,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
 )
@@ -24,7 +23,7 @@ var ViewsMap = types.RegexMap{
 
 			ip := submatches[groupNodeIP]
 			hash := submatches[groupNodeHash]
-			translate.AddHashToIP(hash, ip, date)
+			logCtx.DB().AddHashToIP(hash, ip, date)
 			if utils.SliceContains(logCtx.OwnIPs, ip) {
 				return logCtx, nil
 			}
@@ -40,8 +39,8 @@ var ViewsMap = types.RegexMap{
 
 			ip := submatches[groupNodeIP]
 			hash := submatches[groupNodeHash]
-			translate.AddHashToIP(hash, ip, date)
-			translate.AddIPToMethod(ip, submatches[groupMethod], date)
+			logCtx.DB().AddHashToIP(hash, ip, date)
+			logCtx.DB().AddIPToMethod(ip, submatches[groupMethod], date)
 			return logCtx, types.FormatByHashDisplayer("%s"+utils.Paint(utils.GreenText, " joined"), hash, date)
 		},
 	},
@@ -53,12 +52,21 @@ var ViewsMap = types.RegexMap{
 
 			ip := submatches[groupNodeIP]
 			hash := submatches[groupNodeHash]
-			translate.AddHashToIP(hash, ip, date)
-			translate.AddIPToMethod(ip, submatches[groupMethod], date)
+			logCtx.DB().AddHashToIP(hash, ip, date)
+			logCtx.DB().AddIPToMethod(ip, submatches[groupMethod], date)
 			return logCtx, types.FormatByHashDisplayer("%s"+utils.Paint(utils.RedText, " left"), hash, date)
 		},
 	},
 
+	// the node itself left the group, on shutdown or when it gives up joining
+	"RegexSelfLeave": &types.LogRegex{
+		Regex: regexp.MustCompile("Received SELF-LEAVE"),
+		Handler: func(submatches map[string]string, logCtx types.LogCtx, log string, date time.Time) (types.LogCtx, types.LogDisplayer) {
+			return logCtx, types.SimpleDisplayer(utils.Paint(utils.YellowText, "left the group"))
+		},
+		Verbosity: types.DebugMySQL,
+	},
+
 	// New COMPONENT: primary = yes, bootstrap = no, my_idx = 1, memb_num = 5
 	"RegexNewComponent": &types.LogRegex{
 		Regex:         regexp.MustCompile("New COMPONENT:"),
@@ -110,8 +118,8 @@ var ViewsMap = types.RegexMap{
 
 			hash := utils.UUIDToShortUUID(submatches[groupNodeHash])
 			hash2 := utils.UUIDToShortUUID(submatches[groupNodeHash+"2"])
-			if ip := translate.GetIPFromHash(hash); ip != "" {
-				translate.AddHashToIP(hash2, ip, date)
+			if ip := logCtx.DB().GetIPFromHash(hash); ip != "" {
+				logCtx.DB().AddHashToIP(hash2, ip, date)
 			}
 			return logCtx, types.FormatByHashDisplayer("%s"+utils.Paint(utils.YellowText, " changed identity"), hash, date)
 		},
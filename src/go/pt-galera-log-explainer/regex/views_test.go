@@ -74,6 +74,12 @@ func TestViewsRegex(t *testing.T) {
 			key:         "RegexNodeLeft",
 		},
 
+		{
+			log:         "2001-01-01T01:01:01.000000Z 0 [Note] [MY-000000] [Galera] Received SELF-LEAVE. Closing connection.",
+			expectedOut: "left the group",
+			key:         "RegexSelfLeave",
+		},
+
 		{
 			log: "2001-01-01T01:01:01.000000Z 0 [Note] WSREP: New COMPONENT: primary = yes, bootstrap = no, my_idx = 0, memb_num = 2",
 			expected: regexTestState{
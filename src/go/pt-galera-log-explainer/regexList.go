@@ -17,8 +17,10 @@ func (l *regexList) Help() string {
 
 func (l *regexList) Run() error {
 
-	allregexes := regex.AllRegexes()
-	allregexes.Merge(regex.PXCOperatorMap)
+	allregexes, err := regex.Resolve(regex.AllRegexes().Merge(regex.PXCOperatorMap), CLI.Flavor, CLI.CustomRegexes, customRules)
+	if err != nil {
+		return errors.Wrap(err, "could not list regexes")
+	}
 
 	out, err := json.Marshal(&allregexes)
 	if err != nil {
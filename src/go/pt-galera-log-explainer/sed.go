@@ -1,102 +1,201 @@
 package main
 
-/*
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
 type sed struct {
-	Paths []string `arg:"" name:"paths" help:"paths of the log to use"`
-	ByIP  bool     `help:"Replace by IP instead of name"`
+	Paths  []string `arg:"" name:"paths" help:"paths of the log to use"`
+	ByIP   bool     `help:"Replace by IP instead of name"`
+	Input  string   `help:"Log to translate. Reads stdin when not set" type:"existingfile"`
+	Script bool     `help:"Print a sed command to review and apply yourself, instead of translating a log"`
 }
 
 func (s *sed) Help() string {
 
-	return fmt.Sprintf(`sed translates a log, replacing node UUID, IPS, names with either name or IP everywhere. By default it replaces by name.
+	return fmt.Sprintf(`sed translates a log, replacing node UUIDs and IPs with either name or IP everywhere. By default it replaces by name.
+
+Every given log is read first to know about nodes identities, then the log to translate is streamed line by line:
+each identifier is replaced by the value that was valid at the timestamp of the line.
 
 Use like so:
 	cat node1.log | %[1]s sed *.log | less
 	%[1]s sed *.log < node1.log | less
+	%[1]s sed --input node1.log *.log | less
 
-You can also simply call the command to get a generated sed command to review and apply yourself
-	%[1]s sed *.log`, toolname)
+You can also get a generated sed command to review and apply yourself
+	%[1]s sed --script *.log
+Because a sed command cannot know about timestamps, it will only use the latest known value of each identifier`, toolname)
 }
 
+// sedIdentifierRegex finds what can be translated: full UUIDs, short UUIDs as printed by gcomm, legacy 8 characters UUIDs, and IPs
+// Longer forms have to come first so that a shorter form is not matched at the start of it
+// Legacy UUIDs cannot be distinguished from any other word, they will only be replaced when known
+var sedIdentifierRegex = regexp.MustCompile(`\b(?:[a-z0-9]{8}-[a-z0-9]{4}-[a-z0-9]{4}-[a-z0-9]{4}-[a-z0-9]{12}|[a-z0-9]{8}-[a-z0-9]{4}|[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}|[a-z0-9]{8})\b`)
+
 func (s *sed) Run() error {
-	toCheck := regex.AllRegexes()
-	timeline, err := timelineFromPaths(s.Paths, toCheck)
+	timeline, err := timelineFromPaths(s.Paths, regex.AllRegexes())
 	if err != nil {
 		return errors.Wrap(err, "found nothing worth replacing")
 	}
-	ctxs := timeline.GetLatestContextsByNodes()
+	db := timeline.DB()
 
-	args := []string{}
-	for key, ctx := range ctxs {
-
-		tosearchs := []string{key}
-		tosearchs = append(tosearchs, ctx.OwnHashes...)
-		tosearchs = append(tosearchs, ctx.OwnIPs...)
-		tosearchs = append(tosearchs, ctx.OwnNames...)
-		for _, tosearch := range tosearchs {
-			ni := whoIs(ctxs, tosearch)
-
-			fmt.Println(ni)
-			switch {
-			case CLI.Sed.ByIP:
-				args = append(args, sedByIP(ni)...)
-			default:
-				args = append(args, sedByName(ni)...)
-			}
-		}
-
-	}
-	if len(args) == 0 {
-		return errors.New("could not find information to replace")
+	if s.Script {
+		return sedScript(os.Stdout, db, s.ByIP)
 	}
 
-	fstat, err := os.Stdin.Stat()
-	if err != nil {
-		return err
-	}
-	if fstat.Size() == 0 {
-		fmt.Println("No files found in stdin, returning the sed command instead:")
-		fmt.Println("sed", strings.Join(args, " "))
-		return nil
+	in := os.Stdin
+	var clock *types.FileClock
+	if s.Input != "" {
+		clock, err = inputClock(timeline, s.Input)
+		if err != nil {
+			return err
+		}
+		in, err = os.Open(s.Input)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+	} else {
+		fstat, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		if fstat.Mode()&os.ModeCharDevice != 0 {
+			log.Info().Msg("nothing found in stdin, returning the sed command instead")
+			return sedScript(os.Stdout, db, s.ByIP)
+		}
 	}
 
-	cmd := exec.Command("sed", args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Start()
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	return sedStream(in, out, db, clock, s.ByIP)
+}
+
+// inputClock returns how dates of the log to translate are adjusted
+// it is the clock used in the timeline when the input was also searched, else the one from --time-offsets
+func inputClock(timeline types.Timeline, input string) (*types.FileClock, error) {
+	for _, localTimeline := range timeline {
+		for _, li := range localTimeline {
+			if li.LogCtx.FilePath == input {
+				return li.LogCtx.Clock, nil
+			}
+		}
+	}
+	clocks, err := parseTimeOffsets([]string{input}, CLI.TimeOffsets)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return cmd.Wait()
+	return clocks[input], nil
 }
 
-func sedByName(ni types.NodeInfo) []string {
-	if len(ni.NodeNames) == 0 {
-		return nil
+// sedStream translates every line from r to w
+// lines without any date will use the latest date seen, adjusted with clock which can be nil
+func sedStream(r io.Reader, w io.Writer, db *translate.DB, clock *types.FileClock, byIP bool) error {
+	reader := bufio.NewReader(r)
+	var date time.Time
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if t, layout, ok := regex.SearchDateFromLog(line); ok {
+				date = clock.Adjust(t, layout)
+			}
+			if _, err := io.WriteString(w, sedLine(line, date, db, byIP)); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
-	elem := ni.NodeNames[0]
-	args := sedSliceWith(ni.NodeUUIDs, elem)
-	args = append(args, sedSliceWith(ni.IPs, elem)...)
-	return args
 }
 
-func sedByIP(ni types.NodeInfo) []string {
-	if len(ni.IPs) == 0 {
-		return nil
-	}
-	elem := ni.IPs[0]
-	args := sedSliceWith(ni.NodeUUIDs, elem)
-	args = append(args, sedSliceWith(ni.NodeNames, elem)...)
-	return args
+// sedLine replaces identifiers known in the translation maps, using what was valid at the given date
+// unknown identifiers are kept as is
+func sedLine(line string, date time.Time, db *translate.DB, byIP bool) string {
+	return sedIdentifierRegex.ReplaceAllStringFunc(line, func(match string) string {
+		if regex.IsNodeIP(match) {
+			if byIP {
+				return match
+			}
+			return db.SimplestInfoFromIP(match, date)
+		}
+
+		hash := utils.UUIDToShortUUID(match)
+		if !db.IsNodeUUIDKnown(hash) {
+			return match
+		}
+		if byIP {
+			if ip := db.GetIPFromHashAt(hash, date); ip != "" {
+				return ip
+			}
+			return match
+		}
+		if info := db.SimplestInfoFromHash(hash, date); info != hash {
+			return info
+		}
+		return match
+	})
 }
 
-func sedSliceWith(elems []string, replace string) []string {
+// sedScript prints a sed command using the latest value known for each identifier
+func sedScript(w io.Writer, db *translate.DB, byIP bool) error {
+	latest := time.Now()
 	args := []string{}
-	for _, elem := range elems {
-		args = append(args, "-e")
-		args = append(args, "s/"+elem+"/"+replace+"/g")
+
+	for _, hash := range db.KnownHashes() {
+		var replace string
+		if byIP {
+			replace = db.GetIPFromHashAt(hash, latest)
+		} else {
+			replace = db.SimplestInfoFromHash(hash, latest)
+		}
+		if replace == "" || replace == hash {
+			continue
+		}
+
+		// full UUIDs are stored using their short version, the 2nd and 3rd parts have to be guessed
+		if split := strings.Split(hash, "-"); len(split) == 2 {
+			args = append(args, sedExpression(split[0]+"-[a-z0-9]{4}-[a-z0-9]{4}-"+split[1]+"-[a-z0-9]{12}", replace))
+		}
+		args = append(args, sedExpression(hash, replace))
+	}
+
+	if !byIP {
+		for _, ip := range db.KnownIPs() {
+			replace := db.SimplestInfoFromIP(ip, latest)
+			if replace == ip {
+				continue
+			}
+			args = append(args, sedExpression(strings.ReplaceAll(ip, ".", "\\."), replace))
+		}
+	}
+
+	if len(args) == 0 {
+		return errors.New("could not find information to replace")
 	}
-	return args
+
+	_, err := fmt.Fprintf(w, "sed -E \\\n\t%s\n", strings.Join(args, " \\\n\t"))
+	return err
+}
+
+func sedExpression(search, replace string) string {
+	replace = strings.NewReplacer(`\`, `\\`, `/`, `\/`, `&`, `\&`, `'`, `'\''`).Replace(replace)
+	return "-e 's/\\b" + search + "\\b/" + replace + "/g'"
 }
-*/
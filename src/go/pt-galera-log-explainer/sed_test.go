@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+)
+
+func TestSedStream(t *testing.T) {
+	db := translate.NewDB()
+
+	before := time.Date(2023, 3, 12, 7, 0, 0, 0, time.UTC)
+	after := time.Date(2023, 3, 12, 8, 0, 0, 0, time.UTC)
+	db.AddHashToIP("ed97c863-8ab7", "172.17.0.3", before)
+	db.AddHashToNodeName("ed97c863-8ab7", "node2", before)
+	db.AddIPToNodeName("172.17.0.3", "node2", before)
+	db.AddIPToNodeName("172.17.0.3", "node2-renamed", after)
+
+	input := strings.Join([]string{
+		"2023-03-12T07:30:00.000000Z 0 [Note] [MY-000000] [Galera] declaring ed97c863-8ab7 at ssl://172.17.0.3:4567 stable",
+		"2023-03-12T07:30:01.000000Z 0 [Note] [MY-000000] [Galera] My UUID: ed97c863-d5c9-11ec-8ab7-671bbd2d70ef",
+		"no date here, 172.17.0.3 unknown 172.17.0.9 and cluster 0b3e2cd3-d5c9-11ec-8ab7-671bbd2d70ef",
+		"2023-03-12T08:30:00.000000Z 0 [Note] [MY-000000] [Galera] connection to 172.17.0.3",
+	}, "\n")
+
+	tests := []struct {
+		byIP     bool
+		expected []string
+	}{
+		{
+			expected: []string{
+				"2023-03-12T07:30:00.000000Z 0 [Note] [MY-000000] [Galera] declaring node2 at ssl://node2:4567 stable",
+				"2023-03-12T07:30:01.000000Z 0 [Note] [MY-000000] [Galera] My UUID: node2",
+				"no date here, node2 unknown 172.17.0.9 and cluster 0b3e2cd3-d5c9-11ec-8ab7-671bbd2d70ef",
+				"2023-03-12T08:30:00.000000Z 0 [Note] [MY-000000] [Galera] connection to node2-renamed",
+			},
+		},
+		{
+			byIP: true,
+			expected: []string{
+				"2023-03-12T07:30:00.000000Z 0 [Note] [MY-000000] [Galera] declaring 172.17.0.3 at ssl://172.17.0.3:4567 stable",
+				"2023-03-12T07:30:01.000000Z 0 [Note] [MY-000000] [Galera] My UUID: 172.17.0.3",
+				"no date here, 172.17.0.3 unknown 172.17.0.9 and cluster 0b3e2cd3-d5c9-11ec-8ab7-671bbd2d70ef",
+				"2023-03-12T08:30:00.000000Z 0 [Note] [MY-000000] [Galera] connection to 172.17.0.3",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		out := &bytes.Buffer{}
+		err := sedStream(strings.NewReader(input), out, db, nil, test.byIP)
+		if err != nil {
+			t.Fatalf("byIP=%t: unexpected error: %v", test.byIP, err)
+		}
+		expected := strings.Join(test.expected, "\n")
+		if out.String() != expected {
+			t.Errorf("byIP=%t: expected:\n%s\ngot:\n%s", test.byIP, expected, out.String())
+		}
+	}
+}
+
+func TestSedStreamReusedIP(t *testing.T) {
+	db := translate.NewDB()
+	db.AssumeIPStable = false
+
+	// on k8s, the IP of a stopped pod is reused by the next one
+	db.AddHashToIP("ed97c863-8ab7", "10.0.0.3", time.Date(2023, 3, 12, 7, 0, 0, 0, time.UTC))
+	db.AddHashToIP("a1b2c3d4-9f00", "10.0.0.3", time.Date(2023, 3, 12, 8, 0, 0, 0, time.UTC))
+
+	input := strings.Join([]string{
+		"2023-03-12T07:30:00.000000Z 0 [Note] [MY-000000] [Galera] declaring ed97c863-8ab7 stable",
+		"2023-03-12T08:30:00.000000Z 0 [Note] [MY-000000] [Galera] forgetting ed97c863-8ab7, declaring a1b2c3d4-9f00 stable",
+	}, "\n")
+	expected := strings.Join([]string{
+		"2023-03-12T07:30:00.000000Z 0 [Note] [MY-000000] [Galera] declaring 10.0.0.3 stable",
+		"2023-03-12T08:30:00.000000Z 0 [Note] [MY-000000] [Galera] forgetting ed97c863-8ab7, declaring 10.0.0.3 stable",
+	}, "\n")
+
+	out := &bytes.Buffer{}
+	if err := sedStream(strings.NewReader(input), out, db, nil, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestSedStreamClock(t *testing.T) {
+	db := translate.NewDB()
+	db.AssumeIPStable = false
+	db.AddHashToIP("ed97c863-8ab7", "10.0.0.3", time.Date(2023, 3, 12, 7, 0, 0, 0, time.UTC))
+	db.AddHashToIP("a1b2c3d4-9f00", "10.0.0.3", time.Date(2023, 3, 12, 8, 0, 0, 0, time.UTC))
+
+	// the input was logged an hour late, the IP was already given to another node
+	input := "2023-03-12T07:30:00.000000Z 0 [Note] [MY-000000] [Galera] declaring ed97c863-8ab7 stable"
+
+	out := &bytes.Buffer{}
+	if err := sedStream(strings.NewReader(input), out, db, &types.FileClock{Offset: time.Hour}, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != input {
+		t.Errorf("expected:\n%s\ngot:\n%s", input, out.String())
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/Ladicle/tabwriter"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
+	"github.com/pkg/errors"
+)
+
+type sst struct {
+	Paths []string `arg:"" name:"paths" help:"paths of the log to use"`
+	Json  bool     `help:"Output state transfers and summary as json"`
+}
+
+func (s *sst) Help() string {
+	return fmt.Sprintf(`List every state transfers (SST and IST) with their duration and outcome, then summarize them per donor/joiner pair
+
+Logs from every nodes should be given: the donor and the joiner do not log the same information.
+The same transfer seen from several nodes will only be listed once.
+
+Usage:
+	%[1]s sst <list of files>
+	%[1]s sst --json *.log
+	`, toolname)
+}
+
+const (
+	sstOutcomeSuccess = "success"
+	sstOutcomeFailed  = "failed"
+	sstOutcomeUnknown = "unknown"
+
+	// the same SST event is logged by every nodes within milliseconds
+	// this is the window to consider them as the same event
+	sstEventMatchingWindow = 10 * time.Second
+)
+
+var (
+	regexSSTScriptMethod  = regexp.MustCompile("wsrep_sst_(?P<method>[a-zA-Z0-9_-]+)")
+	regexSSTScriptRole    = regexp.MustCompile("--role '(?P<role>donor|joiner)'")
+	regexSSTScriptFailure = regexp.MustCompile(": (?P<reason>[0-9]+ \\([a-zA-Z ]+\\))")
+	regexSSTGaleraFailure = regexp.MustCompile("failed: (?P<reason>-?[0-9]+ \\([a-zA-Z ]+\\))")
+)
+
+type stateTransfer struct {
+	Donor         string     `json:"donor"`
+	Joiner        string     `json:"joiner"`
+	Type          string     `json:"type,omitempty"`   // SST or IST
+	Method        string     `json:"method,omitempty"` // sst script used: xtrabackup-v2, rsync, clone, ...
+	Start         *time.Time `json:"start,omitempty"`
+	End           *time.Time `json:"end,omitempty"`
+	Outcome       string     `json:"outcome"`
+	FailureReason string     `json:"failureReason,omitempty"`
+	ReportedBy    []string   `json:"reportedBy"`
+}
+
+func (st *stateTransfer) isOpen() bool {
+	return st.Outcome == sstOutcomeUnknown
+}
+
+// Duration returns 0 when either the start or the end is unknown
+func (st *stateTransfer) Duration() time.Duration {
+	if st.Start == nil || st.End == nil {
+		return 0
+	}
+	return st.End.Sub(*st.Start)
+}
+
+// DisplayMethod returns the most precise information known about how the data was transferred
+func (st *stateTransfer) DisplayMethod() string {
+	switch {
+	case st.Type == "IST":
+		return "IST"
+	case st.Method != "":
+		return st.Method
+	case st.Type != "":
+		return st.Type
+	default:
+		return "?"
+	}
+}
+
+func (st *stateTransfer) close(outcome, reason string, date *time.Time) {
+	st.Outcome = outcome
+	st.End = date
+	if st.FailureReason == "" {
+		st.FailureReason = reason
+	}
+}
+
+type sstPairSummary struct {
+	Donor       string        `json:"donor"`
+	Joiner      string        `json:"joiner"`
+	Count       int           `json:"count"`
+	Successes   int           `json:"successes"`
+	Failures    int           `json:"failures"`
+	Unknown     int           `json:"unknown"`
+	MinDuration time.Duration `json:"minDurationNs"`
+	AvgDuration time.Duration `json:"avgDurationNs"`
+	MaxDuration time.Duration `json:"maxDurationNs"`
+}
+
+func (s *sst) Run() error {
+
+	regexes := types.RegexMap{}.Merge(regex.IdentsMap).Merge(regex.SSTMap).Merge(regex.StatesMap).Merge(regex.ViewsMap)
+	timeline, err := timelineFromPaths(s.Paths, regexes)
+	if err != nil {
+		return errors.Wrap(err, "could not list state transfers")
+	}
+
+	transfers := stateTransfersFromTimeline(timeline)
+	summary := summarizeStateTransfers(transfers)
+
+	if s.Json {
+		out, err := json.MarshalIndent(struct {
+			Transfers []*stateTransfer `json:"transfers"`
+			Summary   []sstPairSummary `json:"summary"`
+		}{Transfers: transfers, Summary: summary}, "", "\t")
+		if err != nil {
+			return errors.Wrap(err, "could not marshal state transfers")
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if len(transfers) == 0 {
+		fmt.Println("No state transfer found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 8, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "donor\tjoiner\tmethod\tstart\tend\tduration\toutcome\tfailure reason\t")
+	for _, st := range transfers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", st.Donor, st.Joiner, st.DisplayMethod(), displayTime(st.Start), displayTime(st.End), displayDuration(st.Duration()), paintOutcome(st.Outcome), st.FailureReason)
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 8, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "donor\tjoiner\tcount\tsuccess\tfailed\tunknown\tmin duration\tavg duration\tmax duration\t")
+	for _, pair := range summary {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t\n", pair.Donor, pair.Joiner, pair.Count, pair.Successes, pair.Failures, pair.Unknown, displayDuration(pair.MinDuration), displayDuration(pair.AvgDuration), displayDuration(pair.MaxDuration))
+	}
+	w.Flush()
+	return nil
+}
+
+func displayTime(t *time.Time) string {
+	if t == nil {
+		return "?"
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func displayDuration(d time.Duration) string {
+	if d == 0 {
+		return "?"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func paintOutcome(outcome string) string {
+	switch outcome {
+	case sstOutcomeSuccess:
+		return utils.Paint(utils.GreenText, outcome)
+	case sstOutcomeFailed:
+		return utils.Paint(utils.RedText, outcome)
+	default:
+		return utils.Paint(utils.YellowText, outcome)
+	}
+}
+
+func withinMatchingWindow(t1, t2 *time.Time) bool {
+	if t1 == nil || t2 == nil {
+		return false
+	}
+	d := t1.Sub(*t2)
+	return d < sstEventMatchingWindow && d > -sstEventMatchingWindow
+}
+
+// sstSubmatches reuses the internal regex of the SST map to extract node names
+func sstSubmatches(key, log string) (string, string) {
+	r := regex.SSTMap[key].InternalRegex
+	slice := r.FindStringSubmatch(log)
+	if len(slice) == 0 {
+		return "", ""
+	}
+	name1, name2 := "", ""
+	if i := r.SubexpIndex("nodename"); i > 0 {
+		name1 = utils.ShortNodeName(slice[i])
+	}
+	if i := r.SubexpIndex("nodename2"); i > 0 {
+		name2 = utils.ShortNodeName(slice[i])
+	}
+	return name1, name2
+}
+
+func submatch(r *regexp.Regexp, group, log string) string {
+	slice := r.FindStringSubmatch(log)
+	if len(slice) == 0 {
+		return ""
+	}
+	return slice[r.SubexpIndex(group)]
+}
+
+type stateTransfers []*stateTransfer
+
+// latest returns the most recent transfer matching donor and joiner, empty values matching anything
+func (sts stateTransfers) latest(donor, joiner string, openOnly bool) *stateTransfer {
+	for i := len(sts) - 1; i >= 0; i-- {
+		st := sts[i]
+		if (donor == "" || st.Donor == donor) && (joiner == "" || st.Joiner == joiner) && (!openOnly || st.isOpen()) {
+			return st
+		}
+	}
+	return nil
+}
+
+// localOpen returns the latest ongoing transfer the local node is part of, using its known names
+// Same as LogCtx.SetSSTTypeMaybe, if there is a single ongoing transfer it is assumed to be the one
+func (sts stateTransfers) localOpen(logCtx types.LogCtx, role string) *stateTransfer {
+	var open []*stateTransfer
+	for i := len(sts) - 1; i >= 0; i-- {
+		st := sts[i]
+		if !st.isOpen() {
+			continue
+		}
+		open = append(open, st)
+		if (role == "donor" && utils.SliceContains(logCtx.OwnNames, st.Donor)) || (role == "joiner" && utils.SliceContains(logCtx.OwnNames, st.Joiner)) {
+			return st
+		}
+	}
+	if len(open) == 1 {
+		return open[0]
+	}
+	return nil
+}
+
+// closing finds the transfer a completion/failure event is about
+// It returns nil when the event was already handled from another node's log
+func (sts *stateTransfers) closing(donor, joiner string, date *time.Time) *stateTransfer {
+	if st := sts.latest(donor, joiner, true); st != nil {
+		return st
+	}
+	if st := sts.latest(donor, joiner, false); st != nil && withinMatchingWindow(st.End, date) {
+		return nil
+	}
+	// the beginning of the transfer was not logged
+	st := &stateTransfer{Donor: donor, Joiner: joiner, Outcome: sstOutcomeUnknown}
+	*sts = append(*sts, st)
+	return st
+}
+
+// stateTransfersFromTimeline walks through the timeline to rebuild every state transfers
+// It cannot rely on LogCtx.SSTs because they are removed from context as soon as they end
+func stateTransfersFromTimeline(timeline types.Timeline) []*stateTransfer {
+	sts := stateTransfers{}
+
+	timeline.Chronological(func(node string, li types.LogInfo) {
+		var date *time.Time
+		if li.Date != nil {
+			t := li.Date.Time
+			date = &t
+		}
+
+		var st *stateTransfer
+		switch li.RegexUsed {
+		case "RegexSSTRequestSuccess":
+			joiner, donor := sstSubmatches(li.RegexUsed, li.Log)
+			if donor == "" {
+				return
+			}
+			st = sts.latest(donor, joiner, true)
+			if st == nil || !withinMatchingWindow(st.Start, date) {
+				st = &stateTransfer{Donor: donor, Joiner: joiner, Start: date, Outcome: sstOutcomeUnknown}
+				sts = append(sts, st)
+			}
+
+		case "RegexSSTComplete":
+			donor, joiner := sstSubmatches(li.RegexUsed, li.Log)
+			if st = sts.closing(donor, joiner, date); st != nil {
+				st.close(sstOutcomeSuccess, "", date)
+			}
+
+		case "RegexSSTCompleteUnknown":
+			donor, _ := sstSubmatches(li.RegexUsed, li.Log)
+			if st = sts.closing(donor, "", date); st != nil {
+				// the joiner left the group after receiving the state, the transfer itself succeeded
+				st.close(sstOutcomeSuccess, "", date)
+			}
+
+		case "RegexSSTStateTransferFailed", "RegexSSTFailedUnknown":
+			donor, joiner := sstSubmatches(li.RegexUsed, li.Log)
+			reason := submatch(regexSSTGaleraFailure, "reason", li.Log)
+			if st = sts.closing(donor, joiner, date); st != nil {
+				st.close(sstOutcomeFailed, reason, date)
+			} else if st = sts.latest(donor, joiner, false); st != nil && st.FailureReason == "" {
+				st.FailureReason = reason
+			}
+
+		case "RegexSSTError":
+			role := submatch(regexSSTScriptRole, "role", li.Log)
+			if st = sts.localOpen(li.LogCtx, role); st != nil {
+				st.Method = submatch(regexSSTScriptMethod, "method", li.Log)
+				reason := role + " script error"
+				if scriptReason := submatch(regexSSTScriptFailure, "reason", li.Log); scriptReason != "" {
+					reason += ": " + scriptReason
+				}
+				st.close(sstOutcomeFailed, reason, date)
+			}
+
+		case "RegexSSTInitiating":
+			if st = sts.localOpen(li.LogCtx, "donor"); st != nil {
+				st.Method = submatch(regexSSTScriptMethod, "method", li.Log)
+			}
+
+		case "RegexISTSender":
+			if st = sts.localOpen(li.LogCtx, "donor"); st != nil {
+				st.Type = "IST"
+			}
+
+		case "RegexISTReceived", "RegexBypassSST", "RegexXtrabackupISTReceived":
+			if st = sts.localOpen(li.LogCtx, "joiner"); st != nil {
+				st.Type = "IST"
+			}
+
+		case "RegexSSTProceeding", "RegexFailedToPrepareIST":
+			if st = sts.localOpen(li.LogCtx, "joiner"); st != nil {
+				st.Type = "SST"
+			}
+
+		case "RegexISTReceiver":
+			if st = sts.localOpen(li.LogCtx, "joiner"); st != nil && st.Type == "" {
+				// "Prepared IST receiver for 0-x" means it will go through SST
+				st.Type = "IST"
+				if regexISTReceiverFromZero.MatchString(li.Log) {
+					st.Type = "SST"
+				}
+			}
+		}
+
+		if st != nil && !utils.SliceContains(st.ReportedBy, node) {
+			st.ReportedBy = append(st.ReportedBy, node)
+		}
+	})
+
+	return sts
+}
+
+var regexISTReceiverFromZero = regexp.MustCompile("Prepared IST receiver for 0-")
+
+func summarizeStateTransfers(transfers []*stateTransfer) []sstPairSummary {
+	pairs := map[[2]string]*sstPairSummary{}
+	keys := [][2]string{}
+	durations := map[[2]string]time.Duration{}
+	timed := map[[2]string]int{}
+
+	for _, st := range transfers {
+		key := [2]string{st.Donor, st.Joiner}
+		pair, ok := pairs[key]
+		if !ok {
+			pair = &sstPairSummary{Donor: st.Donor, Joiner: st.Joiner}
+			pairs[key] = pair
+			keys = append(keys, key)
+		}
+		pair.Count++
+		switch st.Outcome {
+		case sstOutcomeSuccess:
+			pair.Successes++
+		case sstOutcomeFailed:
+			pair.Failures++
+		default:
+			pair.Unknown++
+		}
+
+		// only successful transfers are relevant to know how long a transfer takes
+		d := st.Duration()
+		if st.Outcome != sstOutcomeSuccess || d == 0 {
+			continue
+		}
+		if pair.MinDuration == 0 || d < pair.MinDuration {
+			pair.MinDuration = d
+		}
+		if d > pair.MaxDuration {
+			pair.MaxDuration = d
+		}
+		durations[key] += d
+		timed[key]++
+		pair.AvgDuration = durations[key] / time.Duration(timed[key])
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	summary := make([]sstPairSummary, 0, len(keys))
+	for _, key := range keys {
+		summary = append(summary, *pairs[key])
+	}
+	return summary
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarizeStateTransfers(t *testing.T) {
+	date := func(sec int) *time.Time {
+		d := time.Date(2023, 3, 12, 7, 0, sec, 0, time.UTC)
+		return &d
+	}
+
+	transfers := []*stateTransfer{
+		{Donor: "node2", Joiner: "node1", Start: date(0), End: date(10), Outcome: sstOutcomeSuccess},
+		{Donor: "node1", Joiner: "node3", Start: date(0), End: date(5), Outcome: sstOutcomeFailed},
+		{Donor: "node2", Joiner: "node1", Start: date(20), End: date(50), Outcome: sstOutcomeSuccess},
+		{Donor: "node2", Joiner: "node1", Start: date(60), Outcome: sstOutcomeUnknown},
+		{Donor: "node2", Joiner: "node1", End: date(70), Outcome: sstOutcomeSuccess},
+	}
+
+	summary := summarizeStateTransfers(transfers)
+	if len(summary) != 2 {
+		t.Fatalf("expected 2 pairs, got %d: %v", len(summary), summary)
+	}
+
+	expected := []sstPairSummary{
+		{Donor: "node1", Joiner: "node3", Count: 1, Failures: 1},
+		{Donor: "node2", Joiner: "node1", Count: 4, Successes: 3, Unknown: 1, MinDuration: 10 * time.Second, AvgDuration: 20 * time.Second, MaxDuration: 30 * time.Second},
+	}
+	for i := range expected {
+		if summary[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], summary[i])
+		}
+	}
+}
+
+func TestStateTransferDisplayMethod(t *testing.T) {
+	tests := []struct {
+		st       stateTransfer
+		expected string
+	}{
+		{st: stateTransfer{Type: "IST", Method: "xtrabackup-v2"}, expected: "IST"},
+		{st: stateTransfer{Type: "SST", Method: "rsync"}, expected: "rsync"},
+		{st: stateTransfer{Type: "SST"}, expected: "SST"},
+		{st: stateTransfer{}, expected: "?"},
+	}
+	for _, test := range tests {
+		if out := test.st.DisplayMethod(); out != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, out)
+		}
+	}
+}
@@ -14,7 +14,9 @@ type translationUnit struct {
 	Timestamp time.Time
 }
 
-type translationsDB struct {
+// DB stores every identity found in logs: node hashes, IPs and names
+// Analyses which must not share what they learnt should use their own DB
+type DB struct {
 	// 1 hash: only 1 IP. wsrep_node_address is not dynamic
 	// if there's a restart, the hash will change as well anyway
 	HashToIP map[string]*translationUnit
@@ -25,37 +27,47 @@ type translationsDB struct {
 
 	// incase methods changed in the middle, tcp=>ssl
 	IPToMethods map[string][]translationUnit
-	rwlock      sync.RWMutex
-}
-
-var AssumeIPStable bool = true
 
-var db = translationsDB{}
+	// AssumeIPStable is true when IPs are not reused between nodes
+	// it enables to find names through any hash ever seen with an IP
+	AssumeIPStable bool `json:"-"`
 
-func init() {
-	initTranslationsDB()
+	rwlock sync.RWMutex
 }
 
-func initTranslationsDB() {
-	db = translationsDB{
+// db is the package-level DB used by package functions
+var db = NewDB()
+
+func NewDB() *DB {
+	return &DB{
 		HashToIP:        map[string]*translationUnit{},
 		HashToNodeNames: map[string][]translationUnit{},
 		IPToMethods:     map[string][]translationUnit{},
 		IPToNodeNames:   map[string][]translationUnit{},
+		AssumeIPStable:  true,
 	}
 }
 
 // only useful for tests
 func ResetDB() {
-	initTranslationsDB()
+	assumeIPStable := db.AssumeIPStable
+	db = NewDB()
+	db.AssumeIPStable = assumeIPStable
 }
 
 func DBToJson() (string, error) {
+	return db.ToJson()
+}
+
+func (db *DB) ToJson() (string, error) {
+	db.rwlock.RLock()
+	defer db.rwlock.RUnlock()
 	out, err := json.MarshalIndent(db, "", "\t")
 	return string(out), err
 }
 
-func GetDB() translationsDB {
+// GetDB returns the package-level DB
+func GetDB() *DB {
 	return db
 }
 
@@ -67,6 +79,10 @@ func (tu *translationUnit) UpdateTimestamp(ts time.Time) {
 }
 
 func AddHashToIP(hash, ip string, ts time.Time) {
+	db.AddHashToIP(hash, ip, ts)
+}
+
+func (db *DB) AddHashToIP(hash, ip string, ts time.Time) {
 	db.rwlock.Lock()
 	defer db.rwlock.Unlock()
 	latestValue, ok := db.HashToIP[hash]
@@ -98,6 +114,10 @@ func upsertToMap(m map[string][]translationUnit, key string, tu translationUnit)
 }
 
 func AddHashToNodeName(hash, name string, ts time.Time) {
+	db.AddHashToNodeName(hash, name, ts)
+}
+
+func (db *DB) AddHashToNodeName(hash, name string, ts time.Time) {
 	db.rwlock.Lock()
 	defer db.rwlock.Unlock()
 	name = utils.ShortNodeName(name)
@@ -105,6 +125,10 @@ func AddHashToNodeName(hash, name string, ts time.Time) {
 }
 
 func AddIPToNodeName(ip, name string, ts time.Time) {
+	db.AddIPToNodeName(ip, name, ts)
+}
+
+func (db *DB) AddIPToNodeName(ip, name string, ts time.Time) {
 	db.rwlock.Lock()
 	defer db.rwlock.Unlock()
 	name = utils.ShortNodeName(name)
@@ -112,12 +136,20 @@ func AddIPToNodeName(ip, name string, ts time.Time) {
 }
 
 func AddIPToMethod(ip, method string, ts time.Time) {
+	db.AddIPToMethod(ip, method, ts)
+}
+
+func (db *DB) AddIPToMethod(ip, method string, ts time.Time) {
 	db.rwlock.Lock()
 	defer db.rwlock.Unlock()
 	upsertToMap(db.IPToMethods, ip, translationUnit{Value: method, Timestamp: ts})
 }
 
 func GetIPFromHash(hash string) string {
+	return db.GetIPFromHash(hash)
+}
+
+func (db *DB) GetIPFromHash(hash string) string {
 	db.rwlock.RLock()
 	defer db.rwlock.RUnlock()
 	ip, ok := db.HashToIP[hash]
@@ -127,6 +159,23 @@ func GetIPFromHash(hash string) string {
 	return ""
 }
 
+// GetIPFromHashAt returns the IP of the hash, unless the IP was already reused by another node at the given date
+// this can only happen when IPs are not assumed stable, such as on k8s
+func GetIPFromHashAt(hash string, date time.Time) string {
+	return db.GetIPFromHashAt(hash, date)
+}
+
+func (db *DB) GetIPFromHashAt(hash string, date time.Time) string {
+	ip := db.GetIPFromHash(hash)
+	if ip == "" || db.AssumeIPStable {
+		return ip
+	}
+	if owner := db.getHashFromIP(ip, date); owner != "" && owner != hash {
+		return ""
+	}
+	return ip
+}
+
 func mostAppropriateValueFromTS(units []translationUnit, ts time.Time) translationUnit {
 
 	if len(units) == 0 {
@@ -146,6 +195,10 @@ func mostAppropriateValueFromTS(units []translationUnit, ts time.Time) translati
 }
 
 func GetNodeNameFromHash(hash string, ts time.Time) string {
+	return db.GetNodeNameFromHash(hash, ts)
+}
+
+func (db *DB) GetNodeNameFromHash(hash string, ts time.Time) string {
 	db.rwlock.RLock()
 	names := db.HashToNodeNames[hash]
 	db.rwlock.RUnlock()
@@ -153,6 +206,10 @@ func GetNodeNameFromHash(hash string, ts time.Time) string {
 }
 
 func GetNodeNameFromIP(ip string, ts time.Time) string {
+	return db.GetNodeNameFromIP(ip, ts)
+}
+
+func (db *DB) GetNodeNameFromIP(ip string, ts time.Time) string {
 	db.rwlock.RLock()
 	names := db.IPToNodeNames[ip]
 	db.rwlock.RUnlock()
@@ -160,13 +217,17 @@ func GetNodeNameFromIP(ip string, ts time.Time) string {
 }
 
 func GetMethodFromIP(ip string, ts time.Time) string {
+	return db.GetMethodFromIP(ip, ts)
+}
+
+func (db *DB) GetMethodFromIP(ip string, ts time.Time) string {
 	db.rwlock.RLock()
 	methods := db.IPToMethods[ip]
 	db.rwlock.RUnlock()
 	return mostAppropriateValueFromTS(methods, ts).Value
 }
 
-func (db *translationsDB) getHashSliceFromIP(ip string) []translationUnit {
+func (db *DB) getHashSliceFromIP(ip string) []translationUnit {
 	db.rwlock.RLock()
 	defer db.rwlock.RUnlock()
 
@@ -183,7 +244,7 @@ func (db *translationsDB) getHashSliceFromIP(ip string) []translationUnit {
 	return units
 }
 
-func (db *translationsDB) getHashFromIP(ip string, ts time.Time) string {
+func (db *DB) getHashFromIP(ip string, ts time.Time) string {
 	units := db.getHashSliceFromIP(ip)
 	return mostAppropriateValueFromTS(units, ts).Value
 }
@@ -192,15 +253,19 @@ func (db *translationsDB) getHashFromIP(ip string, ts time.Time) string {
 // This only has impacts on display
 // In order of preference: wsrep_node_name (or galera "node" name), hostname, ip
 func SimplestInfoFromIP(ip string, date time.Time) string {
-	if nodename := GetNodeNameFromIP(ip, date); nodename != "" {
+	return db.SimplestInfoFromIP(ip, date)
+}
+
+func (db *DB) SimplestInfoFromIP(ip string, date time.Time) string {
+	if nodename := db.GetNodeNameFromIP(ip, date); nodename != "" {
 		return nodename
 	}
 
 	// This means we trust the fact that some nodes hashes/names sharing the same IP
 	// will ultimately be from the same node. On on-premise setups this is safe to assume
-	if AssumeIPStable {
+	if db.AssumeIPStable {
 		for _, units := range db.getHashSliceFromIP(ip) {
-			if nodename := GetNodeNameFromHash(units.Value, date); nodename != "" {
+			if nodename := db.GetNodeNameFromHash(units.Value, date); nodename != "" {
 				return nodename
 			}
 		}
@@ -208,7 +273,7 @@ func SimplestInfoFromIP(ip string, date time.Time) string {
 		// we have to strictly use ip=>hash pairs we saw in logs at specific timeframe
 	} else {
 		if hash := db.getHashFromIP(ip, date); hash != "" {
-			if nodename := GetNodeNameFromHash(hash, date); nodename != "" {
+			if nodename := db.GetNodeNameFromHash(hash, date); nodename != "" {
 				return nodename
 			}
 		}
@@ -217,17 +282,25 @@ func SimplestInfoFromIP(ip string, date time.Time) string {
 }
 
 func SimplestInfoFromHash(hash string, date time.Time) string {
-	if nodename := GetNodeNameFromHash(hash, date); nodename != "" {
+	return db.SimplestInfoFromHash(hash, date)
+}
+
+func (db *DB) SimplestInfoFromHash(hash string, date time.Time) string {
+	if nodename := db.GetNodeNameFromHash(hash, date); nodename != "" {
 		return nodename
 	}
 
-	if ip := GetIPFromHash(hash); ip != "" {
-		return SimplestInfoFromIP(ip, date)
+	if ip := db.GetIPFromHash(hash); ip != "" {
+		return db.SimplestInfoFromIP(ip, date)
 	}
 	return hash
 }
 
 func IsNodeUUIDKnown(uuid string) bool {
+	return db.IsNodeUUIDKnown(uuid)
+}
+
+func (db *DB) IsNodeUUIDKnown(uuid string) bool {
 	db.rwlock.RLock()
 	defer db.rwlock.RUnlock()
 
@@ -240,6 +313,10 @@ func IsNodeUUIDKnown(uuid string) bool {
 }
 
 func IsNodeNameKnown(name string) bool {
+	return db.IsNodeNameKnown(name)
+}
+
+func (db *DB) IsNodeNameKnown(name string) bool {
 	db.rwlock.RLock()
 	defer db.rwlock.RUnlock()
 
@@ -260,3 +337,49 @@ func IsNodeNameKnown(name string) bool {
 	}
 	return false
 }
+
+// KnownHashes lists every node hash stored in the translation maps, sorted
+func KnownHashes() []string {
+	return db.KnownHashes()
+}
+
+func (db *DB) KnownHashes() []string {
+	db.rwlock.RLock()
+	defer db.rwlock.RUnlock()
+
+	hashes := []string{}
+	for hash := range db.HashToIP {
+		hashes = append(hashes, hash)
+	}
+	for hash := range db.HashToNodeNames {
+		if _, ok := db.HashToIP[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+// KnownIPs lists every IP stored in the translation maps, sorted
+func KnownIPs() []string {
+	return db.KnownIPs()
+}
+
+func (db *DB) KnownIPs() []string {
+	db.rwlock.RLock()
+	defer db.rwlock.RUnlock()
+
+	seen := map[string]struct{}{}
+	for _, ip := range db.HashToIP {
+		seen[ip.Value] = struct{}{}
+	}
+	for ip := range db.IPToNodeNames {
+		seen[ip] = struct{}{}
+	}
+	ips := make([]string, 0, len(seen))
+	for ip := range seen {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
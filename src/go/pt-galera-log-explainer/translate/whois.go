@@ -10,6 +10,7 @@ import (
 )
 
 type WhoisNode struct {
+	db         *DB                   `json:"-"`
 	parentNode *WhoisNode            `json:"-"`
 	rootNode   *WhoisNode            `json:"-"`
 	nodetype   string                `json:"-"`
@@ -28,7 +29,12 @@ type WhoisValue struct {
 var forcedIterationOrder = []string{"nodename", "ip", "uuid"}
 
 func Whois(search, searchtype string) *WhoisNode {
+	return db.Whois(search, searchtype)
+}
+
+func (db *DB) Whois(search, searchtype string) *WhoisNode {
 	w := &WhoisNode{
+		db:       db,
 		nodetype: searchtype,
 		Values:   map[string]WhoisValue{},
 	}
@@ -43,6 +49,7 @@ func (v WhoisValue) AddChildKey(parentNode *WhoisNode, nodetype, value string, t
 	nodeNew := false
 	if child == nil {
 		child = &WhoisNode{
+			db:         parentNode.db,
 			nodetype:   nodetype,
 			rootNode:   parentNode.rootNode,
 			parentNode: parentNode,
@@ -165,13 +172,16 @@ func (n *WhoisNode) filter() {
 }
 
 func (n *WhoisNode) filterDBUsingIP() {
+	n.db.rwlock.RLock()
+	defer n.db.rwlock.RUnlock()
+
 	for ip, valueData := range n.Values {
-		for hash, ip2 := range db.HashToIP {
+		for hash, ip2 := range n.db.HashToIP {
 			if ip == ip2.Value {
 				valueData.AddChildKey(n, "uuid", hash, ip2.Timestamp)
 			}
 		}
-		nodenames, ok := db.IPToNodeNames[ip]
+		nodenames, ok := n.db.IPToNodeNames[ip]
 		if ok {
 			for _, nodename := range nodenames {
 				valueData.AddChildKey(n, "nodename", nodename.Value, nodename.Timestamp)
@@ -183,14 +193,17 @@ func (n *WhoisNode) filterDBUsingIP() {
 }
 
 func (n *WhoisNode) FilterDBUsingUUID() {
+	n.db.rwlock.RLock()
+	defer n.db.rwlock.RUnlock()
+
 	for uuid, valueData := range n.Values {
-		nodenames, ok := db.HashToNodeNames[uuid]
+		nodenames, ok := n.db.HashToNodeNames[uuid]
 		if ok {
 			for _, nodename := range nodenames {
 				valueData.AddChildKey(n, "nodename", nodename.Value, nodename.Timestamp)
 			}
 		}
-		ip, ok := db.HashToIP[uuid]
+		ip, ok := n.db.HashToIP[uuid]
 		if ok {
 			valueData.AddChildKey(n, "ip", ip.Value, ip.Timestamp)
 		}
@@ -200,20 +213,23 @@ func (n *WhoisNode) FilterDBUsingUUID() {
 }
 
 func (n *WhoisNode) FilterDBUsingNodeName() {
+	n.db.rwlock.RLock()
+	defer n.db.rwlock.RUnlock()
+
 	for nodename, valueData := range n.Values {
 		// unspecified will sometimes appears in some failures
 		// using it will lead to non-sense data as it can bridge the rest of the whole graph
 		if nodename == "unspecified" {
 			continue
 		}
-		for uuid, nodenames2 := range db.HashToNodeNames {
+		for uuid, nodenames2 := range n.db.HashToNodeNames {
 			for _, nodename2 := range nodenames2 {
 				if nodename == nodename2.Value {
 					valueData.AddChildKey(n, "uuid", uuid, nodename2.Timestamp)
 				}
 			}
 		}
-		for ip, nodenames2 := range db.IPToNodeNames {
+		for ip, nodenames2 := range n.db.IPToNodeNames {
 			for _, nodename2 := range nodenames2 {
 				if nodename == nodename2.Value {
 					valueData.AddChildKey(n, "ip", ip, nodename2.Timestamp)
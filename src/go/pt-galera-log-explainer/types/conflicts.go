@@ -1,9 +1,12 @@
 package types
 
+import "time"
+
 type Conflicts []*Conflict
 
 type Conflict struct {
 	Seqno       string
+	Date        time.Time `json:"-" yaml:"-"` // when the vote was initiated, only used for aggregations
 	InitiatedBy []string
 	Winner      string // winner will help the winning md5sum
 	VotePerNode map[string]ConflictVote
@@ -20,6 +23,9 @@ func (cs Conflicts) Merge(c Conflict) Conflicts {
 			for node, vote := range c.VotePerNode {
 				cs[i].VotePerNode[node] = vote
 			}
+			if cs[i].Date.IsZero() || (!c.Date.IsZero() && c.Date.Before(cs[i].Date)) {
+				cs[i].Date = c.Date
+			}
 			return cs
 		}
 	}
@@ -0,0 +1,56 @@
+package types
+
+import (
+	"strings"
+	"time"
+)
+
+// FileClock describes how dates from a log file have to be adjusted to be aligned with other files
+// It is shared by every log lines of the same file
+type FileClock struct {
+	// Location is used for dates logged without timezone information, e.g. with log_timestamps=SYSTEM on old versions
+	// Such dates are considered as UTC when nil
+	Location *time.Location
+
+	// Offset is added to every date, to compensate a skewed clock
+	Offset time.Duration
+
+	// Estimated is set when Offset was found using events every nodes logged at the same time
+	Estimated bool
+}
+
+// Adjust returns the date, in UTC, as it should have been logged by a clock aligned with other nodes
+// It is safe to use with a nil FileClock
+func (fc *FileClock) Adjust(t time.Time, layout string) time.Time {
+	if fc == nil {
+		return t
+	}
+	if fc.Location != nil && !layoutHasTimezone(layout) {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), fc.Location)
+	}
+	return t.Add(fc.Offset).UTC()
+}
+
+func (fc *FileClock) String() string {
+	if fc == nil {
+		return ""
+	}
+	parts := []string{}
+	if fc.Location != nil {
+		parts = append(parts, fc.Location.String())
+	}
+	if fc.Offset > 0 {
+		parts = append(parts, "+"+fc.Offset.String())
+	} else if fc.Offset < 0 {
+		parts = append(parts, fc.Offset.String())
+	}
+	s := strings.Join(parts, " ")
+	if fc.Estimated {
+		s += " (estimated)"
+	}
+	return s
+}
+
+func layoutHasTimezone(layout string) bool {
+	return strings.HasSuffix(layout, "Z") || strings.Contains(layout, "-07:00")
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileClockAdjust(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("timezone database not available")
+	}
+	logged := time.Date(2023, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		clock    *FileClock
+		layout   string
+		expected time.Time
+	}{
+		{
+			name:     "nil clock",
+			layout:   "2006-01-02 15:04:05",
+			expected: logged,
+		},
+		{
+			name:     "timezone on date without timezone",
+			clock:    &FileClock{Location: paris},
+			layout:   "2006-01-02 15:04:05",
+			expected: time.Date(2023, 3, 12, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "timezone ignored when the date has one",
+			clock:    &FileClock{Location: paris},
+			layout:   "2006-01-02T15:04:05.000000Z",
+			expected: logged,
+		},
+		{
+			name:     "timezone and offset",
+			clock:    &FileClock{Location: paris, Offset: -2 * time.Minute},
+			layout:   "060102 15:04:05",
+			expected: time.Date(2023, 3, 12, 8, 58, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		if out := test.clock.Adjust(logged, test.layout); !out.Equal(test.expected) {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, out)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package types
+
+// Flavor is the galera distribution that produced the logs
+// Both are based on Galera 4 nowadays, but they do not log the same way:
+// MariaDB is using "mariadbd" as its binary name since 10.5, and has its own
+// start/crash/SST messages
+type Flavor string
+
+const (
+	FlavorAuto    Flavor = "auto"
+	FlavorPXC     Flavor = "pxc"
+	FlavorMariaDB Flavor = "mariadb"
+)
+
+// MariaDBDetectionRegex is sent to grep to detect MariaDB logs
+const MariaDBDetectionRegex = "Starting MariaDB|mariadbd|mariabackup"
@@ -25,6 +25,7 @@ type LogCtx struct {
 	stateBackupLog         string
 	Version                string
 	OperatorMetadata       *OperatorMetadata
+	Clock                  *FileClock // how dates of this file were adjusted, nil when they are used as-is
 
 	// SSTs where key is donor name, as it will always be known.
 	// is meant to be shared with a deep copy, there's no sense to share the pointer
@@ -35,6 +36,10 @@ type LogCtx struct {
 	Desynced     bool
 	minVerbosity Verbosity
 	Conflicts    Conflicts
+
+	// Translations is where identities found along the way are stored, shared by every copy
+	// nil means the package-level translations are used
+	Translations *translate.DB
 }
 
 func NewLogCtx() LogCtx {
@@ -90,6 +95,14 @@ func (logCtx *LogCtx) SetState(s string) {
 	}
 }
 
+// DB returns the translations to use for this context
+func (logCtx LogCtx) DB() *translate.DB {
+	if logCtx.Translations == nil {
+		return translate.GetDB()
+	}
+	return logCtx.Translations
+}
+
 func (logCtx *LogCtx) HasVisibleEvents(level Verbosity) bool {
 	return level >= logCtx.minVerbosity
 }
@@ -111,7 +124,7 @@ func (logCtx *LogCtx) AddOwnName(name string, date time.Time) {
 	// because we frequently lack ip=>nodename clear associations, propagating is important
 	// we only infer the last verified ip will be associated to the verified name as it's enough
 	if lenIPs := len(logCtx.OwnIPs); lenIPs > 0 {
-		translate.AddIPToNodeName(logCtx.OwnIPs[lenIPs-1], name, date)
+		logCtx.DB().AddIPToNodeName(logCtx.OwnIPs[lenIPs-1], name, date)
 	}
 }
 
@@ -127,10 +140,10 @@ func (logCtx *LogCtx) AddOwnHash(hash string, date time.Time) {
 	// but it will also bridge the gap in sparse on-premise logs
 	// why only the last one: the earliest information may be obsolete
 	if lenIPs := len(logCtx.OwnIPs); lenIPs > 0 {
-		translate.AddHashToIP(hash, logCtx.OwnIPs[lenIPs-1], date)
+		logCtx.DB().AddHashToIP(hash, logCtx.OwnIPs[lenIPs-1], date)
 	}
 	if lenNodeNames := len(logCtx.OwnNames); lenNodeNames > 0 {
-		translate.AddHashToNodeName(hash, logCtx.OwnNames[lenNodeNames-1], date)
+		logCtx.DB().AddHashToNodeName(hash, logCtx.OwnNames[lenNodeNames-1], date)
 	}
 }
 
@@ -144,7 +157,7 @@ func (logCtx *LogCtx) AddOwnIP(ip string, date time.Time) {
 
 	// see note in AddOwnName
 	if lenNodeNames := len(logCtx.OwnNames); lenNodeNames > 0 {
-		translate.AddIPToNodeName(ip, logCtx.OwnNames[lenNodeNames-1], date)
+		logCtx.DB().AddIPToNodeName(ip, logCtx.OwnNames[lenNodeNames-1], date)
 	}
 }
 
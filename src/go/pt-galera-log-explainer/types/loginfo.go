@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
 )
 
@@ -22,6 +21,7 @@ type LogInfo struct {
 	Date            *Date
 	displayer       LogDisplayer // what to show
 	Log             string       // the raw log
+	LineNumber      int          // line number of the raw log in its file, 0 when unknown
 	RegexType       RegexType
 	RegexUsed       string
 	LogCtx          LogCtx // the context is copied for each logInfo, so that it is easier to handle some info (current state), and this is also interesting to check how it evolved
@@ -96,13 +96,13 @@ func SimpleDisplayer(s string) LogDisplayer {
 }
 
 func FormatByIPDisplayer(layout, ip string, date time.Time) LogDisplayer {
-	return func(_ LogCtx) string {
-		return fmt.Sprintf(layout, translate.SimplestInfoFromIP(ip, date))
+	return func(logCtx LogCtx) string {
+		return fmt.Sprintf(layout, logCtx.DB().SimplestInfoFromIP(ip, date))
 	}
 }
 
 func FormatByHashDisplayer(layout, hash string, date time.Time) LogDisplayer {
-	return func(_ LogCtx) string {
-		return fmt.Sprintf(layout, translate.SimplestInfoFromHash(hash, date))
+	return func(logCtx LogCtx) string {
+		return fmt.Sprintf(layout, logCtx.DB().SimplestInfoFromHash(hash, date))
 	}
 }
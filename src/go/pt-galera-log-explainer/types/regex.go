@@ -3,6 +3,7 @@ package types
 import (
 	"encoding/json"
 	"regexp"
+	"sort"
 	"time"
 )
 
@@ -83,6 +84,16 @@ func (r RegexMap) Merge(r2 RegexMap) RegexMap {
 	return r
 }
 
+// SortedKeys is used when the regexes have to be iterated in a stable order
+func (r RegexMap) SortedKeys() []string {
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (r RegexMap) Compile() []string {
 
 	arr := []string{}
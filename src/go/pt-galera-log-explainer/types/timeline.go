@@ -3,7 +3,10 @@ package types
 import (
 	"math"
 	"path/filepath"
+	"sort"
 	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
 )
 
 // It should be kept already sorted by timestamp
@@ -31,7 +34,7 @@ func (timeline Timeline) MergeByIdentifier(lt LocalTimeline) {
 	// identify the node with the easiest to read information
 	// this is critical part to aggregate logs: this is what enable to merge logs
 	// ultimately the "identifier" will be used for columns header
-	node := Identifier(lt[len(lt)-1].LogCtx, getlasttime(lt))
+	node := lt.Identifier()
 	if lt2, ok := timeline[node]; ok {
 		lt = MergeTimeline(lt2, lt)
 	}
@@ -151,6 +154,12 @@ func getfirsttime(l LocalTimeline) time.Time {
 	}
 	return time.Time{}
 }
+
+// Identifier is the node a local timeline is merged with by MergeByIdentifier
+func (lt LocalTimeline) Identifier() string {
+	return Identifier(lt[len(lt)-1].LogCtx, getlasttime(lt))
+}
+
 func getlasttime(l LocalTimeline) time.Time {
 	for i := len(l) - 1; i >= 0; i-- {
 		if l[i].Date != nil && (l[i].LogCtx.FileType == "error.log" || l[i].LogCtx.FileType == "") {
@@ -185,7 +194,7 @@ func (t *Timeline) GetLatestContextsByNodes() map[string]LogCtx {
 
 // iterateNode is used to search the source node(s) that contains the next chronological events
 // it returns a slice in case 2 nodes have their next event precisely at the same time, which
-// happens a lot on some versions
+// happens a lot on some versions. The slice is sorted alphabetically to keep outputs stable
 func (t Timeline) IterateNode() []string {
 	var (
 		nextDate  time.Time
@@ -204,6 +213,7 @@ func (t Timeline) IterateNode() []string {
 			nextNodes = append(nextNodes, node)
 		}
 	}
+	sort.Strings(nextNodes)
 	return nextNodes
 }
 
@@ -214,3 +224,27 @@ func (t Timeline) Dequeue(node string) {
 		t[node] = t[node][1:]
 	}
 }
+
+// DB returns the translations the timeline was built with, shared by all of its contexts
+// It has to be called before the timeline is dequeued
+func (t Timeline) DB() *translate.DB {
+	for _, lt := range t {
+		if len(lt) > 0 {
+			return lt[0].LogCtx.DB()
+		}
+	}
+	return translate.NewDB()
+}
+
+// Chronological dequeues every events of the timeline in chronological order, calling fn on each of them
+// Nodes having their next event at the exact same time are handled in alphabetical order
+// The timeline will be empty afterward
+func (t Timeline) Chronological(fn func(node string, li LogInfo)) {
+	for nextNodes := t.IterateNode(); len(nextNodes) != 0; nextNodes = t.IterateNode() {
+		for _, node := range nextNodes {
+			li := t[node][0]
+			t.Dequeue(node)
+			fn(node, li)
+		}
+	}
+}
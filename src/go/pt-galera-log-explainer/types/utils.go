@@ -2,8 +2,6 @@ package types
 
 import (
 	"time"
-
-	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
 )
 
 // Identifier is used to identify a node timeline.
@@ -16,10 +14,10 @@ func Identifier(logCtx LogCtx, date time.Time) string {
 		return logCtx.OwnNames[len(logCtx.OwnNames)-1]
 	}
 	if len(logCtx.OwnIPs) > 0 {
-		return translate.SimplestInfoFromIP(logCtx.OwnIPs[len(logCtx.OwnIPs)-1], date)
+		return logCtx.DB().SimplestInfoFromIP(logCtx.OwnIPs[len(logCtx.OwnIPs)-1], date)
 	}
 	for _, hash := range logCtx.OwnHashes {
-		if out := translate.SimplestInfoFromHash(hash, date); out != hash {
+		if out := logCtx.DB().SimplestInfoFromHash(hash, date); out != hash {
 			return out
 		}
 	}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
+	"github.com/pkg/errors"
+)
+
+type views struct {
+	Paths []string   `arg:"" name:"paths" help:"paths of the log to use"`
+	At    *time.Time `help:"Only show the views in effect at this date, format: 2023-01-23T03:53:40Z (RFC3339)"`
+	Json  bool       `help:"Output views as json"`
+}
+
+func (v *views) Help() string {
+	return fmt.Sprintf(`Reconstruct every Galera view with its full membership, primary status and the reason of the transition
+
+Members are translated to node names and IPs using every given logs.
+The same view seen from several nodes will only be listed once.
+
+Usage:
+	%[1]s views <list of files>
+	%[1]s views --at 2023-03-12T19:40:00Z *.log
+	%[1]s views --json *.log
+	`, toolname)
+}
+
+const (
+	viewReasonBootstrap = "bootstrap"
+	viewReasonJoin      = "join"
+	viewReasonLeave     = "leave"
+	viewReasonSuspect   = "suspect"
+	viewReasonPartition = "partition"
+
+	// a node suspected within this window before a view change is considered to be the cause of it
+	// it is wider than the default evs.suspect_timeout+evs.inactive_timeout
+	viewSuspectWindow = time.Minute
+)
+
+// view blocks are logged on multiple lines, so they cannot be handled like the other regexes
+//
+//	view (view_id(PRIM,0509936f-8cc2,9)
+//	memb {
+//		0509936f-8cc2,0
+//		}
+//	joined {
+//		}
+//	...
+//	)
+var (
+	regexViewID      = regexp.MustCompile("^view \\(view_id\\((?P<type>PRIM|NON_PRIM),(?P<uuid>[^,]+),(?P<seqno>[0-9]+)\\)")
+	regexViewEmpty   = regexp.MustCompile("^view \\(\\(empty\\)\\)")
+	regexViewSection = regexp.MustCompile("^(?P<section>memb|joined|left|partitioned) {")
+	regexViewMember  = regexp.MustCompile("^\\t(?P<uuid>[^,\\s]+),(?P<segment>[0-9]+)")
+)
+
+type viewMember struct {
+	UUID    string `json:"uuid"`
+	Name    string `json:"name,omitempty"`
+	IP      string `json:"ip,omitempty"`
+	Segment int    `json:"segment"`
+}
+
+func (m viewMember) String() string {
+	name := m.Name
+	if name == "" {
+		name = m.UUID
+	}
+	details := []string{}
+	if m.IP != "" && m.IP != name {
+		details = append(details, m.IP)
+	}
+	details = append(details, "segment "+strconv.Itoa(m.Segment))
+	return name + " (" + strings.Join(details, ", ") + ")"
+}
+
+type galeraView struct {
+	ID          string       `json:"id"` // representative uuid and sequence number, as printed in view_id
+	Primary     bool         `json:"primary"`
+	Members     []viewMember `json:"members"`
+	Joined      []viewMember `json:"joined,omitempty"`
+	Left        []viewMember `json:"left,omitempty"`
+	Partitioned []viewMember `json:"partitioned,omitempty"`
+	Reasons     []string     `json:"reasons,omitempty"`
+	FirstSeen   time.Time    `json:"firstSeen"`
+	LastSeen    time.Time    `json:"lastSeen"`
+	ReportedBy  []string     `json:"reportedBy"`
+}
+
+func (gv *galeraView) key() string {
+	uuids := []string{}
+	for _, member := range gv.Members {
+		uuids = append(uuids, member.UUID)
+	}
+	sort.Strings(uuids)
+	return strconv.FormatBool(gv.Primary) + "/" + gv.ID + "/" + strings.Join(uuids, ",")
+}
+
+func (gv *galeraView) MemberNames() []string {
+	names := []string{}
+	for _, member := range gv.Members {
+		if member.Name != "" {
+			names = append(names, member.Name)
+		} else {
+			names = append(names, member.UUID)
+		}
+	}
+	return names
+}
+
+// viewObservation is a view as logged by a single node at a given time
+// view is nil when the node left every view ("view ((empty))")
+type viewObservation struct {
+	node string
+	date time.Time
+	view *galeraView
+}
+
+func (v *views) Run() error {
+
+	timeline, err := timelineFromPaths(v.Paths, regex.AllRegexes())
+	if err != nil {
+		return errors.Wrap(err, "could not reconstruct views")
+	}
+
+	nodeByPath := map[string]string{}
+	clockByPath := map[string]*types.FileClock{}
+	for node, localTimeline := range timeline {
+		for _, li := range localTimeline {
+			nodeByPath[li.LogCtx.FilePath] = node
+			clockByPath[li.LogCtx.FilePath] = li.LogCtx.Clock
+		}
+	}
+
+	observations := []viewObservation{}
+	for _, path := range v.Paths {
+		node, ok := nodeByPath[path]
+		if !ok {
+			node = path
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		fileObservations, err := viewObservationsFromLog(f, node, clockByPath[path], CLI.Since, CLI.Until)
+		f.Close()
+		if err != nil {
+			return errors.Wrapf(err, "could not read views from %s", path)
+		}
+		observations = append(observations, fileObservations...)
+	}
+
+	galeraViews := mergeViewObservations(observations, suspectsFromTimeline(timeline), departuresFromTimeline(timeline), timeline.DB())
+
+	if v.At != nil {
+		return printViewsAt(galeraViews, observations, *v.At, v.Json)
+	}
+
+	if v.Json {
+		return printViewsJSON(galeraViews)
+	}
+
+	if len(galeraViews) == 0 {
+		fmt.Println("No view found")
+		return nil
+	}
+	for _, gv := range galeraViews {
+		printView(gv)
+	}
+	return nil
+}
+
+// viewObservationsFromLog parses every view block from a log
+// blocks dated outside of since and until are ignored, both can be nil
+func viewObservationsFromLog(r io.Reader, node string, clock *types.FileClock, since, until *time.Time) ([]viewObservation, error) {
+	parser := &viewParser{node: node, clock: clock, since: since, until: until}
+	err := iterateLogLines(r, parser.parseLine)
+	return parser.observations, err
+}
+
+// viewParser is a line by line state machine, as view blocks are not dated and span multiple lines
+// the date used is the latest found before the block
+type viewParser struct {
+	node         string
+	clock        *types.FileClock
+	since, until *time.Time
+	date         time.Time
+	current      *galeraView
+	section      string
+	observations []viewObservation
+}
+
+func (p *viewParser) parseLine(line string) {
+	if t, layout, ok := regex.SearchDateFromLog(line); ok {
+		p.date = p.clock.Adjust(t, layout)
+	}
+
+	switch {
+	case regexViewEmpty.MatchString(line):
+		p.observe(nil)
+
+	case regexViewID.MatchString(line):
+		submatches := regexViewID.FindStringSubmatch(line)
+		p.current = &galeraView{
+			ID:      submatches[regexViewID.SubexpIndex("uuid")] + "," + submatches[regexViewID.SubexpIndex("seqno")],
+			Primary: submatches[regexViewID.SubexpIndex("type")] == "PRIM",
+		}
+		p.section = ""
+
+	case p.current == nil:
+
+	case regexViewSection.MatchString(line):
+		p.section = regexViewSection.FindStringSubmatch(line)[1]
+
+	case regexViewMember.MatchString(line):
+		submatches := regexViewMember.FindStringSubmatch(line)
+		segment, _ := strconv.Atoi(submatches[2])
+		member := viewMember{UUID: utils.UUIDToShortUUID(submatches[1]), Segment: segment}
+		switch p.section {
+		case "memb":
+			p.current.Members = append(p.current.Members, member)
+		case "joined":
+			p.current.Joined = append(p.current.Joined, member)
+		case "left":
+			p.current.Left = append(p.current.Left, member)
+		case "partitioned":
+			p.current.Partitioned = append(p.current.Partitioned, member)
+		}
+
+	case strings.HasPrefix(line, ")"):
+		p.observe(p.current)
+		p.current = nil
+	}
+}
+
+// observe filters views the same way the timeline is filtered by --since and --until
+func (p *viewParser) observe(view *galeraView) {
+	if (p.since != nil && p.since.After(p.date)) || (p.until != nil && p.until.Before(p.date)) {
+		return
+	}
+	p.observations = append(p.observations, viewObservation{node: p.node, date: p.date, view: view})
+}
+
+type suspicion struct {
+	uuid string
+	date time.Time
+}
+
+func suspectsFromTimeline(timeline types.Timeline) []suspicion {
+	suspects := []suspicion{}
+	internalRegex := regex.ViewsMap["RegexNodeSuspect"].InternalRegex
+	for _, localTimeline := range timeline {
+		for _, li := range localTimeline {
+			if li.RegexUsed != "RegexNodeSuspect" || li.Date == nil {
+				continue
+			}
+			submatches := internalRegex.FindStringSubmatch(li.Log)
+			if submatches == nil {
+				continue
+			}
+			suspects = append(suspects, suspicion{uuid: utils.UUIDToShortUUID(submatches[internalRegex.SubexpIndex("uuid")]), date: li.Date.Time})
+		}
+	}
+	return suspects
+}
+
+// departure is a node leaving the group by itself: on shutdown, or when a joiner gives up
+type departure struct {
+	node string
+	date time.Time
+}
+
+func departuresFromTimeline(timeline types.Timeline) []departure {
+	departures := []departure{}
+	for node, localTimeline := range timeline {
+		for _, li := range localTimeline {
+			if li.Date == nil {
+				continue
+			}
+			switch li.RegexUsed {
+			case "RegexSelfLeave", "RegexShutdownSignal":
+				departures = append(departures, departure{node: node, date: li.Date.Time})
+			}
+		}
+	}
+	return departures
+}
+
+// isSelfLeave returns whether a non-primary view was only logged by nodes leaving by themselves around that time
+// a leaving node always ends up alone in a non-primary view, this is not a partition
+func isSelfLeave(gv *galeraView, departures []departure) bool {
+	if gv.Primary {
+		return false
+	}
+	for _, node := range gv.ReportedBy {
+		departed := false
+		for _, d := range departures {
+			if d.node == node && absDuration(gv.FirstSeen.Sub(d.date)) <= viewSuspectWindow {
+				departed = true
+				break
+			}
+		}
+		if !departed {
+			return false
+		}
+	}
+	return true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// mergeViewObservations deduplicates views seen by several nodes, resolves their members identities
+// and finds the reasons of each transition, comparing with the previous view when Galera did not tell
+func mergeViewObservations(observations []viewObservation, suspects []suspicion, departures []departure, db *translate.DB) []*galeraView {
+
+	byKey := map[string]*galeraView{}
+	galeraViews := []*galeraView{}
+	for _, obs := range observations {
+		if obs.view == nil {
+			continue
+		}
+		gv, ok := byKey[obs.view.key()]
+		if !ok {
+			gv = &galeraView{ID: obs.view.ID, Primary: obs.view.Primary, Members: obs.view.Members, FirstSeen: obs.date, LastSeen: obs.date}
+			byKey[obs.view.key()] = gv
+			galeraViews = append(galeraViews, gv)
+		}
+		gv.Joined = appendMissingMembers(gv.Joined, obs.view.Joined)
+		gv.Left = appendMissingMembers(gv.Left, obs.view.Left)
+		gv.Partitioned = appendMissingMembers(gv.Partitioned, obs.view.Partitioned)
+		if obs.date.Before(gv.FirstSeen) {
+			gv.FirstSeen = obs.date
+		}
+		if obs.date.After(gv.LastSeen) {
+			gv.LastSeen = obs.date
+		}
+		if !utils.SliceContains(gv.ReportedBy, obs.node) {
+			gv.ReportedBy = append(gv.ReportedBy, obs.node)
+		}
+	}
+
+	sort.SliceStable(galeraViews, func(i, j int) bool {
+		return galeraViews[i].FirstSeen.Before(galeraViews[j].FirstSeen)
+	})
+
+	// members of self-leave views left on purpose, the other nodes may still see them as partitioned
+	leaving := []suspicion{}
+	selfLeaves := map[*galeraView]bool{}
+	for _, gv := range galeraViews {
+		sort.Strings(gv.ReportedBy)
+		if isSelfLeave(gv, departures) {
+			selfLeaves[gv] = true
+			for _, member := range gv.Members {
+				leaving = append(leaving, suspicion{uuid: member.UUID, date: gv.FirstSeen})
+			}
+		}
+	}
+
+	for i, gv := range galeraViews {
+		var previous *galeraView
+		if i > 0 {
+			previous = galeraViews[i-1]
+		}
+		if selfLeaves[gv] {
+			gv.Reasons = []string{viewReasonLeave}
+		} else {
+			gv.Reasons = viewReasons(gv, previous, suspects, leaving)
+		}
+
+		for _, members := range [][]viewMember{gv.Members, gv.Joined, gv.Left, gv.Partitioned} {
+			resolveViewMembers(members, gv.FirstSeen, db)
+		}
+		sort.SliceStable(gv.Members, func(i, j int) bool {
+			return gv.Members[i].String() < gv.Members[j].String()
+		})
+	}
+	return galeraViews
+}
+
+func appendMissingMembers(members, toAdd []viewMember) []viewMember {
+	for _, member := range toAdd {
+		if !containsMember(members, member.UUID) {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+func containsMember(members []viewMember, uuid string) bool {
+	for _, member := range members {
+		if member.UUID == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+func resolveViewMembers(members []viewMember, date time.Time, db *translate.DB) {
+	for i := range members {
+		members[i].IP = db.GetIPFromHash(members[i].UUID)
+		if name := db.SimplestInfoFromHash(members[i].UUID, date); name != members[i].UUID && name != members[i].IP {
+			members[i].Name = name
+		}
+	}
+}
+
+// viewReasons explains a view transition, leaving are the nodes that left by themselves
+// Galera lists them as partitioned when they did not finish leaving before the view change
+func viewReasons(gv, previous *galeraView, suspects, leaving []suspicion) []string {
+	// the first view of a new cluster: comparing with whatever was seen before would be meaningless
+	if gv.Primary && strings.HasSuffix(gv.ID, ",1") && len(gv.Joined) == 0 && len(gv.Left) == 0 && len(gv.Partitioned) == 0 {
+		return []string{viewReasonBootstrap}
+	}
+
+	joined, left := gv.Joined, gv.Left
+	partitioned := []viewMember{}
+	for _, member := range gv.Partitioned {
+		if isLeaving(leaving, member.UUID, gv.FirstSeen) {
+			left = append(left, member)
+		} else {
+			partitioned = append(partitioned, member)
+		}
+	}
+
+	reasons := []string{}
+	if len(partitioned) > 0 || !gv.Primary {
+		reasons = append(reasons, viewReasonPartition)
+	}
+
+	// Galera only lists the difference with the previous view it installed itself,
+	// a node joining an existing cluster will have both empty
+	// uuids are compared, so a restarted node is seen as leaving and joining again
+	if len(joined) == 0 && len(left) == 0 && len(gv.Partitioned) == 0 && previous != nil {
+		for _, member := range gv.Members {
+			if !containsMember(previous.Members, member.UUID) {
+				joined = append(joined, member)
+			}
+		}
+		for _, member := range previous.Members {
+			if !containsMember(gv.Members, member.UUID) {
+				left = append(left, member)
+			}
+		}
+	}
+
+	if len(joined) > 0 {
+		reasons = append(reasons, viewReasonJoin)
+	}
+	if len(left) > 0 {
+		reasons = append(reasons, viewReasonLeave)
+	}
+
+	for _, suspect := range suspects {
+		if suspect.date.After(gv.FirstSeen) || gv.FirstSeen.Sub(suspect.date) > viewSuspectWindow {
+			continue
+		}
+		if containsMember(left, suspect.uuid) || containsMember(partitioned, suspect.uuid) {
+			reasons = append(reasons, viewReasonSuspect)
+			break
+		}
+	}
+	return reasons
+}
+
+func isLeaving(leaving []suspicion, uuid string, date time.Time) bool {
+	for _, l := range leaving {
+		if l.uuid == uuid && absDuration(date.Sub(l.date)) <= viewSuspectWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// viewsAt returns the views in effect at a given date, according to the latest view each node logged before it
+func viewsAt(galeraViews []*galeraView, observations []viewObservation, at time.Time) []*galeraView {
+	latestByNode := map[string]viewObservation{}
+	for _, obs := range observations {
+		if obs.date.After(at) {
+			continue
+		}
+		if latest, ok := latestByNode[obs.node]; !ok || !obs.date.Before(latest.date) {
+			latestByNode[obs.node] = obs
+		}
+	}
+
+	inEffect := map[string]bool{}
+	for _, obs := range latestByNode {
+		if obs.view != nil {
+			inEffect[obs.view.key()] = true
+		}
+	}
+
+	filtered := []*galeraView{}
+	for _, gv := range galeraViews {
+		if inEffect[gv.key()] {
+			filtered = append(filtered, gv)
+		}
+	}
+	return filtered
+}
+
+func printViewsAt(galeraViews []*galeraView, observations []viewObservation, at time.Time, asJSON bool) error {
+	filtered := viewsAt(galeraViews, observations, at)
+	if asJSON {
+		return printViewsJSON(filtered)
+	}
+
+	primaryFound := false
+	for _, gv := range filtered {
+		if gv.Primary {
+			primaryFound = true
+			fmt.Printf("primary component at %s: %s\n", at.Format(time.RFC3339Nano), strings.Join(gv.MemberNames(), ", "))
+		}
+	}
+	if !primaryFound {
+		fmt.Printf("no primary component known at %s\n", at.Format(time.RFC3339Nano))
+	}
+	for _, gv := range filtered {
+		fmt.Println()
+		printView(gv)
+	}
+	return nil
+}
+
+func printViewsJSON(galeraViews []*galeraView) error {
+	out, err := json.MarshalIndent(galeraViews, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal views")
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func printView(gv *galeraView) {
+	status := utils.Paint(utils.GreenText, "PRIMARY")
+	if !gv.Primary {
+		status = utils.Paint(utils.RedText, "NON-PRIMARY")
+	}
+	reasons := "?"
+	if len(gv.Reasons) > 0 {
+		reasons = strings.Join(gv.Reasons, ", ")
+	}
+
+	fmt.Printf("view %s %s\n", gv.ID, status)
+	fmt.Printf("\tfirst seen:  %s\n", gv.FirstSeen.Format(time.RFC3339Nano))
+	fmt.Printf("\treason:      %s\n", reasons)
+	fmt.Printf("\tmembers:     %s\n", joinViewMembers(gv.Members))
+	if len(gv.Joined) > 0 {
+		fmt.Printf("\tjoined:      %s\n", joinViewMembers(gv.Joined))
+	}
+	if len(gv.Left) > 0 {
+		fmt.Printf("\tleft:        %s\n", joinViewMembers(gv.Left))
+	}
+	if len(gv.Partitioned) > 0 {
+		fmt.Printf("\tpartitioned: %s\n", joinViewMembers(gv.Partitioned))
+	}
+	fmt.Printf("\treported by: %s\n", strings.Join(gv.ReportedBy, ", "))
+}
+
+func joinViewMembers(members []viewMember) string {
+	s := []string{}
+	for _, member := range members {
+		s = append(s, member.String())
+	}
+	return strings.Join(s, ", ")
+}
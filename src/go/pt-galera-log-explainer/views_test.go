@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
+)
+
+func TestViewObservationsFromLog(t *testing.T) {
+	plain := `2023-03-12T19:35:06.376551Z 0 [Note] [MY-000000] [Galera] Current view of cluster as seen by this node
+view (view_id(PRIM,0509936f-8cc2,9)
+memb {
+	0509936f-8cc2,0
+	7026494c-a649,1
+	}
+joined {
+	7026494c-a649,1
+	}
+left {
+	}
+partitioned {
+	}
+)
+2023-03-12T19:36:48.590096Z 3 [Note] [MY-000000] [Galera] Current view of cluster as seen by this node
+view ((empty))
+`
+	operator := `{"log":"2024-02-09T10:45:04.720653Z 0 [Note] [MY-000000] [Galera] Current view of cluster as seen by this node\nview (view_id(NON_PRIM,213e9b53-8c4d,2)\nmemb {\n\t213e9b53-8c4d,0\n\t}\njoined {\n\t}\nleft {\n\t}\npartitioned {\n\t486b248f-8ac6,0\n\t}\n)\n","file":"/var/lib/mysql/mysqld-error.log"}
+`
+
+	observations, err := viewObservationsFromLog(strings.NewReader(plain), "node1", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(observations) != 2 {
+		t.Fatalf("expected 2 observations, got %d: %v", len(observations), observations)
+	}
+	view := observations[0].view
+	if view == nil || view.ID != "0509936f-8cc2,9" || !view.Primary || len(view.Members) != 2 || len(view.Joined) != 1 {
+		t.Errorf("unexpected view: %+v", view)
+	}
+	if view.Members[1].UUID != "7026494c-a649" || view.Members[1].Segment != 1 {
+		t.Errorf("unexpected member: %+v", view.Members[1])
+	}
+	if !observations[0].date.Equal(time.Date(2023, 3, 12, 19, 35, 6, 376551000, time.UTC)) {
+		t.Errorf("unexpected date: %s", observations[0].date)
+	}
+	if observations[1].view != nil {
+		t.Errorf("expected an empty view, got %+v", observations[1].view)
+	}
+
+	observations, err = viewObservationsFromLog(strings.NewReader(operator), "node0", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(observations) != 1 || observations[0].view == nil {
+		t.Fatalf("expected 1 view, got %v", observations)
+	}
+	view = observations[0].view
+	if view.Primary || view.ID != "213e9b53-8c4d,2" || len(view.Members) != 1 || len(view.Partitioned) != 1 || view.Partitioned[0].UUID != "486b248f-8ac6" {
+		t.Errorf("unexpected view: %+v", view)
+	}
+
+	since := time.Date(2023, 3, 12, 19, 36, 0, 0, time.UTC)
+	observations, err = viewObservationsFromLog(strings.NewReader(plain), "node1", nil, &since, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(observations) != 1 || observations[0].view != nil {
+		t.Errorf("expected only the empty view after --since, got %v", observations)
+	}
+	observations, err = viewObservationsFromLog(strings.NewReader(plain), "node1", nil, nil, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(observations) != 1 || observations[0].view == nil {
+		t.Errorf("expected only the first view before --until, got %v", observations)
+	}
+}
+
+func TestMergeViewObservations(t *testing.T) {
+	db := translate.NewDB()
+
+	date := func(min int) time.Time {
+		return time.Date(2023, 3, 12, 10, min, 0, 0, time.UTC)
+	}
+	db.AddHashToNodeName("aaaaaaaa-0001", "node1", date(0))
+	db.AddHashToNodeName("bbbbbbbb-0002", "node2", date(0))
+
+	node1, node2 := viewMember{UUID: "aaaaaaaa-0001"}, viewMember{UUID: "bbbbbbbb-0002"}
+	observations := []viewObservation{
+		{node: "node1", date: date(1), view: &galeraView{ID: "aaaaaaaa-0001,1", Primary: true, Members: []viewMember{node1}}},
+		{node: "node1", date: date(2), view: &galeraView{ID: "aaaaaaaa-0001,2", Primary: true, Members: []viewMember{node1, node2}, Joined: []viewMember{node2}}},
+		{node: "node2", date: date(2), view: &galeraView{ID: "aaaaaaaa-0001,2", Primary: true, Members: []viewMember{node1, node2}}},
+		{node: "node2", date: date(5), view: &galeraView{ID: "aaaaaaaa-0001,2", Primary: false, Members: []viewMember{node2}, Partitioned: []viewMember{node1}}},
+		{node: "node1", date: date(6)},
+	}
+	suspects := []suspicion{{uuid: "aaaaaaaa-0001", date: date(4)}}
+
+	galeraViews := mergeViewObservations(observations, suspects, nil, db)
+	expected := []struct {
+		id         string
+		primary    bool
+		reasons    string
+		members    string
+		reportedBy string
+	}{
+		{id: "aaaaaaaa-0001,1", primary: true, reasons: "bootstrap", members: "node1", reportedBy: "node1"},
+		{id: "aaaaaaaa-0001,2", primary: true, reasons: "join", members: "node1,node2", reportedBy: "node1,node2"},
+		{id: "aaaaaaaa-0001,2", primary: false, reasons: "partition,suspect", members: "node2", reportedBy: "node2"},
+	}
+	if len(galeraViews) != len(expected) {
+		t.Fatalf("expected %d views, got %d", len(expected), len(galeraViews))
+	}
+	for i, e := range expected {
+		gv := galeraViews[i]
+		if gv.ID != e.id || gv.Primary != e.primary || strings.Join(gv.Reasons, ",") != e.reasons || strings.Join(gv.MemberNames(), ",") != e.members || strings.Join(gv.ReportedBy, ",") != e.reportedBy {
+			t.Errorf("view %d: expected %+v, got %+v", i, e, gv)
+		}
+	}
+
+	inEffect := viewsAt(galeraViews, observations, date(3))
+	if len(inEffect) != 1 || inEffect[0] != galeraViews[1] {
+		t.Errorf("expected only the 2nd view to be in effect, got %v", inEffect)
+	}
+	inEffect = viewsAt(galeraViews, observations, date(7))
+	if len(inEffect) != 1 || inEffect[0] != galeraViews[2] {
+		t.Errorf("expected only the non-primary view to be in effect, got %v", inEffect)
+	}
+}
+
+func TestMergeViewObservationsSelfLeave(t *testing.T) {
+	db := translate.NewDB()
+
+	date := func(sec int) time.Time {
+		return time.Date(2023, 3, 12, 10, 0, sec, 0, time.UTC)
+	}
+	node1, node2 := viewMember{UUID: "aaaaaaaa-0001"}, viewMember{UUID: "bbbbbbbb-0002"}
+	observations := []viewObservation{
+		{node: "node1", date: date(1), view: &galeraView{ID: "aaaaaaaa-0001,2", Primary: true, Members: []viewMember{node1, node2}}},
+		{node: "node2", date: date(1), view: &galeraView{ID: "aaaaaaaa-0001,2", Primary: true, Members: []viewMember{node1, node2}}},
+		// node2 shuts down, node1 did not receive its leave message in time and sees it as partitioned
+		{node: "node2", date: date(20), view: &galeraView{ID: "aaaaaaaa-0001,2", Primary: false, Members: []viewMember{node2}, Partitioned: []viewMember{node1}}},
+		{node: "node1", date: date(21), view: &galeraView{ID: "aaaaaaaa-0001,3", Primary: true, Members: []viewMember{node1}, Partitioned: []viewMember{node2}}},
+	}
+	departures := []departure{{node: "node2", date: date(10)}, {node: "node2", date: date(20)}}
+
+	galeraViews := mergeViewObservations(observations, nil, departures, db)
+	if len(galeraViews) != 3 {
+		t.Fatalf("expected 3 views, got %d", len(galeraViews))
+	}
+	for i, expected := range []string{"leave", "leave"} {
+		if reasons := strings.Join(galeraViews[i+1].Reasons, ","); reasons != expected {
+			t.Errorf("view %d: expected reasons %q, got %q", i+1, expected, reasons)
+		}
+	}
+
+	galeraViews = mergeViewObservations(observations, nil, nil, db)
+	for i, expected := range []string{"partition", "partition"} {
+		if reasons := strings.Join(galeraViews[i+1].Reasons, ","); reasons != expected {
+			t.Errorf("without departures, view %d: expected reasons %q, got %q", i+1, expected, reasons)
+		}
+	}
+}
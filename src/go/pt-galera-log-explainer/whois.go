@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/regex"
-	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/translate"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/types"
 	"github.com/percona/percona-toolkit/src/go/pt-galera-log-explainer/utils"
 	"github.com/pkg/errors"
@@ -48,15 +47,16 @@ func (w *whois) Run() error {
 		}
 	}
 
-	_, err := timelineFromPaths(CLI.Whois.Paths, regex.AllRegexes())
+	timeline, err := timelineFromPaths(CLI.Whois.Paths, regex.AllRegexes())
 	if err != nil {
 		return errors.Wrap(err, "found nothing to translate")
 	}
+	db := timeline.DB()
 
 	if w.SearchType == "auto" {
-		if translate.IsNodeUUIDKnown(w.Search) {
+		if db.IsNodeUUIDKnown(w.Search) {
 			w.SearchType = "uuid"
-		} else if translate.IsNodeNameKnown(w.Search) {
+		} else if db.IsNodeNameKnown(w.Search) {
 			w.SearchType = "nodename"
 		} else {
 			return errors.New("could not detect the type of input. Try to provide --type. It may means the info is unknown")
@@ -64,7 +64,7 @@ func (w *whois) Run() error {
 	}
 
 	if CLI.Verbosity == types.Debug {
-		out, err := translate.DBToJson()
+		out, err := db.ToJson()
 		if err != nil {
 			return errors.Wrap(err, "could not dump translation structs to json")
 		}
@@ -73,7 +73,7 @@ func (w *whois) Run() error {
 
 	log.Debug().Str("searchType", w.SearchType).Msg("whois searchType")
 
-	out := translate.Whois(w.Search, w.SearchType)
+	out := db.Whois(w.Search, w.SearchType)
 
 	if w.Json {
 		json, err := json.MarshalIndent(out, "", "\t")
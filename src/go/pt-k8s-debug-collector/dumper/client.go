@@ -0,0 +1,343 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	"sigs.k8s.io/yaml"
+)
+
+// perconaGroupRe matches API groups of Percona operators, the group prefix is the resource type: pxc.percona.com
+var perconaGroupRe = regexp.MustCompile(`^(\w+)\.percona\.com$`)
+
+// apiResource is a resource found with discovery
+type apiResource struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+}
+
+// connect creates clients from the kubeconfig, the same way kubectl would find it
+// clients which are already set are kept, so that tests can use fake ones
+func (d *Dumper) connect() error {
+	if d.clientset != nil && d.dynamic != nil {
+		return nil
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if d.kubeconfig != "" {
+		rules.ExplicitPath = d.kubeconfig
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return errors.Wrap(err, "load kubeconfig")
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "create clientset")
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "create dynamic client")
+	}
+
+	d.restConfig = config
+	d.clientset = clientset
+	d.dynamic = dynamicClient
+	return nil
+}
+
+// discoverResources indexes every resource the server knows by plural, singular and short names,
+// using the preferred version of each group
+// It also returns the resources of Percona operators, and the type of the last operator found
+func (d *Dumper) discoverResources() (map[string]apiResource, []string, string, error) {
+	groups, lists, err := d.clientset.Discovery().ServerGroupsAndResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, nil, "", errors.Wrap(err, "discover API resources")
+	}
+
+	preferred := map[string]string{}
+	for _, group := range groups {
+		preferred[group.Name] = group.PreferredVersion.GroupVersion
+	}
+
+	var (
+		percona []string
+		crType  string
+	)
+	index := map[string]apiResource{}
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		if version, ok := preferred[gv.Group]; ok && version != "" && version != list.GroupVersion {
+			continue
+		}
+		// pods and nodes of metrics.k8s.io must not shadow core ones
+		if gv.Group == podMetricsGVR.Group {
+			continue
+		}
+		match := perconaGroupRe.FindStringSubmatch(gv.Group)
+
+		for _, r := range list.APIResources {
+			// subresources, such as pods/log
+			if strings.Contains(r.Name, "/") {
+				continue
+			}
+			res := apiResource{gvr: gv.WithResource(r.Name), namespaced: r.Namespaced}
+
+			names := append([]string{r.Name, r.SingularName}, r.ShortNames...)
+			for _, name := range names {
+				if _, ok := index[name]; !ok && name != "" {
+					index[name] = res
+				}
+			}
+
+			if match != nil {
+				percona = append(percona, r.Name)
+				crType = match[1]
+			}
+		}
+	}
+	return index, percona, crType, nil
+}
+
+// loadResources discovers resources once, it must be called before workers share the index
+func (d *Dumper) loadResources() error {
+	if d.apiResources != nil {
+		return nil
+	}
+	index, _, _, err := d.discoverResources()
+	if err != nil {
+		return err
+	}
+	d.apiResources = index
+	return nil
+}
+
+// resourceFor resolves a resource name as kubectl would: plural, singular or short name
+func (d *Dumper) resourceFor(name string) (apiResource, error) {
+	if err := d.loadResources(); err != nil {
+		return apiResource{}, err
+	}
+	res, ok := d.apiResources[name]
+	if !ok {
+		return apiResource{}, errors.Errorf("the server doesn't have a resource type %q", name)
+	}
+	return res, nil
+}
+
+func (d *Dumper) resourceInterface(res apiResource, namespace string) dynamic.ResourceInterface {
+	if res.namespaced && namespace != "" {
+		return d.dynamic.Resource(res.gvr).Namespace(namespace)
+	}
+	return d.dynamic.Resource(res.gvr)
+}
+
+// getYAML fetches objects as "kubectl get -o yaml" would print them
+// name is either a resource type to list, or "type/name" to get a single object
+// found is false for missing objects
+func (d *Dumper) getYAML(ctx context.Context, name, namespace string) ([]byte, bool, error) {
+	content, found, err := d.getContent(ctx, name, namespace)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	output, err := yaml.Marshal(content)
+	return output, true, err
+}
+
+// getJSON is getYAML, in json
+func (d *Dumper) getJSON(ctx context.Context, name, namespace string) ([]byte, bool, error) {
+	content, found, err := d.getContent(ctx, name, namespace)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	output, err := json.Marshal(content)
+	return output, true, err
+}
+
+func (d *Dumper) getContent(ctx context.Context, name, namespace string) (interface{}, bool, error) {
+	resource, objectName, single := strings.Cut(name, "/")
+	res, err := d.resourceFor(resource)
+	if err != nil {
+		return nil, false, err
+	}
+	client := d.resourceInterface(res, namespace)
+
+	if single {
+		obj, err := client.Get(ctx, objectName, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return obj.Object, true, nil
+	}
+
+	list, err := client.List(ctx, d.listOptions(resource))
+	if err != nil {
+		return nil, false, err
+	}
+	if isPodResource(resource) {
+		list.Items = d.clusterItems(list.Items)
+	}
+	items := make([]interface{}, 0, len(list.Items))
+	for _, item := range list.Items {
+		items = append(items, item.Object)
+	}
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+		"metadata":   map[string]interface{}{"resourceVersion": ""},
+	}, true, nil
+}
+
+// podLogs returns logs of every containers, init containers first, like "kubectl logs --all-containers"
+func (d *Dumper) podLogs(ctx context.Context, pod corev1.Pod) ([]byte, error) {
+	var out bytes.Buffer
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		logs, err := d.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: container.Name, SinceSeconds: d.sinceSeconds()}).DoRaw(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get logs of container %s", container.Name)
+		}
+		out.Write(logs)
+	}
+	return out.Bytes(), nil
+}
+
+// defaultContainer is the container kubectl would use when none is given
+func defaultContainer(pod *corev1.Pod) string {
+	if name := pod.Annotations["kubectl.kubernetes.io/default-container"]; name != "" {
+		return name
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return ""
+}
+
+// execInPod runs command in a container, like "kubectl exec"
+// anything written to stderr is considered an error
+func (d *Dumper) execInPod(ctx context.Context, namespace, podName, container string, command []string, stdin io.Reader) ([]byte, error) {
+	stdout, stderr, err := d.streamInPod(ctx, namespace, podName, container, command, stdin)
+	if err != nil || len(stderr) > 0 {
+		return nil, errors.Errorf("error: %v, stderr: %s, stdout: %s", err, stderr, stdout)
+	}
+	return stdout, nil
+}
+
+// streamInPod runs command in a container, and returns both its stdout and stderr
+// the default container is used when container is empty
+func (d *Dumper) streamInPod(ctx context.Context, namespace, podName, container string, command []string, stdin io.Reader) ([]byte, []byte, error) {
+	if d.restConfig == nil {
+		return nil, nil, errors.New("exec in pods requires a connection to the cluster")
+	}
+	if container == "" {
+		pod, err := d.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "get pod")
+		}
+		container = defaultContainer(pod)
+	}
+
+	req := d.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(d.restConfig, http.MethodPost, req.URL())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create executor")
+	}
+
+	var outb, errb bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: &outb,
+		Stderr: &errb,
+	})
+	return outb.Bytes(), errb.Bytes(), err
+}
+
+// portForward forwards ports ("local:remote", or ":remote" for any free local port) to a pod, like "kubectl port-forward"
+// it returns the local port once forwarding is ready, the returned function stops it
+func (d *Dumper) portForward(ctx context.Context, namespace, podName, ports string) (string, func(), error) {
+	if d.restConfig == nil {
+		return "", nil, errors.New("port-forward requires a connection to the cluster")
+	}
+	transport, upgrader, err := spdy.RoundTripperFor(d.restConfig)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "create round tripper")
+	}
+	req := d.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	var errOut bytes.Buffer
+	fw, err := portforward.NewOnAddresses(dialer, []string{"localhost"}, []string{ports}, stop, ready, io.Discard, &errOut)
+	if err != nil {
+		// same format as failures of the forwarding itself, and of the summary tools, written to summary.txt
+		return "", nil, errors.Errorf("error: create port forwarder: %v, stderr: %s", err, errOut.String())
+	}
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- fw.ForwardPorts()
+	}()
+
+	select {
+	case <-ready:
+	case err := <-failed:
+		return "", nil, errors.Errorf("error: %v, stderr: %s", err, errOut.String())
+	case <-ctx.Done():
+		close(stop)
+		return "", nil, errors.Wrap(ctx.Err(), "wait for port-forward")
+	case <-time.After(30 * time.Second):
+		close(stop)
+		return "", nil, errors.New("timed out waiting for port-forward")
+	}
+
+	forwarded, err := fw.GetPorts()
+	if err != nil || len(forwarded) == 0 {
+		close(stop)
+		return "", nil, errors.Errorf("get forwarded port: %v", err)
+	}
+	return strconv.Itoa(int(forwarded[0].Local)), func() { close(stop) }, nil
+}
@@ -2,49 +2,142 @@ package dumper
 
 import (
 	"archive/tar"
-	"bytes"
 	"compress/gzip"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 // Dumper struct is for dumping cluster
 type Dumper struct {
-	cmd           string
 	kubeconfig    string
 	resources     []string
-	filePaths     []string
+	filePaths     []podFile
 	fileContainer string
 	namespace     string
 	location      string
-	errors        string
 	mode          int64
 	crType        string
 	forwardport   string
+	maxFileSize   int64
+	summaryMode   string
+	cluster       string
+	selector      string
+	since         time.Duration
+	maxSize       int64
+
+	excludeNamespaces map[string]bool
+	// report is the analysis of collected data
+	report *report
+	// pgGather replaces the bundled PostgreSQL summary when set
+	pgGather []byte
+
+	// concurrency is the number of workers, timeout applies to each request and deadline to the whole dump
+	concurrency int
+	timeout     time.Duration
+	deadline    time.Duration
+
+	// archive is set when dumping
+	archive *archive
+	// redactor is nil when redaction is disabled
+	redactor *redactor
+	// summaries forwarding the same local port can not run at the same time
+	forwardMu *sync.Mutex
+
+	// clients are created when dumping, unless already set
+	restConfig   *rest.Config
+	clientset    kubernetes.Interface
+	dynamic      dynamic.Interface
+	apiResources map[string]apiResource
 }
 
-var resourcesRe = regexp.MustCompile(`(\w+)\.(\w+).percona\.com`)
+// Defaults for SetConcurrency
+const (
+	DefaultConcurrency = 4
+	DefaultTimeout     = 5 * time.Minute
+)
 
 // New return new Dumper object
+// With --resource=auto, the resource type is discovered when dumping
+// resource can be followed by a cluster name, such as pxc/cluster1, to collect only this cluster
 func New(location, namespace, resource string, kubeconfig string, forwardport string) Dumper {
 	d := Dumper{
-		cmd:         "kubectl",
 		kubeconfig:  kubeconfig,
 		location:    "cluster-dump",
 		mode:        int64(0o777),
 		namespace:   namespace,
 		forwardport: forwardport,
+		concurrency: DefaultConcurrency,
+		timeout:     DefaultTimeout,
+		maxFileSize: DefaultMaxFileSize,
+		summaryMode: SummaryExec,
+		forwardMu:   &sync.Mutex{},
+		redactor:    newRedactor(nil),
+	}
+	if crType, cluster, ok := strings.Cut(resource, "/"); ok {
+		resource, d.cluster = crType, cluster
+	}
+	d.setResource(resource, nil)
+	return d
+}
+
+// SetRedaction enables or disables redaction of secrets and credentials in the archive
+// Keys in allow, such as a secret data key or a field name, are never redacted
+func (d *Dumper) SetRedaction(enabled bool, allow []string) {
+	d.redactor = nil
+	if enabled {
+		d.redactor = newRedactor(allow)
+	}
+}
+
+// SetSummary sets how summaries of database pods are collected, SummaryExec or SummaryPortForward
+// pgGather, when not nil, is the pg_gather script run instead of the bundled one
+func (d *Dumper) SetSummary(mode string, pgGather []byte) error {
+	if mode != SummaryExec && mode != SummaryPortForward {
+		return errors.Errorf("unknown summary mode %q, supported modes: %s, %s", mode, SummaryExec, SummaryPortForward)
+	}
+	d.summaryMode = mode
+	d.pgGather = pgGather
+	return d.checkSummaryMode()
+}
+
+// checkSummaryMode rejects port-forward for PostgreSQL, pg_gather is only run in the database pod
+// auto-detected resources are checked once detected
+func (d *Dumper) checkSummaryMode() error {
+	if rt := resourceType(d.crType); d.summaryMode == SummaryPortForward && (rt == "pg" || rt == "pgv2") {
+		return errors.Errorf("--summary-mode=%s is not supported for PostgreSQL, its summaries are collected with --summary-mode=%s", SummaryPortForward, SummaryExec)
 	}
+	return nil
+}
+
+// SetMaxFileSize sets the size limit of each file copied from pods, in bytes. 0 means no limit
+func (d *Dumper) SetMaxFileSize(size int64) {
+	d.maxFileSize = size
+}
+
+// SetConcurrency sets the number of workers collecting data, the timeout of each request
+// and the deadline of the whole dump. Zero durations mean no limit
+func (d *Dumper) SetConcurrency(workers int, timeout, deadline time.Duration) {
+	d.concurrency = workers
+	d.timeout = timeout
+	d.deadline = deadline
+}
+
+// setResource sets resources and files to collect for a resource type
+// crResources replaces the builtin list of custom resources for the type when not nil
+func (d *Dumper) setResource(resource string, crResources []string) {
 	resources := []string{
 		"pods",
 		"replicasets",
@@ -64,22 +157,9 @@ func New(location, namespace, resource string, kubeconfig string, forwardport st
 		"persistentvolumeclaims",
 		"persistentvolumes",
 	}
+	base := len(resources)
 
-	switch resource {
-	case "auto":
-		result, err := d.runCmd("api-resources", "-o", "name")
-		if err != nil {
-			log.Panicf("Cannot get API resources and option --resource=auto specified:\n%s", err)
-		}
-		matches := resourcesRe.FindAllStringSubmatch(string(result), -1)
-		if len(matches) == 0 {
-			resource = "none"
-			break
-		}
-		for _, match := range matches {
-			resources = append(resources, match[1])
-			resource = match[2]
-		}
+	switch resourceType(resource) {
 	case "pg":
 		resources = append(resources,
 			"perconapgclusters",
@@ -113,36 +193,57 @@ func New(location, namespace, resource string, kubeconfig string, forwardport st
 			"perconaservermongodbs",
 		)
 	}
-	filePaths := make([]string, 0)
-	if resourceType(resource) == "pxc" {
-		filePaths = append(filePaths,
-			"var/lib/mysql/mysqld-error.log",
-			"var/lib/mysql/innobackup.backup.log",
-			"var/lib/mysql/innobackup.move.log",
-			"var/lib/mysql/innobackup.prepare.log",
-			"var/lib/mysql/grastate.dat",
-			"var/lib/mysql/gvwstate.dat",
-			"var/lib/mysql/mysqld.post.processing.log",
-			"var/lib/mysql/auto.cnf",
-		)
-		d.fileContainer = "logs"
+	if crResources != nil {
+		resources = append(resources[:base], crResources...)
 	}
 	d.resources = resources
 	d.crType = resource
-	d.filePaths = filePaths
-	return d
-}
-
-type k8sPods struct {
-	Items []corev1.Pod `json:"items"`
+	d.fileContainer, d.filePaths = podFiles(resource)
 }
 
-type namespaces struct {
-	Items []corev1.Namespace `json:"items"`
+// detectResource replaces --resource=auto by the type of the Percona operator found in the cluster
+func (d *Dumper) detectResource() error {
+	index, perconaResources, crType, err := d.discoverResources()
+	if err != nil {
+		return errors.Wrap(err, "cannot get API resources and option --resource=auto specified")
+	}
+	d.apiResources = index
+	if len(perconaResources) == 0 {
+		d.setResource("none", nil)
+		return nil
+	}
+	d.setResource(crType, perconaResources)
+	return nil
 }
 
 // DumpCluster create dump of a cluster in Dumper.location
+// Data is collected by concurrent workers, each request with its own timeout, until the overall deadline if any
 func (d *Dumper) DumpCluster() error {
+	ctx := context.Background()
+	if d.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.deadline)
+		defer cancel()
+	}
+
+	err := d.connect()
+	if err != nil {
+		return errors.Wrap(err, "connect to cluster")
+	}
+	if resourceType(d.crType) == "auto" {
+		err = d.detectResource()
+		if err != nil {
+			return err
+		}
+	}
+	err = d.loadResources()
+	if err != nil {
+		return errors.Wrap(err, "discover API resources")
+	}
+	if err := d.checkSummaryMode(); err != nil {
+		return err
+	}
+
 	file, err := os.Create(d.location + ".tar.gz")
 	if err != nil {
 		return errors.Wrap(err, "create tar file")
@@ -150,11 +251,29 @@ func (d *Dumper) DumpCluster() error {
 
 	zr := gzip.NewWriter(file)
 	tw := tar.NewWriter(zr)
+	d.archive = &archive{tw: tw, mode: d.mode, redactor: d.redactor, maxSize: d.maxSize}
+	d.report = newReport(resourceType(d.crType))
 	defer func() {
-		err = addToArchive(d.location+"/errors.txt", d.mode, []byte(d.errors), tw)
+		// the report and manifests are always added, whatever the size limit
+		d.archive.maxSize = 0
+		d.writeReport()
+		err = d.archive.add(d.location+"/errors.txt", []byte(d.archive.errors.String()))
 		if err != nil {
 			log.Println("Error: add errors.txt to archive:", err)
 		}
+		if len(d.archive.skipped) > 0 {
+			log.Printf("The archive reached its size limit, %d files were skipped", len(d.archive.skipped))
+			err = addToArchive(d.location+"/skipped.txt", d.mode, skippedContent(d.maxSize, d.archive.skipped), tw)
+			if err != nil {
+				log.Println("Error: add skipped.txt to archive:", err)
+			}
+		}
+		if d.redactor != nil {
+			err = addToArchive(d.location+"/redactions.txt", d.mode, d.redactor.manifestContent(), tw)
+			if err != nil {
+				log.Println("Error: add redactions.txt to archive:", err)
+			}
+		}
 
 		err = tw.Close()
 		if err != nil {
@@ -173,148 +292,227 @@ func (d *Dumper) DumpCluster() error {
 		}
 	}()
 
-	var nss namespaces
+	p := newPool(ctx, d.concurrency, d.timeout, d.archive)
+
+	nss := &corev1.NamespaceList{}
 
 	if len(d.namespace) > 0 {
 		ns := corev1.Namespace{}
 		ns.Name = d.namespace
 		nss.Items = append(nss.Items, ns)
 	} else {
-		args := []string{"get", "namespaces", "-o", "json"}
-		output, err := d.runCmd(args...)
+		reqCtx, cancel := p.withTimeout()
+		nss, err = d.clientset.CoreV1().Namespaces().List(reqCtx, metav1.ListOptions{})
+		cancel()
 		if err != nil {
-			d.logError(err.Error(), args...)
+			d.logError(err.Error(), "get", "namespaces")
 			return errors.Wrap(err, "get namespaces")
 		}
+	}
 
-		err = json.Unmarshal(output, &nss)
-		if err != nil {
-			d.logError(err.Error(), "unmarshal namespaces")
-			return errors.Wrap(err, "unmarshal namespaces")
-		}
+	metrics := d.metricsAvailable()
+	if !metrics {
+		log.Println("metrics.k8s.io is not available, resource usage of pods will not be collected")
+	}
+
+	reqCtx, cancel := p.withTimeout()
+	operators, err := d.operatorVersions(reqCtx)
+	cancel()
+	if err != nil {
+		d.logError(err.Error(), "get", "deployments", "--all-namespaces")
+		d.report.addError("get operator versions: " + err.Error())
 	}
 
 	for _, ns := range nss.Items {
-		args := []string{"get", "pods", "-o", "json", "--namespace", ns.Name}
-		output, err := d.runCmd(args...)
-		if err != nil {
-			d.logError(err.Error(), args...)
+		if d.excludeNamespaces[ns.Name] && ns.Name != d.namespace {
 			continue
 		}
-
-		var pods k8sPods
-		err = json.Unmarshal(output, &pods)
+		reqCtx, cancel := p.withTimeout()
+		pods, err := d.clientset.CoreV1().Pods(ns.Name).List(reqCtx, d.listOptions("pods"))
+		cancel()
 		if err != nil {
-			d.logError(err.Error(), "unmarshal pods from namespace", ns.Name)
-			log.Printf("Error: unmarshal pods in namespace %s: %v", ns.Name, err)
+			d.logError(err.Error(), "get", "pods", "--namespace", ns.Name)
+			continue
+		}
+		pods.Items = d.clusterPods(pods.Items)
+		if d.scoped() && len(pods.Items) == 0 {
+			continue
 		}
 
 		for _, pod := range pods.Items {
-			location := filepath.Join(d.location, ns.Name, pod.Name, "logs.txt")
-			args := []string{"logs", pod.Name, "--namespace", ns.Name, "--all-containers"}
-			output, err = d.runCmd(args...)
-			if err != nil {
-				d.logError(err.Error(), args...)
-				err = addToArchive(location, d.mode, []byte(err.Error()), tw)
-				if err != nil {
-					log.Printf("Error: create archive with logs for pod %s in namespace %s: %v", pod.Name, ns.Name, err)
-				}
-				continue
-			}
-			err = addToArchive(location, d.mode, output, tw)
-			if err != nil {
-				d.logError(err.Error(), "create archive for pod "+pod.Name)
-				log.Printf("Error: create archive for pod %s: %v", pod.Name, err)
-			}
-			if len(pod.Labels) == 0 {
-				continue
-			}
-			location = filepath.Join(d.location, ns.Name, pod.Name, "/summary.txt")
-			component := resourceType(d.crType)
-			if component == "psmdb" {
-				component = "mongod"
-			}
-			if component == "ps" {
-				component = "mysql"
-			}
-			if pod.Labels["app.kubernetes.io/instance"] != "" && pod.Labels["app.kubernetes.io/component"] != "" {
-				resource := "secret/" + pod.Labels["app.kubernetes.io/instance"] + "-" + pod.Labels["app.kubernetes.io/component"]
-				err = d.getResource(resource, ns.Name, true, tw)
+			d.collectPod(p, pod, metrics)
+		}
+
+		namespace := ns.Name
+		d.report.addPods(pods.Items)
+		p.run("analyze namespace "+namespace, func(ctx context.Context) {
+			d.analyzeNamespace(ctx, namespace, pods.Items, operators)
+		})
+		d.collectFile(p, filepath.Join(d.location, namespace, "events-timeline.txt"), func(ctx context.Context) ([]byte, error) {
+			return d.eventsTimeline(ctx, namespace)
+		}, "get", "events", "--namespace", namespace, "--sort-by=lastTimestamp")
+
+		for _, resource := range d.resources {
+			resource, namespace := resource, ns.Name
+			p.run("get "+resource+" --namespace "+namespace, func(ctx context.Context) {
+				err := d.getResource(ctx, resource, namespace, false)
 				if err != nil {
 					log.Printf("Error: get %s resource: %v", resource, err)
 				}
-			}
-			if pod.Labels["app.kubernetes.io/component"] == component ||
-				(component == "pg" && pod.Labels["pgo-pg-database"] == "true") ||
-				(component == "pgv2" && pod.Labels["pgv2.percona.com/version"] != "" && pod.Labels["postgres-operator.crunchydata.com/instance"] != "") {
-				var crName string
-				if component == "pg" {
-					crName = pod.Labels["pg-cluster"]
-				} else if component == "pgv2" {
-					crName = pod.Labels["postgres-operator.crunchydata.com/cluster"]
-				} else {
-					crName = pod.Labels["app.kubernetes.io/instance"]
-				}
-				// Get summary
-				output, err = d.getPodSummary(resourceType(d.crType), pod.Name, crName, ns.Name, tw)
-				if err != nil {
-					d.logError(err.Error(), d.crType, pod.Name)
-					err = addToArchive(location, d.mode, []byte(err.Error()), tw)
-					if err != nil {
-						log.Printf("Error: create summary errors archive for pod %s in namespace %s: %v", pod.Name, ns.Name, err)
-					}
-				} else {
-					err = addToArchive(location, d.mode, output, tw)
-					if err != nil {
-						d.logError(err.Error(), "create summary archive for pod "+pod.Name)
-						log.Printf("Error: create summary  archive for pod %s: %v", pod.Name, err)
-					}
-				}
+			})
+		}
+	}
 
-				// get individual Logs
-				location = filepath.Join(d.location, ns.Name, pod.Name)
-				for _, path := range d.filePaths {
-					err = d.getIndividualFiles(ns.Name, pod.Name, path, location, tw)
-					if err != nil {
-						d.logError(err.Error(), "get file "+path+" for pod "+pod.Name)
-						log.Printf("Error: get %s file: %v", path, err)
-					}
-				}
-			}
+	var nodesErr error
+	p.run("get nodes", func(ctx context.Context) {
+		nodesErr = d.getResource(ctx, "nodes", "", false)
+	})
+	p.wait()
+	if nodesErr != nil {
+		return errors.Wrapf(nodesErr, "get nodes")
+	}
+
+	return nil
+}
+
+// collectFile queues get, its output is added to the archive at location
+// on errors, they are logged under args, and written at location instead
+func (d *Dumper) collectFile(p *pool, location string, get func(ctx context.Context) ([]byte, error), args ...string) {
+	p.run(strings.Join(args, " "), func(ctx context.Context) {
+		output, err := get(ctx)
+		if err != nil {
+			d.logError(err.Error(), args...)
+			output = []byte(err.Error())
+		}
+		err = d.archive.add(location, output)
+		if err != nil {
+			log.Printf("Error: add %s to archive: %v", location, err)
 		}
+	})
+}
 
-		for _, resource := range d.resources {
-			err = d.getResource(resource, ns.Name, false, tw)
+// collectPod queues the collection of logs, status, metrics, summary and files of a pod
+// previous logs are collected for every restarted container, metrics only when available
+func (d *Dumper) collectPod(p *pool, pod corev1.Pod, metrics bool) {
+	ns := pod.Namespace
+	args := []string{"logs", pod.Name, "--namespace", ns, "--all-containers"}
+	p.run(strings.Join(args, " "), func(ctx context.Context) {
+		location := filepath.Join(d.location, ns, pod.Name, "logs.txt")
+		output, err := d.podLogs(ctx, pod)
+		if err != nil {
+			d.logError(err.Error(), args...)
+			err = d.archive.add(location, []byte(err.Error()))
 			if err != nil {
-				log.Printf("Error: get %s resource: %v", resource, err)
+				log.Printf("Error: create archive with logs for pod %s in namespace %s: %v", pod.Name, ns, err)
 			}
+			return
+		}
+		err = d.archive.add(location, output)
+		if err != nil {
+			d.logError(err.Error(), "create archive for pod "+pod.Name)
+			log.Printf("Error: create archive for pod %s: %v", pod.Name, err)
 		}
+	})
+
+	for _, container := range restartedContainers(pod) {
+		container := container
+		d.collectFile(p, filepath.Join(d.location, ns, pod.Name, "previous-logs-"+container+".txt"), func(ctx context.Context) ([]byte, error) {
+			return d.previousLogs(ctx, pod, container)
+		}, "logs", pod.Name, "--namespace", ns, "-c", container, "--previous")
 	}
 
-	err = d.getResource("nodes", "", false, tw)
+	err := d.archive.add(filepath.Join(d.location, ns, pod.Name, "containers.txt"), containerStatuses(pod))
 	if err != nil {
-		return errors.Wrapf(err, "get nodes")
+		log.Printf("Error: add container statuses of pod %s to archive: %v", pod.Name, err)
 	}
 
-	return nil
-}
+	if metrics {
+		d.collectFile(p, filepath.Join(d.location, ns, pod.Name, "metrics.txt"), func(ctx context.Context) ([]byte, error) {
+			return d.podMetrics(ctx, pod)
+		}, "top", "pod", pod.Name, "--namespace", ns, "--containers")
+	}
 
-// runCmd run command (Dumper.cmd) with given args, return it output
-func (d *Dumper) runCmd(args ...string) ([]byte, error) {
-	var outb, errb bytes.Buffer
-	args = append(args, "--kubeconfig", d.kubeconfig)
-	cmd := exec.Command(d.cmd, args...)
-	cmd.Stdout = &outb
-	cmd.Stderr = &errb
-	err := cmd.Run()
-	if err != nil || errb.Len() > 0 {
-		return nil, errors.Errorf("error: %v, stderr: %s, stdout: %s", err, errb.String(), outb.String())
+	if len(pod.Labels) == 0 {
+		return
+	}
+	component := resourceType(d.crType)
+	if component == "psmdb" {
+		component = "mongod"
+	}
+	if component == "ps" {
+		component = "mysql"
 	}
+	if pod.Labels["app.kubernetes.io/instance"] != "" && pod.Labels["app.kubernetes.io/component"] != "" {
+		resource := "secret/" + pod.Labels["app.kubernetes.io/instance"] + "-" + pod.Labels["app.kubernetes.io/component"]
+		p.run("get "+resource+" --namespace "+ns, func(ctx context.Context) {
+			err := d.getResource(ctx, resource, ns, true)
+			if err != nil {
+				log.Printf("Error: get %s resource: %v", resource, err)
+			}
+		})
+	}
+	if pod.Labels["app.kubernetes.io/component"] == component ||
+		(component == "pg" && pod.Labels["pgo-pg-database"] == "true") ||
+		(component == "pgv2" && pod.Labels["pgv2.percona.com/version"] != "" && pod.Labels["postgres-operator.crunchydata.com/instance"] != "") {
+		var crName string
+		if component == "pg" {
+			crName = pod.Labels["pg-cluster"]
+		} else if component == "pgv2" {
+			crName = pod.Labels["postgres-operator.crunchydata.com/cluster"]
+		} else {
+			crName = pod.Labels["app.kubernetes.io/instance"]
+		}
+		// Get summary
+		p.run("summary "+pod.Name+" --namespace "+ns, func(ctx context.Context) {
+			location := filepath.Join(d.location, ns, pod.Name, "/summary.txt")
+			output, err := d.getPodSummary(ctx, resourceType(d.crType), pod.Name, crName, ns)
+			if err != nil {
+				d.logError(err.Error(), d.crType, pod.Name)
+				err = d.archive.add(location, []byte(err.Error()))
+				if err != nil {
+					log.Printf("Error: create summary errors archive for pod %s in namespace %s: %v", pod.Name, ns, err)
+				}
+				return
+			}
+			err = d.archive.add(location, output)
+			if err != nil {
+				d.logError(err.Error(), "create summary archive for pod "+pod.Name)
+				log.Printf("Error: create summary  archive for pod %s: %v", pod.Name, err)
+			}
+		})
+
+		// get individual Logs
+		location := filepath.Join(d.location, ns, pod.Name)
+		for _, file := range d.filePaths {
+			file := file
+			p.run("get file "+file.path+" for pod "+pod.Name, func(ctx context.Context) {
+				err := d.getIndividualFiles(ctx, ns, pod.Name, file, location)
+				if err != nil {
+					d.logError(err.Error(), "get file "+file.path+" for pod "+pod.Name)
+					log.Printf("Error: get %s file: %v", file.path, err)
+				}
+			})
+		}
+	}
+}
 
-	return outb.Bytes(), nil
+// writeReport adds the analysis of collected data to the archive, as report.md and report.json
+func (d *Dumper) writeReport() {
+	d.report.sort()
+	err := d.archive.add(d.location+"/report.md", d.report.markdown())
+	if err != nil {
+		log.Println("Error: add report.md to archive:", err)
+	}
+	content, err := d.report.json()
+	if err == nil {
+		err = d.archive.add(d.location+"/report.json", content)
+	}
+	if err != nil {
+		log.Println("Error: add report.json to archive:", err)
+	}
 }
 
-func (d *Dumper) getResource(name, namespace string, ignoreNotFound bool, tw *tar.Writer) error {
+func (d *Dumper) getResource(ctx context.Context, name, namespace string, ignoreNotFound bool) error {
 	location := d.location
 	args := []string{"get", name, "-o", "yaml"}
 	if ignoreNotFound {
@@ -325,21 +523,24 @@ func (d *Dumper) getResource(name, namespace string, ignoreNotFound bool, tw *ta
 		location = filepath.Join(d.location, namespace)
 	}
 	location = filepath.Join(location, name+".yaml")
-	output, err := d.runCmd(args...)
+	output, found, err := d.getYAML(ctx, name, namespace)
+	if err == nil && !found && !ignoreNotFound {
+		err = errors.Errorf("%s not found", name)
+	}
 	if err != nil {
 		d.logError(err.Error(), args...)
 		log.Printf("Error: get resource %s in namespace %s: %v", name, namespace, err)
-		return addToArchive(location, d.mode, []byte(err.Error()), tw)
+		return d.archive.add(location, []byte(err.Error()))
 	}
 
-	if ignoreNotFound && len(output) == 0 {
+	if !found {
 		return nil
 	}
-	return addToArchive(location, d.mode, output, tw)
+	return d.archive.add(location, output)
 }
 
 func (d *Dumper) logError(err string, args ...string) {
-	d.errors += d.cmd + " " + strings.Join(args, " ") + "\n" + err + "\n\n"
+	d.archive.logError(err, args...)
 }
 
 func addToArchive(location string, mode int64, content []byte, tw *tar.Writer) error {
@@ -372,118 +573,12 @@ type crSecrets struct {
 	} `json:"spec"`
 }
 
-func (d *Dumper) getIndividualFiles(namespace string, podName, path, location string, tw *tar.Writer) error {
-	if len(d.fileContainer) == 0 {
-		return errors.Errorf("Logs container name is not specified for resource %s in namespace %s", resourceType(d.crType), d.namespace)
-	}
-	args := []string{"-n", namespace, "-c", d.fileContainer, "cp", podName + ":" + path, "/dev/stdout"}
-	output, err := d.runCmd(args...)
-	if err != nil {
-		d.logError(err.Error(), args...)
-		log.Printf("Error: get path %s for resource %s in namespace %s: %v", path, resourceType(d.crType), d.namespace, err)
-		return addToArchive(location, d.mode, []byte(err.Error()), tw)
-	}
-
-	if len(output) == 0 {
-		return nil
-	}
-	return addToArchive(location+"/"+path, d.mode, output, tw)
-}
-
-func (d *Dumper) getPodSummary(resource, podName, crName string, namespace string, tw *tar.Writer) ([]byte, error) {
-	var (
-		summCmdName string
-		ports       string
-		summCmdArgs []string
-	)
-
-	switch resource {
-	case "ps":
-		fallthrough
-	case "pxc":
-		var pass, port string
-		if d.forwardport != "" {
-			port = d.forwardport
-		} else {
-			port = "3306"
-		}
-		cr, err := d.getCR(resource+"/"+crName, namespace)
-		if err != nil {
-			return nil, errors.Wrap(err, "get cr")
-		}
-		if cr.Spec.SecretName != "" {
-			pass, err = d.getDataFromSecret(cr.Spec.SecretName, "root", namespace)
-		} else {
-			pass, err = d.getDataFromSecret(crName+"-secrets", "root", namespace)
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "get password from pxc users secret")
-		}
-		ports = port + ":3306"
-		summCmdName = "pt-mysql-summary"
-		summCmdArgs = []string{"--host=127.0.0.1", "--port=" + port, "--user=root", "--password='" + string(pass) + "'"}
-	case "pg","pgv2":
-		var kubeconfig string=""
-		if d.kubeconfig != "" { 
-			kubeconfig=" --kubeconfig=" + d.kubeconfig 
-		}
-		summCmdName = "sh"
-		summCmdArgs = []string{"-c", "curl https://raw.githubusercontent.com/percona/support-snippets/master/postgresql/pg_gather/gather.sql 2>/dev/null | " +
-			d.cmd + kubeconfig + " -n "+ namespace + " exec -i "+ podName +" -- psql -X -f - "}
-	case "psmdb":
-		var port string
-		if d.forwardport != "" {
-			port = d.forwardport
-		} else {
-			port = "27017"
-		}
-		cr, err := d.getCR("psmdb/"+crName, namespace)
-		if err != nil {
-			return nil, errors.Wrap(err, "get cr")
-		}
-		user, err := d.getDataFromSecret(cr.Spec.Secrets.Users, "MONGODB_DATABASE_ADMIN_USER", namespace)
-		if err != nil {
-			return nil, errors.Wrap(err, "get password from psmdb users secret")
-		}
-		pass, err := d.getDataFromSecret(cr.Spec.Secrets.Users, "MONGODB_DATABASE_ADMIN_PASSWORD", namespace)
-		if err != nil {
-			return nil, errors.Wrap(err, "get password from psmdb users secret")
-		}
-		ports = port + ":27017"
-		summCmdName = "pt-mongodb-summary"
-		summCmdArgs = []string{"--username='" + user + "'", "--password='" + pass + "'", "--authenticationDatabase=admin", "127.0.0.1:" + port}
-	}
-
-	cmdPortFwd := exec.Command(d.cmd, "port-forward", "pod/"+podName, ports, "-n", namespace, "--kubeconfig", d.kubeconfig)
-	go func() {
-		err := cmdPortFwd.Run()
-		if err != nil {
-			d.logError(err.Error(), "port-forward")
-		}
-	}()
-	defer func() {
-		err := cmdPortFwd.Process.Kill()
-		if err != nil {
-			d.logError(err.Error(), "kill port-forward")
-		}
-	}()
-
-	time.Sleep(3 * time.Second) // wait for port-forward command
-
-	var outb, errb bytes.Buffer
-	cmd := exec.Command(summCmdName, summCmdArgs...)
-	cmd.Stdout = &outb
-	cmd.Stderr = &errb
-	err := cmd.Run()
-	if err != nil {
-		return nil, errors.Errorf("error: %v\nstderr: %sstdout: %s", err, errb.String(), outb.String())
-	}
-	return outb.Bytes(), nil
-}
-
-func (d *Dumper) getCR(crName string, namespace string) (crSecrets, error) {
+func (d *Dumper) getCR(ctx context.Context, crName string, namespace string) (crSecrets, error) {
 	var cr crSecrets
-	output, err := d.runCmd("get", crName, "-o", "json", "-n", namespace)
+	output, found, err := d.getJSON(ctx, crName, namespace)
+	if err == nil && !found {
+		err = errors.New("not found")
+	}
 	if err != nil {
 		return cr, errors.Wrap(err, "get "+crName)
 	}
@@ -495,17 +590,18 @@ func (d *Dumper) getCR(crName string, namespace string) (crSecrets, error) {
 	return cr, nil
 }
 
-func (d *Dumper) getDataFromSecret(secretName, dataName string, namespace string) (string, error) {
-	passEncoded, err := d.runCmd("get", "secrets/"+secretName, "--template={{.data."+dataName+"}}", "-n", namespace)
+func (d *Dumper) getDataFromSecret(ctx context.Context, secretName, dataName string, namespace string) (string, error) {
+	secret, err := d.clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
-		return "", errors.Wrap(err, "run get secret cmd")
+		return "", errors.Wrap(err, "get secret")
 	}
-	pass, err := base64.StdEncoding.DecodeString(string(passEncoded))
-	if err != nil {
-		return "", errors.Wrap(err, "decode data")
+
+	data, ok := secret.Data[dataName]
+	if !ok {
+		return "", errors.Errorf("no %s in secret %s", dataName, secretName)
 	}
 
-	return string(pass), nil
+	return string(data), nil
 }
 
 func resourceType(s string) string {
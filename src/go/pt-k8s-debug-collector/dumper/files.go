@@ -0,0 +1,133 @@
+package dumper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxFileSize is the default size limit of each file copied from pods
+const DefaultMaxFileSize = 100 * 1024 * 1024
+
+// podFile is a file to copy from pods, relative to /
+// path can be a shell pattern, such as pgdata/pg*/log/*.log, matching several files
+// Files larger than the size limit are truncated to their end, binary files can not be: they are skipped instead
+type podFile struct {
+	path   string
+	binary bool
+}
+
+// podFiles returns the container to copy files from, and the files collected for a resource type
+func podFiles(resource string) (string, []podFile) {
+	switch resourceType(resource) {
+	case "pxc":
+		return "logs", []podFile{
+			{path: "var/lib/mysql/mysqld-error.log"},
+			{path: "var/lib/mysql/innobackup.backup.log"},
+			{path: "var/lib/mysql/innobackup.move.log"},
+			{path: "var/lib/mysql/innobackup.prepare.log"},
+			{path: "var/lib/mysql/grastate.dat"},
+			{path: "var/lib/mysql/gvwstate.dat"},
+			{path: "var/lib/mysql/mysqld.post.processing.log"},
+			{path: "var/lib/mysql/auto.cnf"},
+		}
+	case "ps":
+		return "mysql", []podFile{
+			{path: "var/lib/mysql/mysqld-error.log"},
+			{path: "var/lib/mysql/*slow*.log"},
+			{path: "var/lib/mysql/auto.cnf"},
+		}
+	case "psmdb":
+		return "mongod", []podFile{
+			{path: "data/db/mongod.log"},
+			{path: "data/db/logs/*.log"},
+			{path: "data/db/diagnostic.data/*", binary: true},
+		}
+	case "pg":
+		return "database", []podFile{
+			{path: "pgdata/*/pg_log/*.log"},
+			{path: "pgdata/*/postgresql.conf"},
+		}
+	case "pgv2":
+		return "database", []podFile{
+			{path: "pgdata/pg*/log/*.log"},
+			{path: "pgdata/pgbackrest/log/*.log"},
+		}
+	}
+	return "", nil
+}
+
+// isPattern tells whether a path has to be expanded by a shell
+func isPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// getIndividualFiles copies file from a pod to location, expanding patterns first
+func (d *Dumper) getIndividualFiles(ctx context.Context, namespace string, podName string, file podFile, location string) error {
+	if len(d.fileContainer) == 0 {
+		return errors.Errorf("Logs container name is not specified for resource %s in namespace %s", resourceType(d.crType), d.namespace)
+	}
+
+	paths := []string{file.path}
+	if isPattern(file.path) {
+		// patterns come from podFiles, they are safe to use unquoted
+		script := "for f in /" + file.path + `; do if [ -f "$f" ]; then echo "$f"; fi; done`
+		args := []string{"-n", namespace, "-c", d.fileContainer, "exec", podName, "--", "sh", "-c", script}
+		output, err := d.execInPod(ctx, namespace, podName, d.fileContainer, []string{"sh", "-c", script}, nil)
+		if err != nil {
+			d.logError(err.Error(), args...)
+			return errors.Wrapf(err, "list %s", file.path)
+		}
+		paths = paths[:0]
+		for _, path := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			if path != "" {
+				paths = append(paths, strings.TrimPrefix(path, "/"))
+			}
+		}
+	}
+
+	for _, path := range paths {
+		err := d.getPodFile(ctx, namespace, podName, path, file.binary, location)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPodFile copies a single file, up to the size limit
+// one more byte than the limit is read to know whether the file is larger
+func (d *Dumper) getPodFile(ctx context.Context, namespace, podName, path string, binary bool, location string) error {
+	command := []string{"cat", "/" + path}
+	if d.maxFileSize > 0 {
+		command = []string{"tail", "-c", strconv.FormatInt(d.maxFileSize+1, 10), "/" + path}
+	}
+	args := append([]string{"-n", namespace, "-c", d.fileContainer, "exec", podName, "--"}, command...)
+	output, err := d.execInPod(ctx, namespace, podName, d.fileContainer, command, nil)
+	if err != nil {
+		d.logError(err.Error(), args...)
+		log.Printf("Error: get path %s for resource %s in namespace %s: %v", path, resourceType(d.crType), namespace, err)
+		return d.archive.add(location+"/"+path, []byte(err.Error()))
+	}
+
+	if d.maxFileSize > 0 && int64(len(output)) > d.maxFileSize {
+		if binary {
+			d.logError(fmt.Sprintf("skipped: larger than %d bytes", d.maxFileSize), args...)
+			return nil
+		}
+		output = output[int64(len(output))-d.maxFileSize:]
+		d.logError(fmt.Sprintf("truncated: only the last %d bytes were kept", d.maxFileSize), args...)
+	}
+
+	if len(output) == 0 {
+		return nil
+	}
+	if binary {
+		return d.archive.addRaw(location+"/"+path, output)
+	}
+	return d.archive.add(location+"/"+path, output)
+}
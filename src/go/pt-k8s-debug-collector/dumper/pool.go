@@ -0,0 +1,121 @@
+package dumper
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archive serializes what concurrent workers write to the tar file and to errors.txt
+// content is redacted before being written, unless redactor is nil
+// Once maxSize bytes were written, files are skipped instead, unless maxSize is 0
+type archive struct {
+	mu       sync.Mutex
+	tw       *tar.Writer
+	mode     int64
+	errors   strings.Builder
+	redactor *redactor
+
+	maxSize int64
+	written int64
+	skipped []skippedFile
+}
+
+func (a *archive) add(location string, content []byte) error {
+	if a.redactor != nil {
+		content = a.redactor.redact(location, content)
+	}
+	return a.addRaw(location, content)
+}
+
+// addRaw adds the content as is, it is meant for binary files the line-based redaction would corrupt
+func (a *archive) addRaw(location string, content []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.maxSize > 0 && a.written+int64(len(content)) > a.maxSize {
+		a.skipped = append(a.skipped, skippedFile{location: location, size: len(content)})
+		return nil
+	}
+	a.written += int64(len(content))
+	return addToArchive(location, a.mode, content, a.tw)
+}
+
+func (a *archive) logError(err string, args ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.errors.WriteString(strings.Join(args, " ") + "\n" + err + "\n\n")
+}
+
+// pool runs tasks with a limited number of workers, each task with its own timeout
+type pool struct {
+	ctx     context.Context
+	timeout time.Duration
+	archive *archive
+	slots   chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newPool(ctx context.Context, concurrency int, timeout time.Duration, a *archive) *pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &pool{
+		ctx:     ctx,
+		timeout: timeout,
+		archive: a,
+		slots:   make(chan struct{}, concurrency),
+	}
+}
+
+// run waits for a free worker, then runs task in the background
+// Tasks are skipped once the pool context is done. Skipped and timed out tasks are recorded in errors.txt under name
+func (p *pool) run(name string, task func(ctx context.Context)) {
+	select {
+	case <-p.ctx.Done():
+	case p.slots <- struct{}{}:
+	}
+	// both cases can be ready, a task must not start once the pool context is done
+	if p.ctx.Err() != nil {
+		p.archive.logError("skipped: "+p.reason(), name)
+		return
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.slots
+			p.wg.Done()
+		}()
+
+		ctx, cancel := p.withTimeout()
+		defer cancel()
+		task(ctx)
+		if ctx.Err() == context.DeadlineExceeded {
+			p.archive.logError("timed out: "+p.reason(), name)
+		}
+	}()
+}
+
+// withTimeout returns a context for a single request
+func (p *pool) withTimeout() (context.Context, context.CancelFunc) {
+	if p.timeout <= 0 {
+		return context.WithCancel(p.ctx)
+	}
+	return context.WithTimeout(p.ctx, p.timeout)
+}
+
+// reason explains why a task did not complete
+func (p *pool) reason() string {
+	if p.ctx.Err() != nil {
+		return "overall deadline reached"
+	}
+	return fmt.Sprintf("request took longer than %s", p.timeout)
+}
+
+// wait returns once every task is done
+func (p *pool) wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,248 @@
+package dumper
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// redactedValue replaces every redacted value
+const redactedValue = "REDACTED"
+
+// sensitiveKeyRe matches keys of structured data holding credentials
+// keys naming or referencing a secret, such as secretName or secretKeyRef, are excluded with nonSensitiveKeyRe
+var (
+	sensitiveKeyRe    = regexp.MustCompile(`(?i)(passw(or)?d|pwd|secret|token|credential|private[_-]?key|api[_-]?key|access[_-]?key|auth[_-]?key)`)
+	nonSensitiveKeyRe = regexp.MustCompile(`(?i)(name|names|ref|path|file|mode)$`)
+)
+
+// textRules redact credentials in logs, summaries, files and configuration strings
+// the first group is kept, the third is redacted, and the fourth, if any, is kept
+var textRules = []struct {
+	name string
+	re   *regexp.Regexp
+	// key is the index of the group holding the key, checked against the allowlist
+	key int
+}{
+	{
+		name: "credential assignment",
+		re:   regexp.MustCompile(`(?i)(([\w.-]*(?:passw(?:or)?d|secret|token|api[_-]?key|access[_-]?key)[\w.-]*)["']?\s*[:=]\s*["']?)([^\s"',;&]+)`),
+		key:  2,
+	},
+	{
+		name: "password option",
+		re:   regexp.MustCompile(`(?i)((--password)[= ]'?)([^\s']+)`),
+		key:  2,
+	},
+	{
+		name: "URI credentials",
+		re:   regexp.MustCompile(`(\b[a-zA-Z][\w+.-]*://[^:/\s@]+:())([^@\s/]+)(@)`),
+		key:  0,
+	},
+}
+
+// redactor removes secrets and credentials from what is added to the archive
+// and records what was redacted
+type redactor struct {
+	// allow holds keys which are never redacted, lowercased
+	allow map[string]bool
+
+	mu       sync.Mutex
+	manifest []redaction
+}
+
+type redaction struct {
+	location string
+	field    string
+	reason   string
+}
+
+func newRedactor(allow []string) *redactor {
+	r := &redactor{allow: map[string]bool{}}
+	for _, key := range allow {
+		if key = strings.TrimSpace(key); key != "" {
+			r.allow[strings.ToLower(key)] = true
+		}
+	}
+	return r
+}
+
+func (r *redactor) allowed(key string) bool {
+	return r.allow[strings.ToLower(key)]
+}
+
+func (r *redactor) record(location, field, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.manifest = append(r.manifest, redaction{location: location, field: field, reason: reason})
+}
+
+// redact returns content without credentials
+// resources dumped as yaml are redacted field by field, anything else line by line
+func (r *redactor) redact(location string, content []byte) []byte {
+	if strings.HasSuffix(location, ".yaml") {
+		var obj interface{}
+		if err := yaml.Unmarshal(content, &obj); err == nil {
+			if !r.redactObject(location, "", obj) {
+				return content
+			}
+			if output, err := yaml.Marshal(obj); err == nil {
+				return output
+			}
+		}
+	}
+
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	changed := false
+	for i, line := range lines {
+		redacted, reasons := r.redactText(string(line))
+		for _, reason := range reasons {
+			r.record(location, "line "+strconv.Itoa(i+1), reason)
+		}
+		if len(reasons) > 0 {
+			lines[i] = []byte(redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return content
+	}
+	return bytes.Join(lines, nil)
+}
+
+// redactText applies textRules, it returns the reasons of every redaction
+func (r *redactor) redactText(s string) (string, []string) {
+	var reasons []string
+	for _, rule := range textRules {
+		s = rule.re.ReplaceAllStringFunc(s, func(match string) string {
+			groups := rule.re.FindStringSubmatch(match)
+			if groups[3] == redactedValue || (rule.key > 0 && (r.allowed(groups[rule.key]) || nonSensitiveKeyRe.MatchString(groups[rule.key]))) {
+				return match
+			}
+			reasons = append(reasons, rule.name)
+			if len(groups) > 4 {
+				return groups[1] + redactedValue + groups[4]
+			}
+			return groups[1] + redactedValue
+		})
+	}
+	return s, reasons
+}
+
+// redactObject redacts obj in place, it returns whether anything was redacted
+// Secrets have every data value redacted. In any object, string values of sensitive keys are redacted,
+// other strings go through textRules, as ConfigMaps and environment variables can hold credentials
+func (r *redactor) redactObject(location, field string, obj interface{}) bool {
+	changed := false
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		isSecret := v["kind"] == "Secret"
+		// environment variables: {name: MYSQL_ROOT_PASSWORD, value: ...}
+		envName, _ := v["name"].(string)
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			path := joinField(field, key)
+			switch {
+			case isSecret && (key == "data" || key == "stringData"):
+				data, ok := v[key].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for dataKey := range data {
+					if r.allowed(dataKey) || data[dataKey] == redactedValue {
+						continue
+					}
+					data[dataKey] = redactedValue
+					r.record(location, joinField(path, dataKey), "secret data")
+					changed = true
+				}
+			case isSecret && key == "metadata":
+				// the last applied configuration holds the whole secret
+				metadata, _ := v[key].(map[string]interface{})
+				annotations, _ := metadata["annotations"].(map[string]interface{})
+				if _, ok := annotations["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+					annotations["kubectl.kubernetes.io/last-applied-configuration"] = redactedValue
+					r.record(location, joinField(path, "annotations.kubectl.kubernetes.io/last-applied-configuration"), "secret data")
+					changed = true
+				}
+				if r.redactObject(location, path, v[key]) {
+					changed = true
+				}
+			default:
+				s, isString := v[key].(string)
+				if !isString {
+					if r.redactObject(location, path, v[key]) {
+						changed = true
+					}
+					continue
+				}
+				if s == redactedValue || s == "" {
+					continue
+				}
+				if key == "value" && r.sensitiveKey(envName) || r.sensitiveKey(key) {
+					v[key] = redactedValue
+					r.record(location, path, "sensitive key")
+					changed = true
+					continue
+				}
+				redacted, reasons := r.redactText(s)
+				for _, reason := range reasons {
+					r.record(location, path, reason)
+				}
+				if len(reasons) > 0 {
+					v[key] = redacted
+					changed = true
+				}
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			if r.redactObject(location, joinField(field, strconv.Itoa(i)), v[i]) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func (r *redactor) sensitiveKey(key string) bool {
+	return sensitiveKeyRe.MatchString(key) && !nonSensitiveKeyRe.MatchString(key) && !r.allowed(key)
+}
+
+func joinField(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+// manifestContent lists redactions, sorted so that concurrent collection does not change it
+func (r *redactor) manifestContent() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.SliceStable(r.manifest, func(i, j int) bool {
+		if r.manifest[i].location != r.manifest[j].location {
+			return r.manifest[i].location < r.manifest[j].location
+		}
+		return r.manifest[i].field < r.manifest[j].field
+	})
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %d values were replaced by %s\n", len(r.manifest), redactedValue)
+	for _, red := range r.manifest {
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", red.location, red.field, red.reason)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,578 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// restartLoopThreshold is the number of restarts from which a container is reported as restarting in a loop
+	restartLoopThreshold = 5
+	// volumeUsageThreshold is the percentage of used capacity from which a volume is reported
+	volumeUsageThreshold = 80
+	// reportedWarnings is the number of most recent warning events in the report
+	reportedWarnings = 20
+)
+
+// operatorImages are the image names of operators, by resource type
+var operatorImages = map[string]string{
+	"pxc":   "percona-xtradb-cluster-operator",
+	"psmdb": "percona-server-mongodb-operator",
+	"ps":    "percona-server-mysql-operator",
+	"pg":    "percona-postgresql-operator",
+	"pgv2":  "percona-postgresql-operator",
+}
+
+// report is the analysis of collected data, written to report.md and report.json at the root of the archive
+// findings are added by concurrent workers
+type report struct {
+	mu sync.Mutex
+
+	GeneratedAt  time.Time          `json:"generatedAt"`
+	Resource     string             `json:"resource"`
+	Clusters     []clusterReport    `json:"clusters"`
+	Pods         []podIssue         `json:"pods"`
+	StatefulSets []statefulSetIssue `json:"statefulSets"`
+	Volumes      []volumeIssue      `json:"volumes"`
+	Warnings     []warningEvent     `json:"warnings"`
+	// Errors are analysis steps which failed, their findings are missing
+	Errors []string `json:"errors,omitempty"`
+}
+
+type clusterReport struct {
+	Namespace       string      `json:"namespace"`
+	Kind            string      `json:"kind"`
+	Name            string      `json:"name"`
+	State           string      `json:"state,omitempty"`
+	CRVersion       string      `json:"crVersion,omitempty"`
+	OperatorVersion string      `json:"operatorVersion,omitempty"`
+	VersionMismatch bool        `json:"versionMismatch"`
+	Conditions      []condition `json:"conditions,omitempty"`
+}
+
+type condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+type podIssue struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+	Issue     string `json:"issue"`
+	Reason    string `json:"reason,omitempty"`
+	Restarts  int32  `json:"restarts,omitempty"`
+}
+
+type statefulSetIssue struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Replicas  int32  `json:"replicas"`
+	Ready     int32  `json:"ready"`
+}
+
+type volumeIssue struct {
+	Namespace   string `json:"namespace"`
+	Claim       string `json:"claim"`
+	Issue       string `json:"issue"`
+	Phase       string `json:"phase"`
+	Capacity    string `json:"capacity,omitempty"`
+	UsedPercent int    `json:"usedPercent,omitempty"`
+}
+
+type warningEvent struct {
+	Namespace string    `json:"namespace"`
+	Time      time.Time `json:"time"`
+	Object    string    `json:"object"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count"`
+}
+
+func newReport(resource string) *report {
+	return &report{
+		GeneratedAt: time.Now().UTC(),
+		Resource:    resource,
+	}
+}
+
+func (r *report) addError(err string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors = append(r.Errors, err)
+}
+
+// addPods reports pods which are not ready, OOM killed containers and containers restarting in a loop
+// completed pods, such as the ones of backup jobs, are ignored
+func (r *report) addPods(pods []corev1.Pod) {
+	var issues []podIssue
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		if reason, ready := podReady(pod); !ready {
+			issues = append(issues, podIssue{Namespace: pod.Namespace, Pod: pod.Name, Issue: "not ready", Reason: reason})
+		}
+		for _, status := range allContainerStatuses(pod) {
+			issue := podIssue{Namespace: pod.Namespace, Pod: pod.Name, Container: status.Name, Restarts: status.RestartCount}
+			if terminatedReason(status) == "OOMKilled" {
+				issue.Issue, issue.Reason = "OOMKilled", containerState(status.LastTerminationState)
+				if status.State.Terminated != nil {
+					issue.Reason = containerState(status.State)
+				}
+				issues = append(issues, issue)
+			}
+			waiting := status.State.Waiting
+			if (waiting != nil && waiting.Reason == "CrashLoopBackOff") || status.RestartCount >= restartLoopThreshold {
+				issue.Issue, issue.Reason = "restart loop", containerState(status.State)
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Pods = append(r.Pods, issues...)
+}
+
+// podReady returns whether a pod is ready, and why it is not
+func podReady(pod corev1.Pod) (string, bool) {
+	for _, c := range pod.Status.Conditions {
+		if c.Type != corev1.PodReady {
+			continue
+		}
+		if c.Status == corev1.ConditionTrue {
+			return "", true
+		}
+		if c.Message != "" {
+			return strings.TrimSpace(c.Reason + ": " + c.Message), false
+		}
+		break
+	}
+
+	var reasons []string
+	for _, status := range allContainerStatuses(pod) {
+		if !status.Ready && status.State.Waiting != nil {
+			reasons = append(reasons, status.Name+": "+status.State.Waiting.Reason)
+		}
+	}
+	if len(reasons) == 0 && pod.Status.Reason != "" {
+		reasons = append(reasons, pod.Status.Reason)
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "phase "+string(pod.Status.Phase))
+	}
+	return strings.Join(reasons, ", "), false
+}
+
+// allContainerStatuses returns statuses of init containers, then of other containers
+func allContainerStatuses(pod corev1.Pod) []corev1.ContainerStatus {
+	statuses := make([]corev1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	return append(statuses, pod.Status.ContainerStatuses...)
+}
+
+func terminatedReason(status corev1.ContainerStatus) string {
+	if status.State.Terminated != nil {
+		return status.State.Terminated.Reason
+	}
+	if status.LastTerminationState.Terminated != nil {
+		return status.LastTerminationState.Terminated.Reason
+	}
+	return ""
+}
+
+// addEvents keeps warning events, only the most recent ones are reported
+func (r *report) addEvents(events []corev1.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, event := range events {
+		if event.Type != corev1.EventTypeWarning {
+			continue
+		}
+		count := event.Count
+		if count == 0 && event.Series != nil {
+			count = event.Series.Count
+		}
+		r.Warnings = append(r.Warnings, warningEvent{
+			Namespace: event.Namespace,
+			Time:      eventTime(event).UTC(),
+			Object:    strings.ToLower(event.InvolvedObject.Kind) + "/" + event.InvolvedObject.Name,
+			Reason:    event.Reason,
+			Message:   strings.TrimSpace(event.Message),
+			Count:     count,
+		})
+	}
+}
+
+// addCluster reports the state and conditions of a cluster custom resource
+// the condition history is kept short: only the last condition of each type is reported
+func (r *report) addCluster(cr unstructured.Unstructured, operatorVersion string) {
+	cluster := clusterReport{
+		Namespace:       cr.GetNamespace(),
+		Kind:            cr.GetKind(),
+		Name:            cr.GetName(),
+		OperatorVersion: operatorVersion,
+	}
+	cluster.CRVersion, _, _ = unstructured.NestedString(cr.Object, "spec", "crVersion")
+	cluster.State, _, _ = unstructured.NestedString(cr.Object, "status", "state")
+	cluster.VersionMismatch = cluster.CRVersion != "" && operatorVersion != "" && cluster.CRVersion != operatorVersion
+
+	conditions, _, _ := unstructured.NestedSlice(cr.Object, "status", "conditions")
+	last := map[string]int{}
+	for _, c := range conditions {
+		fields, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var cond condition
+		cond.Type, _, _ = unstructured.NestedString(fields, "type")
+		cond.Status, _, _ = unstructured.NestedString(fields, "status")
+		cond.Reason, _, _ = unstructured.NestedString(fields, "reason")
+		cond.Message, _, _ = unstructured.NestedString(fields, "message")
+		cond.LastTransitionTime, _, _ = unstructured.NestedString(fields, "lastTransitionTime")
+		if i, ok := last[cond.Type]; ok {
+			cluster.Conditions[i] = cond
+			continue
+		}
+		last[cond.Type] = len(cluster.Conditions)
+		cluster.Conditions = append(cluster.Conditions, cond)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Clusters = append(r.Clusters, cluster)
+}
+
+// volumeStats is the usage of a volume, from the kubelet
+type volumeStats struct {
+	used     uint64
+	capacity uint64
+}
+
+// addVolumes reports claims which are not bound, and volumes used above volumeUsageThreshold
+// usage is indexed by namespace/claim, it is empty when the kubelet could not be queried
+func (r *report) addVolumes(pvcs []corev1.PersistentVolumeClaim, usage map[string]volumeStats) {
+	var issues []volumeIssue
+	for _, pvc := range pvcs {
+		issue := volumeIssue{
+			Namespace: pvc.Namespace,
+			Claim:     pvc.Name,
+			Phase:     string(pvc.Status.Phase),
+		}
+		if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+			issue.Capacity = capacity.String()
+		}
+		if pvc.Status.Phase != corev1.ClaimBound {
+			issue.Issue = "not bound"
+			issues = append(issues, issue)
+			continue
+		}
+		stats, ok := usage[pvc.Namespace+"/"+pvc.Name]
+		if !ok || stats.capacity == 0 {
+			continue
+		}
+		issue.UsedPercent = int(stats.used * 100 / stats.capacity)
+		if issue.UsedPercent >= volumeUsageThreshold {
+			issue.Issue = "near capacity"
+			issues = append(issues, issue)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Volumes = append(r.Volumes, issues...)
+}
+
+// parseVolumeStats reads usage of persistent volumes from a kubelet stats summary
+func parseVolumeStats(summary []byte) (map[string]volumeStats, error) {
+	var stats struct {
+		Pods []struct {
+			Volumes []struct {
+				UsedBytes     uint64 `json:"usedBytes"`
+				CapacityBytes uint64 `json:"capacityBytes"`
+				PVCRef        *struct {
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				} `json:"pvcRef"`
+			} `json:"volume"`
+		} `json:"pods"`
+	}
+	if err := json.Unmarshal(summary, &stats); err != nil {
+		return nil, errors.Wrap(err, "unmarshal stats summary")
+	}
+	usage := map[string]volumeStats{}
+	for _, pod := range stats.Pods {
+		for _, volume := range pod.Volumes {
+			if volume.PVCRef != nil {
+				usage[volume.PVCRef.Namespace+"/"+volume.PVCRef.Name] = volumeStats{used: volume.UsedBytes, capacity: volume.CapacityBytes}
+			}
+		}
+	}
+	return usage, nil
+}
+
+// operatorVersions returns versions of the operators of the resource type, by namespace
+// They are read from the tag of the operator image, such as percona/percona-xtradb-cluster-operator:1.13.0
+func (d *Dumper) operatorVersions(ctx context.Context) (map[string]string, error) {
+	image, ok := operatorImages[resourceType(d.crType)]
+	if !ok {
+		return nil, nil
+	}
+	deployments, err := d.clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list deployments")
+	}
+	versions := map[string]string{}
+	for _, deployment := range deployments.Items {
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			name, tag, ok := strings.Cut(container.Image, ":")
+			if !ok || !strings.HasSuffix(name, "/"+image) && name != image {
+				continue
+			}
+			// such as 1.4.0-postgres-operator, or 2.3.0@sha256:...
+			tag, _, _ = strings.Cut(tag, "@")
+			tag, _, _ = strings.Cut(tag, "-")
+			versions[deployment.Namespace] = tag
+		}
+	}
+	return versions, nil
+}
+
+// operatorVersion returns the version of the operator managing a namespace
+// a cluster-wide operator runs in another namespace, it is used when it is the only one
+func operatorVersion(versions map[string]string, namespace string) string {
+	if version, ok := versions[namespace]; ok {
+		return version
+	}
+	if len(versions) == 1 {
+		for _, version := range versions {
+			return version
+		}
+	}
+	return ""
+}
+
+// analyzeNamespace adds statefulsets, volumes and clusters of a namespace to the report
+// pods are added while collecting them, and warning events with the events timeline
+func (d *Dumper) analyzeNamespace(ctx context.Context, namespace string, pods []corev1.Pod, operators map[string]string) {
+	statefulSets, err := d.clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		d.report.addError(fmt.Sprintf("list statefulsets in namespace %s: %v", namespace, err))
+	} else {
+		var issues []statefulSetIssue
+		for _, sts := range statefulSets.Items {
+			replicas := int32(1)
+			if sts.Spec.Replicas != nil {
+				replicas = *sts.Spec.Replicas
+			}
+			if sts.Status.ReadyReplicas < replicas {
+				issues = append(issues, statefulSetIssue{Namespace: namespace, Name: sts.Name, Replicas: replicas, Ready: sts.Status.ReadyReplicas})
+			}
+		}
+		d.report.mu.Lock()
+		d.report.StatefulSets = append(d.report.StatefulSets, issues...)
+		d.report.mu.Unlock()
+	}
+
+	pvcs, err := d.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		d.report.addError(fmt.Sprintf("list persistentvolumeclaims in namespace %s: %v", namespace, err))
+	} else {
+		d.report.addVolumes(pvcs.Items, d.volumeUsage(ctx, pods))
+	}
+
+	for _, resource := range d.resources {
+		if !clusterResources[resource] {
+			continue
+		}
+		res, err := d.resourceFor(resource)
+		if err != nil {
+			continue
+		}
+		list, err := d.resourceInterface(res, namespace).List(ctx, d.listOptions(resource))
+		if err != nil {
+			d.report.addError(fmt.Sprintf("list %s in namespace %s: %v", resource, namespace, err))
+			continue
+		}
+		for _, cr := range list.Items {
+			d.report.addCluster(cr, operatorVersion(operators, namespace))
+		}
+	}
+}
+
+// volumeUsage queries the kubelets running pods with persistent volumes, like "kubectl get --raw /api/v1/nodes/<node>/proxy/stats/summary"
+// It requires a connection to the cluster, usage is unknown otherwise
+func (d *Dumper) volumeUsage(ctx context.Context, pods []corev1.Pod) map[string]volumeStats {
+	usage := map[string]volumeStats{}
+	if d.restConfig == nil {
+		return usage
+	}
+	nodes := map[string]bool{}
+	for _, pod := range pods {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && pod.Spec.NodeName != "" {
+				nodes[pod.Spec.NodeName] = true
+			}
+		}
+	}
+	for node := range nodes {
+		summary, err := d.clientset.CoreV1().RESTClient().Get().AbsPath("/api/v1/nodes", node, "proxy", "stats", "summary").DoRaw(ctx)
+		if err != nil {
+			d.report.addError(fmt.Sprintf("get volume usage from node %s: %v", node, err))
+			continue
+		}
+		stats, err := parseVolumeStats(summary)
+		if err != nil {
+			d.report.addError(fmt.Sprintf("get volume usage from node %s: %v", node, err))
+			continue
+		}
+		for claim, s := range stats {
+			usage[claim] = s
+		}
+	}
+	return usage
+}
+
+// sort orders findings, so that reports do not depend on the order of workers
+// only the most recent warnings are kept
+func (r *report) sort() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sort.SliceStable(r.Clusters, func(i, j int) bool {
+		return r.Clusters[i].Namespace+"/"+r.Clusters[i].Name < r.Clusters[j].Namespace+"/"+r.Clusters[j].Name
+	})
+	sort.SliceStable(r.Pods, func(i, j int) bool {
+		return r.Pods[i].Namespace+"/"+r.Pods[i].Pod < r.Pods[j].Namespace+"/"+r.Pods[j].Pod
+	})
+	sort.SliceStable(r.StatefulSets, func(i, j int) bool {
+		return r.StatefulSets[i].Namespace+"/"+r.StatefulSets[i].Name < r.StatefulSets[j].Namespace+"/"+r.StatefulSets[j].Name
+	})
+	sort.SliceStable(r.Volumes, func(i, j int) bool {
+		return r.Volumes[i].Namespace+"/"+r.Volumes[i].Claim < r.Volumes[j].Namespace+"/"+r.Volumes[j].Claim
+	})
+	sort.SliceStable(r.Warnings, func(i, j int) bool {
+		return r.Warnings[i].Time.After(r.Warnings[j].Time)
+	})
+	if len(r.Warnings) > reportedWarnings {
+		r.Warnings = r.Warnings[:reportedWarnings]
+	}
+	sort.Strings(r.Errors)
+}
+
+func (r *report) json() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.MarshalIndent(r, "", "  ")
+}
+
+func (r *report) markdown() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Cluster report\n\nGenerated at %s, resource: %s\n", formatTime(r.GeneratedAt), r.Resource)
+
+	b.WriteString("\n## Clusters\n\n")
+	if len(r.Clusters) == 0 {
+		b.WriteString("No cluster found.\n")
+	} else {
+		table(&b, []string{"Namespace", "Kind", "Name", "State", "CR version", "Operator version"}, len(r.Clusters), func(i int) []string {
+			c := r.Clusters[i]
+			operator := c.OperatorVersion
+			if c.VersionMismatch {
+				operator += " (**mismatch**)"
+			}
+			return []string{c.Namespace, c.Kind, c.Name, c.State, c.CRVersion, operator}
+		})
+	}
+	for _, c := range r.Clusters {
+		if len(c.Conditions) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### Conditions of %s/%s\n\n", c.Namespace, c.Name)
+		table(&b, []string{"Type", "Status", "Reason", "Message", "Last transition"}, len(c.Conditions), func(i int) []string {
+			cond := c.Conditions[i]
+			return []string{cond.Type, cond.Status, cond.Reason, cond.Message, cond.LastTransitionTime}
+		})
+	}
+
+	b.WriteString("\n## Pods\n\n")
+	if len(r.Pods) == 0 {
+		b.WriteString("Every pod is ready, no container was OOM killed or is restarting in a loop.\n")
+	} else {
+		table(&b, []string{"Namespace", "Pod", "Container", "Issue", "Restarts", "Reason"}, len(r.Pods), func(i int) []string {
+			p := r.Pods[i]
+			return []string{p.Namespace, p.Pod, p.Container, p.Issue, fmt.Sprint(p.Restarts), p.Reason}
+		})
+	}
+
+	b.WriteString("\n## StatefulSets\n\n")
+	if len(r.StatefulSets) == 0 {
+		b.WriteString("Every statefulset is ready.\n")
+	} else {
+		table(&b, []string{"Namespace", "Name", "Ready", "Replicas"}, len(r.StatefulSets), func(i int) []string {
+			s := r.StatefulSets[i]
+			return []string{s.Namespace, s.Name, fmt.Sprint(s.Ready), fmt.Sprint(s.Replicas)}
+		})
+	}
+
+	b.WriteString("\n## Persistent volume claims\n\n")
+	if len(r.Volumes) == 0 {
+		fmt.Fprintf(&b, "Every claim is bound, and no volume is used above %d%%.\n", volumeUsageThreshold)
+	} else {
+		table(&b, []string{"Namespace", "Claim", "Issue", "Phase", "Capacity", "Used"}, len(r.Volumes), func(i int) []string {
+			v := r.Volumes[i]
+			used := ""
+			if v.UsedPercent > 0 {
+				used = fmt.Sprintf("%d%%", v.UsedPercent)
+			}
+			return []string{v.Namespace, v.Claim, v.Issue, v.Phase, v.Capacity, used}
+		})
+	}
+
+	b.WriteString("\n## Recent warning events\n\n")
+	if len(r.Warnings) == 0 {
+		b.WriteString("No warning event.\n")
+	} else {
+		table(&b, []string{"Last seen", "Namespace", "Object", "Reason", "Count", "Message"}, len(r.Warnings), func(i int) []string {
+			w := r.Warnings[i]
+			return []string{formatTime(w.Time), w.Namespace, w.Object, w.Reason, fmt.Sprint(w.Count), w.Message}
+		})
+	}
+
+	if len(r.Errors) > 0 {
+		b.WriteString("\n## Analysis errors\n\nThe report is incomplete, see also errors.txt:\n\n")
+		for _, err := range r.Errors {
+			fmt.Fprintf(&b, "- %s\n", err)
+		}
+	}
+	return b.Bytes()
+}
+
+// table writes a markdown table of n rows
+func table(b *bytes.Buffer, header []string, n int, row func(i int) []string) {
+	b.WriteString("| " + strings.Join(header, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(header)) + "\n")
+	for i := 0; i < n; i++ {
+		cells := row(i)
+		for j, cell := range cells {
+			cells[j] = strings.NewReplacer("|", `\|`, "\n", " ").Replace(cell)
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+}
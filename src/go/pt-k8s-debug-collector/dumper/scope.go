@@ -0,0 +1,189 @@
+package dumper
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// clusterResources are the custom resources of database clusters, named after their cluster
+var clusterResources = map[string]bool{
+	"perconaxtradbclusters": true,
+	"perconaservermysqls":   true,
+	"perconaservermongodbs": true,
+	"perconapgclusters":     true,
+	"pgclusters":            true,
+}
+
+// SetScope limits what is collected
+// selector filters pods, namespaces in exclude are skipped unless given with --namespace,
+// and since limits logs and events to the given window. Zero means no limit
+func (d *Dumper) SetScope(selector string, exclude []string, since time.Duration) error {
+	if _, err := labels.Parse(selector); err != nil {
+		return errors.Wrap(err, "parse selector")
+	}
+	d.selector = selector
+	d.excludeNamespaces = map[string]bool{}
+	for _, ns := range exclude {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			d.excludeNamespaces[ns] = true
+		}
+	}
+	d.since = since
+	return nil
+}
+
+// SetMaxSize sets the size limit of the archive content, in bytes. 0 means no limit
+// Once reached, remaining files are skipped, and listed in skipped.txt
+func (d *Dumper) SetMaxSize(size int64) {
+	d.maxSize = size
+}
+
+// clusterLabel is the label of pods naming their cluster
+func clusterLabel(resource string) string {
+	switch resource {
+	case "pg":
+		return "pg-cluster"
+	case "pgv2":
+		return "postgres-operator.crunchydata.com/cluster"
+	}
+	return "app.kubernetes.io/instance"
+}
+
+// scoped tells whether only some pods are collected, namespaces without any are then skipped
+func (d *Dumper) scoped() bool {
+	return d.selector != "" || d.cluster != ""
+}
+
+// isPodResource tells whether resource names pods, such as po
+func isPodResource(resource string) bool {
+	return resource == "pods" || resource == "pod" || resource == "po"
+}
+
+// listOptions filters pods with --selector, and custom resources of clusters with --cluster
+// pods are filtered by cluster with inCluster: operator pods do not carry the label of the clusters they manage
+func (d *Dumper) listOptions(resource string) metav1.ListOptions {
+	switch {
+	case isPodResource(resource):
+		return metav1.ListOptions{LabelSelector: d.selector}
+	case d.cluster != "" && clusterResources[resource]:
+		return metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", d.cluster).String()}
+	}
+	return metav1.ListOptions{}
+}
+
+// inCluster tells whether a pod, given its labels and container images, is collected with --cluster
+// operators are always collected, whatever cluster they manage
+func (d *Dumper) inCluster(podLabels map[string]string, images []string) bool {
+	if d.cluster == "" || podLabels[clusterLabel(resourceType(d.crType))] == d.cluster {
+		return true
+	}
+	for _, image := range images {
+		if isOperatorImage(image) {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterPods keeps the pods of the --cluster, and operator pods
+func (d *Dumper) clusterPods(pods []corev1.Pod) []corev1.Pod {
+	kept := pods[:0]
+	for _, pod := range pods {
+		images := []string{}
+		for _, container := range pod.Spec.Containers {
+			images = append(images, container.Image)
+		}
+		if d.inCluster(pod.Labels, images) {
+			kept = append(kept, pod)
+		}
+	}
+	return kept
+}
+
+// clusterItems is clusterPods for pods listed with the dynamic client
+func (d *Dumper) clusterItems(items []unstructured.Unstructured) []unstructured.Unstructured {
+	kept := items[:0]
+	for _, item := range items {
+		images := []string{}
+		containers, _, _ := unstructured.NestedSlice(item.Object, "spec", "containers")
+		for _, container := range containers {
+			if container, ok := container.(map[string]interface{}); ok {
+				image, _ := container["image"].(string)
+				images = append(images, image)
+			}
+		}
+		if d.inCluster(item.GetLabels(), images) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// isOperatorImage tells whether image is one of the operators, such as percona/percona-xtradb-cluster-operator:1.13.0
+func isOperatorImage(image string) bool {
+	name, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	for _, operator := range operatorImages {
+		if name == operator || strings.HasSuffix(name, "/"+operator) {
+			return true
+		}
+	}
+	return false
+}
+
+// sinceSeconds is used for logs, nil without --since
+func (d *Dumper) sinceSeconds() *int64 {
+	if d.since <= 0 {
+		return nil
+	}
+	seconds := int64(d.since.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &seconds
+}
+
+// recentEvents drops events last seen before the --since window
+func (d *Dumper) recentEvents(events []corev1.Event) []corev1.Event {
+	if d.since <= 0 {
+		return events
+	}
+	after := time.Now().Add(-d.since)
+	recent := events[:0]
+	for _, event := range events {
+		if !eventTime(event).Before(after) {
+			recent = append(recent, event)
+		}
+	}
+	return recent
+}
+
+type skippedFile struct {
+	location string
+	size     int
+}
+
+// skippedContent lists files skipped because of the archive size limit
+func skippedContent(maxSize int64, skipped []skippedFile) []byte {
+	sort.Slice(skipped, func(i, j int) bool {
+		return skipped[i].location < skipped[j].location
+	})
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %d files were skipped, the archive reached its size limit of %d bytes\n", len(skipped), maxSize)
+	for _, s := range skipped {
+		fmt.Fprintf(&b, "%s\t%d\n", s.location, s.size)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,177 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// podMetricsGVR is served by metrics-server, it is optional in clusters
+var podMetricsGVR = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+
+// metricsAvailable tells whether metrics.k8s.io is served
+func (d *Dumper) metricsAvailable() bool {
+	_, err := d.clientset.Discovery().ServerResourcesForGroupVersion(podMetricsGVR.GroupVersion().String())
+	return err == nil
+}
+
+// restartedContainers returns containers having a previous instance, init containers first
+func restartedContainers(pod corev1.Pod) []string {
+	var containers []string
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.RestartCount > 0 || status.LastTerminationState.Terminated != nil {
+				containers = append(containers, status.Name)
+			}
+		}
+	}
+	return containers
+}
+
+// previousLogs returns logs of the previous instance of a container, like "kubectl logs --previous"
+func (d *Dumper) previousLogs(ctx context.Context, pod corev1.Pod, container string) ([]byte, error) {
+	return d.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: container, Previous: true, SinceSeconds: d.sinceSeconds()}).DoRaw(ctx)
+}
+
+// containerStatuses summarizes readiness, restarts and terminations of every container of a pod
+func containerStatuses(pod corev1.Pod) []byte {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER\tTYPE\tREADY\tRESTARTS\tSTATE\tLAST TERMINATION")
+	for _, statuses := range []struct {
+		kind     string
+		statuses []corev1.ContainerStatus
+	}{
+		{"init", pod.Status.InitContainerStatuses},
+		{"app", pod.Status.ContainerStatuses},
+	} {
+		for _, status := range statuses.statuses {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%d\t%s\t%s\n",
+				status.Name,
+				statuses.kind,
+				status.Ready,
+				status.RestartCount,
+				containerState(status.State),
+				containerState(status.LastTerminationState))
+		}
+	}
+	w.Flush()
+	return b.Bytes()
+}
+
+func containerState(state corev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "running since " + formatTime(state.Running.StartedAt.Time)
+	case state.Waiting != nil:
+		return "waiting: " + state.Waiting.Reason
+	case state.Terminated != nil:
+		t := state.Terminated
+		s := fmt.Sprintf("terminated: %s, exit code %d", t.Reason, t.ExitCode)
+		if t.Signal != 0 {
+			s += ", signal " + strconv.Itoa(int(t.Signal))
+		}
+		return s + ", at " + formatTime(t.FinishedAt.Time)
+	}
+	return "-"
+}
+
+// eventsTimeline lists events of a namespace, oldest first, within the --since window
+// warnings are added to the report
+func (d *Dumper) eventsTimeline(ctx context.Context, namespace string) ([]byte, error) {
+	events, err := d.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	items := d.recentEvents(events.Items)
+	if d.report != nil {
+		d.report.addEvents(items)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return eventTime(items[i]).Before(eventTime(items[j]))
+	})
+
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "LAST SEEN\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+	for _, event := range items {
+		count := event.Count
+		if count == 0 && event.Series != nil {
+			count = event.Series.Count
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			formatTime(eventTime(event)),
+			event.Type,
+			event.Reason,
+			strings.ToLower(event.InvolvedObject.Kind)+"/"+event.InvolvedObject.Name,
+			count,
+			strings.TrimSpace(event.Message))
+	}
+	w.Flush()
+	return b.Bytes(), nil
+}
+
+// eventTime is when an event was last seen, depending on the API which created it
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// podMetrics returns CPU and memory usage of every container of a pod, from metrics.k8s.io
+func (d *Dumper) podMetrics(ctx context.Context, pod corev1.Pod) ([]byte, error) {
+	metrics, err := d.dynamic.Resource(podMetricsGVR).Namespace(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	containers, _, err := unstructured.NestedSlice(metrics.Object, "containers")
+	if err != nil {
+		return nil, errors.Wrap(err, "read containers")
+	}
+	timestamp, _, _ := unstructured.NestedString(metrics.Object, "timestamp")
+	window, _, _ := unstructured.NestedString(metrics.Object, "window")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "timestamp: %s, window: %s\n", timestamp, window)
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER\tCPU\tMEMORY")
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(container, "name")
+		cpu, _, _ := unstructured.NestedString(container, "usage", "cpu")
+		memory, _, _ := unstructured.NestedString(container, "usage", "memory")
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, cpu, memory)
+	}
+	w.Flush()
+	return b.Bytes(), nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,207 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Summary modes
+const (
+	// SummaryExec runs bundled scripts with the database client of the database container
+	SummaryExec = "exec"
+	// SummaryPortForward runs pt-mysql-summary or pt-mongodb-summary locally, through a port-forward
+	// it is not supported for PostgreSQL
+	SummaryPortForward = "port-forward"
+)
+
+// summaryScripts are run in database containers, so that nothing has to be downloaded nor installed
+// gather.sql is the pg_gather script, it is updated with "go generate"
+//
+//go:generate curl -fsSL -o summary/gather.sql https://raw.githubusercontent.com/percona/support-snippets/master/postgresql/pg_gather/gather.sql
+//go:embed summary
+var summaryScripts embed.FS
+
+func summaryScript(name string) []byte {
+	script, err := summaryScripts.ReadFile("summary/" + name)
+	if err != nil {
+		// scripts are embedded at build time
+		panic(err)
+	}
+	return script
+}
+
+// summaryContainer is the database container of each resource type
+func summaryContainer(resource string) string {
+	switch resource {
+	case "pxc":
+		return "pxc"
+	case "ps":
+		return "mysql"
+	case "psmdb":
+		return "mongod"
+	}
+	return ""
+}
+
+func (d *Dumper) getPodSummary(ctx context.Context, resource, podName, crName string, namespace string) ([]byte, error) {
+	switch resource {
+	case "ps":
+		fallthrough
+	case "pxc":
+		var pass string
+		cr, err := d.getCR(ctx, resource+"/"+crName, namespace)
+		if err != nil {
+			return nil, errors.Wrap(err, "get cr")
+		}
+		if cr.Spec.SecretName != "" {
+			pass, err = d.getDataFromSecret(ctx, cr.Spec.SecretName, "root", namespace)
+		} else {
+			pass, err = d.getDataFromSecret(ctx, crName+"-secrets", "root", namespace)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "get password from pxc users secret")
+		}
+		if d.summaryMode == SummaryPortForward {
+			return d.mysqlSummaryPortForward(ctx, namespace, podName, pass)
+		}
+		// the password is read from the first line of stdin, it must not show in the processes of the container
+		script := `IFS= read -r MYSQL_PWD; export MYSQL_PWD; exec mysql --user=root --table --verbose --force`
+		stdin := io.MultiReader(strings.NewReader(pass+"\n"), bytes.NewReader(summaryScript("mysql.sql")))
+		return d.execSummary(ctx, namespace, podName, summaryContainer(resource), []string{"sh", "-c", script}, stdin)
+	case "pg", "pgv2":
+		// --summary-mode=port-forward is rejected for PostgreSQL, pg_gather runs with psql in the pod
+		return d.execSummary(ctx, namespace, podName, "", []string{"psql", "-X", "-f", "-"}, bytes.NewReader(d.pgSummaryScript()))
+	case "psmdb":
+		cr, err := d.getCR(ctx, "psmdb/"+crName, namespace)
+		if err != nil {
+			return nil, errors.Wrap(err, "get cr")
+		}
+		user, err := d.getDataFromSecret(ctx, cr.Spec.Secrets.Users, "MONGODB_DATABASE_ADMIN_USER", namespace)
+		if err != nil {
+			return nil, errors.Wrap(err, "get password from psmdb users secret")
+		}
+		pass, err := d.getDataFromSecret(ctx, cr.Spec.Secrets.Users, "MONGODB_DATABASE_ADMIN_PASSWORD", namespace)
+		if err != nil {
+			return nil, errors.Wrap(err, "get password from psmdb users secret")
+		}
+		if d.summaryMode == SummaryPortForward {
+			return d.mongodbSummaryPortForward(ctx, namespace, podName, user, pass)
+		}
+		credentials, err := json.Marshal(map[string]string{"user": user, "pass": pass})
+		if err != nil {
+			return nil, err
+		}
+		// credentials are written with the script to a private file, mongosh replaced mongo in recent versions
+		script := `umask 077; f=$(mktemp); cat > "$f"; ` +
+			`if command -v mongosh >/dev/null; then mongosh --quiet --nodb "$f"; else mongo --quiet --nodb "$f"; fi; ` +
+			`rc=$?; rm -f "$f"; exit $rc`
+		stdin := io.MultiReader(
+			strings.NewReader(fmt.Sprintf("const credentials = %s;\nconst user = credentials.user;\nconst pass = credentials.pass;\n", credentials)),
+			bytes.NewReader(summaryScript("mongodb.js")))
+		return d.execSummary(ctx, namespace, podName, summaryContainer(resource), []string{"sh", "-c", script}, stdin)
+	}
+	return nil, errors.Errorf("no summary for resource %s", resource)
+}
+
+// pgSummaryScript is the pg_gather script given with --pg-gather-file, or the bundled one
+// builds without gather.sql, when "go generate" could not get it, run the short postgresql.sql summary
+func (d *Dumper) pgSummaryScript() []byte {
+	if d.pgGather != nil {
+		return d.pgGather
+	}
+	if script, err := summaryScripts.ReadFile("summary/gather.sql"); err == nil {
+		return script
+	}
+	return summaryScript("postgresql.sql")
+}
+
+// execSummary runs a summary in a container
+// database clients write warnings to stderr, they are kept after the output instead of failing the summary
+func (d *Dumper) execSummary(ctx context.Context, namespace, podName, container string, command []string, stdin io.Reader) ([]byte, error) {
+	stdout, stderr, err := d.streamInPod(ctx, namespace, podName, container, command, stdin)
+	if err != nil {
+		return nil, errors.Errorf("error: %v\nstderr: %sstdout: %s", err, stderr, stdout)
+	}
+	if len(stderr) > 0 {
+		stdout = append(stdout, "\nstderr:\n"...)
+		stdout = append(stdout, stderr...)
+	}
+	return stdout, nil
+}
+
+func (d *Dumper) mysqlSummaryPortForward(ctx context.Context, namespace, podName, pass string) ([]byte, error) {
+	// the password is not given on the command line, where any local user could read it
+	defaultsFile, err := writeDefaultsFile("root", pass)
+	if err != nil {
+		return nil, errors.Wrap(err, "write defaults file")
+	}
+	defer os.Remove(defaultsFile)
+	return d.portForwardSummary(ctx, namespace, podName, "3306", nil, "pt-mysql-summary", func(port string) []string {
+		return []string{"--defaults-file=" + defaultsFile, "--host=127.0.0.1", "--port=" + port}
+	})
+}
+
+func (d *Dumper) mongodbSummaryPortForward(ctx context.Context, namespace, podName, user, pass string) ([]byte, error) {
+	// an empty --password makes pt-mongodb-summary read it from stdin
+	output, err := d.portForwardSummary(ctx, namespace, podName, "27017", strings.NewReader(pass+"\n"), "pt-mongodb-summary", func(port string) []string {
+		return []string{"--username=" + user, "--password=", "--authenticationDatabase=admin", "127.0.0.1:" + port}
+	})
+	return bytes.TrimPrefix(output, []byte("Password: ")), err
+}
+
+// portForwardSummary runs a summary tool locally, args are given the forwarded local port
+func (d *Dumper) portForwardSummary(ctx context.Context, namespace, podName, remotePort string, stdin io.Reader, name string, args func(localPort string) []string) ([]byte, error) {
+	// without --forwardport, a free local port is used so that summaries can run concurrently
+	ports := ":" + remotePort
+	if d.forwardport != "" {
+		ports = d.forwardport + ":" + remotePort
+		d.forwardMu.Lock()
+		defer d.forwardMu.Unlock()
+	}
+
+	localPort, stop, err := d.portForward(ctx, namespace, podName, ports)
+	if err != nil {
+		d.logError(err.Error(), "port-forward", "pod/"+podName, ports, "-n", namespace)
+		return nil, errors.Wrap(err, "port-forward")
+	}
+	defer stop()
+
+	var outb, errb bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args(localPort)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+	err = cmd.Run()
+	if err != nil {
+		return nil, errors.Errorf("error: %v\nstderr: %sstdout: %s", err, errb.String(), outb.String())
+	}
+	return outb.Bytes(), nil
+}
+
+// writeDefaultsFile writes client credentials to a file readable only by the current user
+// the caller removes it once done
+func writeDefaultsFile(user, pass string) (string, error) {
+	f, err := os.CreateTemp("", "pt-k8s-debug-collector-*.cnf")
+	if err != nil {
+		return "", err
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	_, err = fmt.Fprintf(f, "[client]\nuser=\"%s\"\npassword=\"%s\"\n", escaper.Replace(user), escaper.Replace(pass))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
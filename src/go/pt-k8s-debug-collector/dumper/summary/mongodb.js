@@ -0,0 +1,25 @@
+// Summary of a mongod, run with mongosh or mongo --nodb
+// user and pass are defined before this script
+const conn = new Mongo("mongodb://127.0.0.1:27017/?directConnection=true");
+const admin = conn.getDB("admin");
+admin.auth(user, pass);
+
+function section(title, f) {
+    print("# " + title);
+    try {
+        printjson(f());
+    } catch (e) {
+        print("error: " + e);
+    }
+    print("");
+}
+
+section("buildInfo", () => admin.runCommand({ buildInfo: 1 }));
+section("hostInfo", () => admin.runCommand({ hostInfo: 1 }));
+section("getCmdLineOpts", () => admin.runCommand({ getCmdLineOpts: 1 }));
+section("replSetGetStatus", () => admin.runCommand({ replSetGetStatus: 1 }));
+section("replSetGetConfig", () => admin.runCommand({ replSetGetConfig: 1 }));
+section("serverStatus", () => admin.runCommand({ serverStatus: 1 }));
+section("listDatabases", () => admin.runCommand({ listDatabases: 1 }));
+section("currentOp", () => admin.runCommand({ currentOp: 1, active: true }));
+section("getParameter", () => admin.runCommand({ getParameter: "*" }));
@@ -0,0 +1,14 @@
+-- Summary of a MySQL or PXC server, run with: mysql --table --verbose --force
+SELECT NOW() AS now, @@hostname AS hostname, @@version AS version, @@version_comment AS version_comment, @@read_only AS read_only;
+SHOW GLOBAL VARIABLES;
+SHOW GLOBAL STATUS;
+SHOW FULL PROCESSLIST;
+SHOW ENGINE INNODB STATUS\G
+SHOW REPLICA STATUS\G
+SELECT * FROM performance_schema.replication_group_members;
+SELECT table_schema, engine, COUNT(*) AS tables, ROUND(SUM(data_length + index_length) / 1024 / 1024, 2) AS size_mb
+  FROM information_schema.tables
+  WHERE table_schema NOT IN ('information_schema', 'performance_schema', 'sys')
+  GROUP BY table_schema, engine
+  ORDER BY size_mb DESC;
+SELECT user, host, plugin, account_locked FROM mysql.user ORDER BY user, host;
@@ -0,0 +1,27 @@
+-- Summary of a PostgreSQL server, run with: psql -X -f -
+\pset pager off
+\echo '# version'
+SELECT version(), pg_is_in_recovery() AS in_recovery, now() - pg_postmaster_start_time() AS uptime;
+\echo '# settings'
+SELECT name, setting, unit, source FROM pg_settings WHERE source NOT IN ('default', 'override') ORDER BY name;
+\echo '# databases'
+SELECT datname, pg_size_pretty(pg_database_size(datname)) AS size, age(datfrozenxid) AS xid_age
+  FROM pg_database ORDER BY pg_database_size(datname) DESC;
+\echo '# database statistics'
+SELECT datname, numbackends, xact_commit, xact_rollback, blks_read, blks_hit, temp_files, temp_bytes, deadlocks, conflicts
+  FROM pg_stat_database ORDER BY datname;
+\echo '# activity'
+SELECT pid, usename, datname, application_name, client_addr, state, wait_event_type, wait_event,
+       now() - xact_start AS xact_age, now() - query_start AS query_age, left(query, 200) AS query
+  FROM pg_stat_activity ORDER BY xact_start NULLS LAST;
+\echo '# waiting locks'
+SELECT l.pid, l.locktype, l.mode, l.relation::regclass AS relation, pg_blocking_pids(l.pid) AS blocked_by
+  FROM pg_locks l WHERE NOT l.granted;
+\echo '# replication'
+SELECT * FROM pg_stat_replication;
+\echo '# replication slots'
+SELECT * FROM pg_replication_slots;
+\echo '# archiver'
+SELECT * FROM pg_stat_archiver;
+\echo '# background writer'
+SELECT * FROM pg_stat_bgwriter;
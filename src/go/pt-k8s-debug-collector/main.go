@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/percona/percona-toolkit/src/go/pt-k8s-debug-collector/dumper"
 )
@@ -27,6 +29,18 @@ func main() {
 	clusterName := ""
 	kubeconfig := ""
 	forwardport := ""
+	concurrency := 0
+	timeout := time.Duration(0)
+	deadline := time.Duration(0)
+	maxFileSize := int64(0)
+	summaryMode := ""
+	pgGatherFile := ""
+	redact := true
+	redactAllow := ""
+	selector := ""
+	excludeNamespaces := ""
+	since := time.Duration(0)
+	maxSize := int64(0)
 	version := false
 
 	flag.StringVar(&namespace, "namespace", "", "Namespace for collecting data. If empty data will be collected from all namespaces")
@@ -34,6 +48,18 @@ func main() {
 	flag.StringVar(&clusterName, "cluster", "", "Cluster name")
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to kubeconfig")
 	flag.StringVar(&forwardport, "forwardport", "", "Port to use for  port forwarding")
+	flag.IntVar(&concurrency, "concurrency", dumper.DefaultConcurrency, "Number of requests to the cluster running at the same time")
+	flag.DurationVar(&timeout, "timeout", dumper.DefaultTimeout, "Timeout of each request, such as getting logs or a summary of a pod. 0 for no timeout")
+	flag.DurationVar(&deadline, "deadline", 0, "Maximum duration of the whole collection, data collected so far is kept. 0 for no deadline")
+	flag.StringVar(&summaryMode, "summary-mode", dumper.SummaryExec, "How to collect summaries of database pods: exec runs bundled scripts in the database container, a short mysql.sql summary instead of pt-mysql-summary for MySQL and pg_gather for PostgreSQL, port-forward runs pt-mysql-summary or pt-mongodb-summary locally and is not supported for PostgreSQL")
+	flag.StringVar(&pgGatherFile, "pg-gather-file", "", "Path to a pg_gather gather.sql script, run in PostgreSQL pods instead of the bundled one")
+	flag.Int64Var(&maxFileSize, "max-file-size", dumper.DefaultMaxFileSize/1024/1024, "Size limit of each file copied from pods, in MiB. Larger logs are truncated to their end, larger binary files are skipped. 0 for no limit")
+	flag.BoolVar(&redact, "redact", true, "Redact secrets and credentials from collected data, use --redact=false to keep them")
+	flag.StringVar(&redactAllow, "redact-allow", "", "Comma-separated list of keys which are never redacted, such as secret data keys or field names")
+	flag.StringVar(&selector, "selector", "", "Label selector of pods to collect, such as app.kubernetes.io/component=pxc")
+	flag.StringVar(&excludeNamespaces, "exclude-namespaces", "", "Comma-separated list of namespaces which are not collected, such as kube-system")
+	flag.DurationVar(&since, "since", 0, "Only collect logs and events newer than this duration, such as 1h. 0 for no limit")
+	flag.Int64Var(&maxSize, "max-size", 0, "Size limit of the archive content, in MiB. Once reached, remaining files are skipped and listed in skipped.txt. 0 for no limit")
 	flag.BoolVar(&version, "version", false, "Print version")
 	flag.Parse()
 
@@ -51,6 +77,27 @@ func main() {
 	}
 
 	d := dumper.New("", namespace, resource, kubeconfig, forwardport)
+	d.SetConcurrency(concurrency, timeout, deadline)
+	var pgGather []byte
+	if pgGatherFile != "" {
+		var err error
+		pgGather, err = os.ReadFile(pgGatherFile)
+		if err != nil {
+			log.Println("Error: read pg_gather script:", err)
+			os.Exit(1)
+		}
+	}
+	if err := d.SetSummary(summaryMode, pgGather); err != nil {
+		log.Println("Error:", err)
+		os.Exit(1)
+	}
+	d.SetMaxFileSize(maxFileSize * 1024 * 1024)
+	d.SetRedaction(redact, strings.Split(redactAllow, ","))
+	if err := d.SetScope(selector, strings.Split(excludeNamespaces, ","), since); err != nil {
+		log.Println("Error:", err)
+		os.Exit(1)
+	}
+	d.SetMaxSize(maxSize * 1024 * 1024)
 	log.Println("Start collecting cluster data")
 
 	err := d.DumpCluster()
@@ -24,7 +24,7 @@ This test requires:
 
 You can additionally set option FORWARDPORT if you want to use custom port when testing summaries.
 
-pt-mysql-summary, mysql, psql, and pt-mongodb-summary must be in the PATH.
+pt-mysql-summary, mysql, and pt-mongodb-summary must be in the PATH, for tests using --summary-mode=port-forward.
 
 Since running pt-k8s-debug-collector may take long time run go test with increase timeout:
 go test -timeout 6000s
@@ -260,7 +260,7 @@ func TestPT_2169(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		cmd := exec.Command("../../../bin/pt-k8s-debug-collector", "--kubeconfig", test.kubeconfig, "--forwardport", test.port, "--resource", test.resource)
+		cmd := exec.Command("../../../bin/pt-k8s-debug-collector", "--kubeconfig", test.kubeconfig, "--forwardport", test.port, "--resource", test.resource, "--summary-mode", "port-forward")
 		if err := cmd.Run(); err != nil {
 			t.Errorf("error executing pt-k8s-debug-collector: %s", err.Error())
 		}
@@ -3,14 +3,15 @@ package main
 import (
 	"archive/tar"
 	"compress/gzip"
-	"crypto/sha256"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -20,14 +21,13 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/percona/percona-toolkit/src/go/pt-secure-collect/sanitize"
-	"github.com/percona/percona-toolkit/src/go/pt-secure-collect/sanitize/util"
 )
 
 func collectData(opts *cliOptions) error {
 	log.Infof("Temp directory is %q", *opts.TempDir)
 
 	if !*opts.NoCollect {
-		cmds, safeCmds, err := getCommandsToRun(defaultCmds, opts)
+		cmds, safeCmds, err := getCommandsToRun(profileCmds[*opts.Profile], opts)
 		// Run the commands
 		if err = runCommands(cmds, safeCmds, *opts.TempDir); err != nil {
 			return errors.Wrap(err, "Cannot run data collection commands")
@@ -36,10 +36,30 @@ func collectData(opts *cliOptions) error {
 
 	if !*opts.NoSanitize {
 		log.Infof("Sanitizing output collected data")
-		err := processFiles(*opts.TempDir, *opts.IncludeDirs, *opts.TempDir, !*opts.NoSanitizeHostnames, !*opts.NoSanitizeQueries)
+		// the mapping file must not be in the temp dir, which is added to the tar file
+		mappingFile := *opts.MappingFile
+		if mappingFile == "" {
+			mappingFile = *opts.TempDir + "-mapping.json"
+		}
+		s, err := newSanitizer(sanitize.Options{
+			Hostnames: !*opts.NoSanitizeHostnames,
+			IPs:       !*opts.NoSanitizeIPs,
+			Emails:    !*opts.NoSanitizeEmails,
+			Users:     !*opts.NoSanitizeUsers,
+			Schemas:   !*opts.NoSanitizeSchemas,
+			Queries:   !*opts.NoSanitizeQueries,
+			Engine:    *opts.Profile,
+		}, *opts.SanitizeRules, mappingFile)
+		if err != nil {
+			return err
+		}
+		err = processFiles(*opts.TempDir, *opts.IncludeDirs, *opts.TempDir, s, *opts.BinaryFiles == binaryFilesCopy)
 		if err != nil {
 			return errors.Wrapf(err, "Cannot sanitize files in %q", *opts.TempDir)
 		}
+		if err = writeMapping(s, mappingFile); err != nil {
+			return err
+		}
 	}
 
 	tarFile := fmt.Sprintf(path.Join(*opts.TempDir, path.Base(*opts.TempDir)+".tar.gz"))
@@ -48,61 +68,14 @@ func collectData(opts *cliOptions) error {
 		return err
 	}
 
-	if !*opts.NoEncrypt && *opts.EncryptPassword != "" {
-		password := sha256.Sum256([]byte(*opts.EncryptPassword))
+	if !*opts.NoEncrypt && (*opts.EncryptPassword != "" || len(opts.keys.recipients) > 0) {
 		encryptedFile := tarFile + ".aes"
 		log.Infof("Encrypting %q file into %q", tarFile, encryptedFile)
-		encrypt(tarFile, encryptedFile, password)
-	}
-
-	return nil
-}
-
-func processFiles(dataDir string, includeDirs []string, outputDir string, sanitizeHostnames, sanitizeQueries bool) error {
-	dirs := []string{dataDir}
-	dirs = append(dirs, includeDirs...)
-
-	for _, dir := range dirs {
-		files, err := ioutil.ReadDir(dir)
-		if err != nil {
-			return errors.Wrapf(err, "Cannot get the listing of %q", dir)
-		}
-		if len(files) == 0 {
-			return errors.Errorf("There are no files to sanitize in %q", dir)
-		}
-		log.Debug("Sanitization process start")
-
-		for _, file := range files {
-			if file.IsDir() {
-				continue
-			}
-			inputFile := path.Join(dir, file.Name())
-			log.Debugf("Reading %q", inputFile)
-			fh, err := os.Open(inputFile)
-			if err != nil {
-				return errors.Wrapf(err, "Cannot open %q for reading", inputFile)
-			}
-
-			lines, err := util.ReadLinesFromFile(fh)
-			if err != nil {
-				return errors.Wrapf(err, "Cannot sanitize %q", inputFile)
-			}
-
-			log.Debugf("Sanitizing %q", inputFile)
-			sanitized := sanitize.Sanitize(lines, sanitizeHostnames, sanitizeQueries)
-
-			outfile := path.Join(outputDir, file.Name())
-			log.Debugf("Writing sanitized file to %q", outfile)
-			ofh, err := os.Create(outfile)
-			if err != nil {
-				return errors.Wrapf(err, "Cannot open %q for writing", outfile)
-			}
-
-			if err = util.WriteLinesToFile(ofh, sanitized); err != nil {
-				return errors.Wrapf(err, "Cannot write sanitized file %q", outfile)
-			}
+		if err := encrypt(tarFile, encryptedFile, opts.keys); err != nil {
+			return err
 		}
 	}
+
 	return nil
 }
 
@@ -120,20 +93,34 @@ func tarit(outfile string, srcPaths []string) error {
 	defer tw.Close()
 
 	for _, srcPath := range srcPaths {
-		files, err := ioutil.ReadDir(srcPath)
-		if err != nil {
-			return errors.Wrapf(err, "Cannot get the listing of %q", srcPath)
-		}
-		for _, file := range files {
+		err := filepath.WalkDir(srcPath, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return errors.Wrapf(err, "Cannot get the listing of %q", file)
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(srcPath, file)
+			if err != nil {
+				return err
+			}
 			// Ignore tar.gz files from previous runs
-			if strings.HasSuffix(file.Name(), ".tar.gz") {
-				log.Debugf("Skipping file %q", file.Name())
-				continue
+			if strings.HasSuffix(rel, ".tar.gz") && filepath.Dir(rel) == "." {
+				log.Debugf("Skipping file %q", rel)
+				return nil
 			}
-			log.Debugf("Adding %q to the tar file", file.Name())
-			if err := addFile(tw, srcPath, file); err != nil {
-				return errors.Wrapf(err, "Cannot add %q to the tar file %q", file.Name(), outfile)
+			fileInfo, err := d.Info()
+			if err != nil {
+				return err
+			}
+			log.Debugf("Adding %q to the tar file", rel)
+			if err := addFile(tw, srcPath, rel, fileInfo); err != nil {
+				return errors.Wrapf(err, "Cannot add %q to the tar file %q", rel, outfile)
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 	}
 
@@ -159,13 +146,16 @@ func getCommandsToRun(defaultCmds []string, opts *cliOptions) ([]*exec.Cmd, []st
 	}
 
 	for _, cmdstr := range cmdList {
-		cmdstr = strings.Replace(cmdstr, "$mysql-host", *opts.MySQLHost, -1)
-		cmdstr = strings.Replace(cmdstr, "$mysql-port", fmt.Sprintf("%d", *opts.MySQLPort), -1)
-		cmdstr = strings.Replace(cmdstr, "$mysql-user", *opts.MySQLUser, -1)
-		cmdstr = strings.Replace(cmdstr, "$temp-dir", *opts.TempDir, -1)
-		safeCmd := cmdstr
-		safeCmd = strings.Replace(safeCmd, "$mysql-pass", "********", -1)
-		cmdstr = strings.Replace(cmdstr, "$mysql-pass", *opts.MySQLPass, -1)
+		// pt-mongodb-query-digest fails when there is no database to profile
+		if strings.Contains(cmdstr, "$mongodb-database") && *opts.MongoDBDatabase == "" {
+			log.Infof("Skipping %q, there is no --mongodb-database to profile", cmdstr)
+			continue
+		}
+		template, safeCmd := cmdstr, cmdstr
+		for _, p := range getPlaceholders(opts) {
+			cmdstr = strings.Replace(cmdstr, p.name, p.value, -1)
+			safeCmd = strings.Replace(safeCmd, p.name, p.safeValue, -1)
+		}
 
 		args, err := shellwords.Parse(cmdstr)
 		if err != nil {
@@ -176,12 +166,65 @@ func getCommandsToRun(defaultCmds []string, opts *cliOptions) ([]*exec.Cmd, []st
 		}
 
 		cmd := exec.Command(args[0], args[1:]...)
+		// passwords are not on the command line, where other users could read them, and only given to database commands:
+		// MongoDB tools read it from stdin after a --password without value, PostgreSQL ones from PGPASSWORD
+		if strings.Contains(template, "$mongodb-auth") && *opts.MongoDBUser != "" && *opts.MongoDBPass != "" {
+			cmd.Stdin = strings.NewReader(*opts.MongoDBPass + "\n")
+		}
+		if strings.Contains(template, "$pg-conn") && *opts.PGPass != "" {
+			cmd.Env = append(os.Environ(), "PGPASSWORD="+*opts.PGPass)
+		}
 		cmds = append(cmds, cmd)
 		safeCmds = append(safeCmds, safeCmd)
 	}
 	return cmds, safeCmds, nil
 }
 
+// placeholder is replaced in commands by value, and by safeValue in logs
+type placeholder struct {
+	name      string
+	value     string
+	safeValue string
+}
+
+func getPlaceholders(opts *cliOptions) []placeholder {
+	mongoAuth := []string{}
+	if *opts.MongoDBUser != "" {
+		mongoAuth = append(mongoAuth, "--username="+*opts.MongoDBUser)
+		// the password is read from stdin
+		if *opts.MongoDBPass != "" {
+			mongoAuth = append(mongoAuth, "--password")
+		}
+		mongoAuth = append(mongoAuth, "--authenticationDatabase="+*opts.MongoDBAuthDB)
+	}
+	pgConn := []string{}
+	if *opts.PGHost != "" {
+		pgConn = append(pgConn, "--host="+*opts.PGHost)
+	}
+	if *opts.PGPort != 0 {
+		pgConn = append(pgConn, fmt.Sprintf("--port=%d", *opts.PGPort))
+	}
+	if *opts.PGUser != "" {
+		pgConn = append(pgConn, "--username="+*opts.PGUser)
+	}
+
+	mysqlPort := fmt.Sprintf("%d", *opts.MySQLPort)
+	mongoPort := fmt.Sprintf("%d", *opts.MongoDBPort)
+	return []placeholder{
+		{"$mysql-host", *opts.MySQLHost, *opts.MySQLHost},
+		{"$mysql-port", mysqlPort, mysqlPort},
+		{"$mysql-user", *opts.MySQLUser, *opts.MySQLUser},
+		{"$mysql-pass", *opts.MySQLPass, "********"},
+		{"$temp-dir", *opts.TempDir, *opts.TempDir},
+		{"$mongodb-host", *opts.MongoDBHost, *opts.MongoDBHost},
+		{"$mongodb-port", mongoPort, mongoPort},
+		{"$mongodb-database", *opts.MongoDBDatabase, *opts.MongoDBDatabase},
+		{"$mongodb-auth", strings.Join(mongoAuth, " "), strings.Join(mongoAuth, " ")},
+		{"$pg-conn", strings.Join(pgConn, " "), strings.Join(pgConn, " ")},
+		{"$pg-database", *opts.PGDatabase, *opts.PGDatabase},
+	}
+}
+
 func runCommands(cmds []*exec.Cmd, safeCmds []string, dataDir string) error {
 	for i := range cmds {
 		cmd := cmds[i]
@@ -210,8 +253,8 @@ func runCommands(cmds []*exec.Cmd, safeCmds []string, dataDir string) error {
 	return nil
 }
 
-func addFile(tw *tar.Writer, srcPath string, fileInfo os.FileInfo) error {
-	file, err := os.Open(path.Join(srcPath, fileInfo.Name()))
+func addFile(tw *tar.Writer, srcPath, rel string, fileInfo os.FileInfo) error {
+	file, err := os.Open(filepath.Join(srcPath, rel))
 	if err != nil {
 		return err
 	}
@@ -224,7 +267,7 @@ func addFile(tw *tar.Writer, srcPath string, fileInfo os.FileInfo) error {
 		}
 
 		// Add the path since fileInfo.Name() only has the file name without the path
-		header.Name = path.Join(path.Base(srcPath), fileInfo.Name())
+		header.Name = path.Join(path.Base(srcPath), filepath.ToSlash(rel))
 
 		if err := tw.WriteHeader(header); err != nil {
 			return errors.Wrapf(err, "Cannot write file header for %q into the tar file", fileInfo.Name())
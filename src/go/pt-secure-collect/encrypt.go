@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"io"
 	"os"
 	"path/filepath"
@@ -11,86 +15,400 @@ import (
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/scrypt"
 )
 
-func encryptorCmd(opts *cliOptions) (err error) {
-	password := sha256.Sum256([]byte(*opts.EncryptPassword))
+// Encrypted files start with a header, followed by chunks encrypted with AES-256-GCM:
+//
+//	magic         4 bytes  "PTSC"
+//	version       1 byte   formatVersion
+//	key type      1 byte   keyScrypt or keyRecipients
+//	key           scrypt: logN, r and p (1 byte each), then the salt (16 bytes)
+//	              recipients: their number (1 byte), then for each of them
+//	              its type (1 byte), the length of its data (2 bytes, big endian) and the data, see keys.go
+//	chunk size    4 bytes  big endian, size of plain text chunks
+//	nonce prefix  7 bytes
+//
+// With a password, the key is derived from the password and the random salt with scrypt.
+// With recipients, the key is random, and encrypted with the public key of each recipient.
+// The nonce of each chunk is the nonce prefix, the chunk number (4 bytes, big endian) and 1 for the last chunk, 0 otherwise,
+// so that chunks can not be reordered, and truncated files are detected. The header is authenticated with every chunk.
+//
+// Files without the magic were encrypted by older versions, with AES-OFB, a zero IV and the sha256 of the password as the key.
+const (
+	formatVersion    = 2
+	keyScrypt        = 1
+	keyRecipients    = 2
+	saltSize         = 16
+	fileKeySize      = 32
+	noncePrefixSize  = 7
+	defaultChunkSize = 64 * 1024
+
+	// scrypt parameters recommended for interactive logins
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+	// limits of parameters read from headers, so that a crafted file can not exhaust memory
+	maxScryptLogN = 22
+	maxChunkSize  = 16 * 1024 * 1024
+)
+
+var magic = []byte("PTSC")
+
+// keys protect the key of encrypted files: a password, or public keys of recipients
+// files encrypted for recipients are decrypted with the private key of one of them, the identity
+type keys struct {
+	password   []byte
+	recipients []interface{}
+	identity   interface{}
+}
+
+type header struct {
+	keyType     byte
+	logN, r, p  byte
+	salt        [saltSize]byte
+	recipients  []stanza
+	chunkSize   uint32
+	noncePrefix [noncePrefixSize]byte
+}
+
+// newHeader returns the header of a new file, and the key of the file
+func newHeader(k keys, chunkSize uint32) (header, []byte, error) {
+	h := header{chunkSize: chunkSize}
+	if _, err := io.ReadFull(rand.Reader, h.noncePrefix[:]); err != nil {
+		return h, nil, errors.Wrap(err, "Cannot generate the nonce")
+	}
+
+	if len(k.recipients) == 0 {
+		h.keyType, h.logN, h.r, h.p = keyScrypt, scryptLogN, scryptR, scryptP
+		if _, err := io.ReadFull(rand.Reader, h.salt[:]); err != nil {
+			return h, nil, errors.Wrap(err, "Cannot generate the salt")
+		}
+		key, err := h.fileKey(k)
+		return h, key, err
+	}
+
+	if len(k.recipients) > 255 {
+		return h, nil, errors.New("Too many recipients")
+	}
+	h.keyType = keyRecipients
+	key := make([]byte, fileKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return h, nil, errors.Wrap(err, "Cannot generate the file key")
+	}
+	for _, recipient := range k.recipients {
+		s, err := wrapKey(recipient, key)
+		if err != nil {
+			return h, nil, err
+		}
+		h.recipients = append(h.recipients, s)
+	}
+	return h, key, nil
+}
+
+func (h header) marshal() []byte {
+	buf := append([]byte{}, magic...)
+	buf = append(buf, formatVersion, h.keyType)
+	switch h.keyType {
+	case keyScrypt:
+		buf = append(buf, h.logN, h.r, h.p)
+		buf = append(buf, h.salt[:]...)
+	case keyRecipients:
+		buf = append(buf, byte(len(h.recipients)))
+		for _, s := range h.recipients {
+			buf = append(buf, s.kind)
+			buf = binary.BigEndian.AppendUint16(buf, uint16(len(s.data)))
+			buf = append(buf, s.data...)
+		}
+	}
+	buf = binary.BigEndian.AppendUint32(buf, h.chunkSize)
+	return append(buf, h.noncePrefix[:]...)
+}
+
+// readHeader reads the header, it returns its raw content too, to authenticate it
+func readHeader(r io.Reader) (header, []byte, error) {
+	var h header
+	var raw bytes.Buffer
+	read := func(size int) ([]byte, error) {
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(io.TeeReader(r, &raw), buf); err != nil {
+			return nil, errors.Wrap(err, "Cannot read the header")
+		}
+		return buf, nil
+	}
+
+	buf, err := read(len(magic) + 2)
+	if err != nil {
+		return h, nil, err
+	}
+	if version := buf[len(magic)]; version != formatVersion {
+		return h, nil, errors.Errorf("Unsupported file format version %d", version)
+	}
+	h.keyType = buf[len(magic)+1]
+
+	switch h.keyType {
+	case keyScrypt:
+		if buf, err = read(3 + saltSize); err != nil {
+			return h, nil, err
+		}
+		h.logN, h.r, h.p = buf[0], buf[1], buf[2]
+		if h.logN == 0 || h.logN > maxScryptLogN || h.r == 0 || h.p == 0 {
+			return h, nil, errors.Errorf("Invalid scrypt parameters N=2^%d, r=%d, p=%d", h.logN, h.r, h.p)
+		}
+		copy(h.salt[:], buf[3:])
+	case keyRecipients:
+		if buf, err = read(1); err != nil {
+			return h, nil, err
+		}
+		for i := 0; i < int(buf[0]); i++ {
+			kind, err := read(3)
+			if err != nil {
+				return h, nil, err
+			}
+			data, err := read(int(binary.BigEndian.Uint16(kind[1:])))
+			if err != nil {
+				return h, nil, err
+			}
+			h.recipients = append(h.recipients, stanza{kind: kind[0], data: data})
+		}
+	default:
+		return h, nil, errors.Errorf("Unsupported key type %d", h.keyType)
+	}
+
+	if buf, err = read(4 + noncePrefixSize); err != nil {
+		return h, nil, err
+	}
+	h.chunkSize = binary.BigEndian.Uint32(buf)
+	if h.chunkSize == 0 || h.chunkSize > maxChunkSize {
+		return h, nil, errors.Errorf("Invalid chunk size %d", h.chunkSize)
+	}
+	copy(h.noncePrefix[:], buf[4:])
+	return h, raw.Bytes(), nil
+}
+
+// fileKey derives the key of the file from the password, or decrypts it with the identity
+func (h header) fileKey(k keys) ([]byte, error) {
+	switch h.keyType {
+	case keyScrypt:
+		if len(k.password) == 0 {
+			return nil, errors.New("The file was encrypted with a password, not for recipients")
+		}
+		key, err := scrypt.Key(k.password, h.salt[:], 1<<h.logN, int(h.r), int(h.p), fileKeySize)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot derive the key from the password")
+		}
+		return key, nil
+	case keyRecipients:
+		if k.identity == nil {
+			return nil, errors.New("The file was encrypted for recipients, decrypt it with --private-key")
+		}
+		for _, s := range h.recipients {
+			if key, err := unwrapKey(k.identity, s); err == nil && len(key) == fileKeySize {
+				return key, nil
+			}
+		}
+		return nil, errors.New("The private key is not one of the recipients of the file")
+	}
+	return nil, errors.Errorf("Unsupported key type %d", h.keyType)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot create the cipher")
+	}
+	return cipher.NewGCM(block)
+}
 
+func (h header) nonce(chunk uint32, last bool) []byte {
+	nonce := make([]byte, 0, noncePrefixSize+5)
+	nonce = append(nonce, h.noncePrefix[:]...)
+	nonce = binary.BigEndian.AppendUint32(nonce, chunk)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+func encryptorCmd(opts *cliOptions) (err error) {
 	switch opts.Command {
 	case "decrypt":
 		if *opts.DecryptOutFile == "" && strings.HasSuffix(*opts.DecryptInFile, ".aes") {
 			*opts.DecryptOutFile = strings.TrimSuffix(filepath.Base(*opts.DecryptInFile), ".aes")
 		}
 		log.Infof("Decrypting file %q into %q", *opts.DecryptInFile, *opts.DecryptOutFile)
-		err = decrypt(*opts.DecryptInFile, *opts.DecryptOutFile, password)
+		err = decrypt(*opts.DecryptInFile, *opts.DecryptOutFile, opts.keys)
 	case "encrypt":
 		if *opts.EncryptOutFile == "" {
 			*opts.EncryptOutFile = filepath.Base(*opts.EncryptInFile) + ".aes"
 		}
 		log.Infof("Encrypting file %q into %q", *opts.EncryptInFile, *opts.EncryptOutFile)
-		err = encrypt(*opts.EncryptInFile, *opts.EncryptOutFile, password)
+		err = encrypt(*opts.EncryptInFile, *opts.EncryptOutFile, opts.keys)
 	}
 	return
 }
 
-func encrypt(infile, outfile string, pass [32]byte) error {
-	key := pass[:]
+func encrypt(infile, outfile string, k keys) error {
 	inFile, err := os.Open(infile)
 	if err != nil {
 		return errors.Wrapf(err, "Cannot open input file %q", infile)
 	}
 	defer inFile.Close()
 
-	block, err := aes.NewCipher(key)
+	outFile, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
 	if err != nil {
-		return errors.Wrapf(err, "Cannot create a new cipher")
+		return errors.Wrapf(err, "Cannot create output file %q", outfile)
 	}
+	defer outFile.Close()
 
-	// If the key is unique for each ciphertext, then it's ok to use a zero IV.
-	var iv [aes.BlockSize]byte
-	stream := cipher.NewOFB(block, iv[:])
+	if err := encryptStream(outFile, inFile, k, defaultChunkSize); err != nil {
+		return errors.Wrapf(err, "Cannot encrypt %q", infile)
+	}
+	return outFile.Close()
+}
 
-	outFile, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+// encryptStream writes the header, then the content of r encrypted chunk by chunk
+func encryptStream(w io.Writer, r io.Reader, k keys, chunkSize uint32) error {
+	h, key, err := newHeader(k, chunkSize)
 	if err != nil {
-		return errors.Wrapf(err, "Cannot create output file %q", outfile)
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
 	}
-	defer outFile.Close()
 
-	writer := &cipher.StreamWriter{S: stream, W: outFile}
-	// Copy the input file to the output file, encrypting as we go.
-	if _, err := io.Copy(writer, inFile); err != nil {
-		return errors.Wrapf(err, "Cannot write to output file %q", outfile)
+	hdr := h.marshal()
+	if _, err := w.Write(hdr); err != nil {
+		return errors.Wrap(err, "Cannot write the header")
+	}
+
+	br := bufio.NewReaderSize(r, int(chunkSize))
+	plain := make([]byte, chunkSize)
+	sealed := make([]byte, 0, int(chunkSize)+aead.Overhead())
+	for chunk := uint32(0); ; chunk++ {
+		n, err := io.ReadFull(br, plain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Wrap(err, "Cannot read the input")
+		}
+		// the last chunk can be empty, when the input is a multiple of the chunk size
+		last := err != nil
+		if !last {
+			if _, err := br.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+		if chunk == ^uint32(0) && !last {
+			return errors.New("Input is too large")
+		}
+		sealed = aead.Seal(sealed[:0], h.nonce(chunk, last), plain[:n], hdr)
+		if _, err := w.Write(sealed); err != nil {
+			return errors.Wrap(err, "Cannot write the output")
+		}
+		if last {
+			return nil
+		}
 	}
-	return nil
 }
 
-func decrypt(infile, outfile string, pass [32]byte) error {
-	key := pass[:]
+// decrypt decrypts files in the current format, or in the legacy one
+// the output file is removed when the file can not be decrypted, such as with a wrong password
+func decrypt(infile, outfile string, k keys) (err error) {
 	inFile, err := os.Open(infile)
 	if err != nil {
 		return errors.Wrapf(err, "Cannot open %q for reading", infile)
 	}
 	defer inFile.Close()
 
-	block, err := aes.NewCipher(key)
+	outFile, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
 	if err != nil {
-		return errors.Wrap(err, "Cannot create the cipher")
+		return errors.Wrapf(err, "Cannot open %q for writing", outfile)
 	}
+	defer func() {
+		outFile.Close()
+		if err != nil {
+			os.Remove(outfile)
+		}
+	}()
 
-	// If the key is unique for each ciphertext, then it's ok to use a zero IV.
-	var iv [aes.BlockSize]byte
-	stream := cipher.NewOFB(block, iv[:])
+	if err = decryptStream(outFile, inFile, k); err != nil {
+		return errors.Wrapf(err, "Cannot decrypt %q", infile)
+	}
+	return outFile.Close()
+}
 
-	outFile, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+// decryptStream writes the decrypted content of r to w, nothing is written for chunks which can not be authenticated
+func decryptStream(w io.Writer, r io.Reader, k keys) error {
+	br := bufio.NewReader(r)
+	prefix, err := br.Peek(len(magic))
+	if err != nil && err != io.EOF {
+		return errors.Wrap(err, "Cannot read the header")
+	}
+	if !bytes.Equal(prefix, magic) {
+		if len(k.password) == 0 {
+			return errors.New("The file was encrypted by an older version, with a password")
+		}
+		log.Warn("The file was encrypted by an older version, its integrity can not be checked. Please encrypt it again")
+		return decryptLegacy(w, br, k.password)
+	}
+
+	h, hdr, err := readHeader(br)
 	if err != nil {
-		return errors.Wrapf(err, "Cannot open %q for writing", outfile)
+		return err
 	}
-	defer outFile.Close()
+	key, err := h.fileKey(k)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	sealed := make([]byte, int(h.chunkSize)+aead.Overhead())
+	plain := make([]byte, 0, h.chunkSize)
+	for chunk := uint32(0); ; chunk++ {
+		n, err := io.ReadFull(br, sealed)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Wrap(err, "Cannot read the input")
+		}
+		last := err != nil
+		if !last {
+			if _, err := br.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+		plain, err = aead.Open(plain[:0], h.nonce(chunk, last), sealed[:n], hdr)
+		if err != nil {
+			if chunk == 0 && h.keyType == keyScrypt {
+				return errors.New("Wrong password, or the file is corrupted")
+			}
+			return errors.Errorf("The file is corrupted or truncated at chunk %d", chunk)
+		}
+		if _, err := w.Write(plain); err != nil {
+			return errors.Wrap(err, "Cannot write the output")
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// decryptLegacy decrypts files written by older versions. A wrong password can not be detected
+func decryptLegacy(w io.Writer, r io.Reader, password []byte) error {
+	key := sha256.Sum256(password)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return errors.Wrap(err, "Cannot create the cipher")
+	}
+
+	// Legacy files used a zero IV
+	var iv [aes.BlockSize]byte
+	stream := cipher.NewOFB(block, iv[:])
 
-	reader := &cipher.StreamReader{S: stream, R: inFile}
-	// Copy the input file to the output file, decrypting as we go.
-	if _, err := io.Copy(outFile, reader); err != nil {
-		return errors.Wrapf(err, "Cannot write to output file %q", outfile)
+	reader := &cipher.StreamReader{S: stream, R: r}
+	if _, err := io.Copy(w, reader); err != nil {
+		return errors.Wrap(err, "Cannot write the output")
 	}
 	return nil
 }
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Types of recipient stanzas, the key of the file encrypted for one recipient:
+//
+//	X25519: an ephemeral public key (32 bytes), then the file key encrypted with AES-256-GCM and a zero nonce,
+//	        using a key derived with HKDF-SHA256 from the shared secret, the ephemeral and the recipient public keys
+//	RSA:    the file key encrypted with RSA-OAEP-SHA256
+//
+// Keys are read from PEM files: PKIX public keys, and PKCS #8 or PKCS #1 private keys,
+// such as generated by the keygen command, or "openssl genpkey -algorithm X25519"
+const (
+	stanzaX25519 = 1
+	stanzaRSA    = 2
+
+	minRSABits = 2048
+)
+
+var stanzaLabel = []byte("pt-secure-collect")
+
+type stanza struct {
+	kind byte
+	data []byte
+}
+
+// wrapKey encrypts the file key for a recipient
+func wrapKey(recipient interface{}, key []byte) (stanza, error) {
+	switch pub := recipient.(type) {
+	case *ecdh.PublicKey:
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return stanza{}, errors.Wrap(err, "Cannot generate an ephemeral key")
+		}
+		shared, err := ephemeral.ECDH(pub)
+		if err != nil {
+			return stanza{}, errors.Wrap(err, "Cannot compute the shared secret")
+		}
+		aead, err := x25519AEAD(shared, ephemeral.PublicKey(), pub)
+		if err != nil {
+			return stanza{}, err
+		}
+		data := append([]byte{}, ephemeral.PublicKey().Bytes()...)
+		data = aead.Seal(data, make([]byte, aead.NonceSize()), key, nil)
+		return stanza{kind: stanzaX25519, data: data}, nil
+	case *rsa.PublicKey:
+		data, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, stanzaLabel)
+		if err != nil {
+			return stanza{}, errors.Wrap(err, "Cannot encrypt the file key")
+		}
+		return stanza{kind: stanzaRSA, data: data}, nil
+	}
+	return stanza{}, errors.Errorf("Unsupported public key type %T", recipient)
+}
+
+// unwrapKey decrypts the file key, it fails when the stanza was not written for identity
+func unwrapKey(identity interface{}, s stanza) ([]byte, error) {
+	switch priv := identity.(type) {
+	case *ecdh.PrivateKey:
+		if s.kind != stanzaX25519 || len(s.data) < 32 {
+			return nil, errors.New("Not an X25519 recipient")
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(s.data[:32])
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid ephemeral key")
+		}
+		shared, err := priv.ECDH(ephemeral)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot compute the shared secret")
+		}
+		aead, err := x25519AEAD(shared, ephemeral, priv.PublicKey())
+		if err != nil {
+			return nil, err
+		}
+		return aead.Open(nil, make([]byte, aead.NonceSize()), s.data[32:], nil)
+	case *rsa.PrivateKey:
+		if s.kind != stanzaRSA {
+			return nil, errors.New("Not an RSA recipient")
+		}
+		return rsa.DecryptOAEP(sha256.New(), nil, priv, s.data, stanzaLabel)
+	}
+	return nil, errors.Errorf("Unsupported private key type %T", identity)
+}
+
+// x25519AEAD returns the cipher encrypting the file key for an X25519 recipient
+// Ephemeral keys are never reused, so a zero nonce can be used
+func x25519AEAD(shared []byte, ephemeral, recipient *ecdh.PublicKey) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeral.Bytes()...), recipient.Bytes()...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, stanzaLabel), key); err != nil {
+		return nil, errors.Wrap(err, "Cannot derive the key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot create the cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+func readPEM(filename string) (*pem.Block, error) {
+	content, err := os.ReadFile(expandHomeDir(filename))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot read key file %q", filename)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.Errorf("No PEM data in key file %q", filename)
+	}
+	return block, nil
+}
+
+// loadPublicKey reads an X25519 or RSA public key
+func loadPublicKey(filename string) (interface{}, error) {
+	block, err := readPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot parse public key %q", filename)
+	}
+	switch pub := key.(type) {
+	case *ecdh.PublicKey:
+		if pub.Curve() == ecdh.X25519() {
+			return pub, nil
+		}
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, errors.Errorf("RSA public key %q is too short, at least %d bits are required", filename, minRSABits)
+		}
+		return pub, nil
+	}
+	return nil, errors.Errorf("Unsupported public key %q, only X25519 and RSA keys are supported", filename)
+}
+
+// loadPrivateKey reads an X25519 or RSA private key
+func loadPrivateKey(filename string) (interface{}, error) {
+	block, err := readPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		return key, errors.Wrapf(err, "Cannot parse private key %q", filename)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot parse private key %q", filename)
+	}
+	switch priv := key.(type) {
+	case *ecdh.PrivateKey:
+		if priv.Curve() == ecdh.X25519() {
+			return priv, nil
+		}
+	case *rsa.PrivateKey:
+		return priv, nil
+	}
+	return nil, errors.Errorf("Unsupported private key %q, only X25519 and RSA keys are supported", filename)
+}
+
+// generateKeys writes a new X25519 private key to privateFile, and its public key to privateFile.pub
+func generateKeys(privateFile string) error {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "Cannot generate the key")
+	}
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return errors.Wrap(err, "Cannot encode the private key")
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.PublicKey())
+	if err != nil {
+		return errors.Wrap(err, "Cannot encode the public key")
+	}
+
+	publicFile := privateFile + ".pub"
+	log.Infof("Writing the private key into %q and the public key into %q", privateFile, publicFile)
+	// never overwrite a private key, files encrypted for it could not be decrypted anymore
+	if err := writePEM(privateFile, "PRIVATE KEY", private, os.O_EXCL, 0o600); err != nil {
+		return err
+	}
+	return writePEM(publicFile, "PUBLIC KEY", public, os.O_TRUNC, 0o644)
+}
+
+func writePEM(filename, blockType string, content []byte, flag int, perm os.FileMode) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|flag, perm)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot create key file %q", filename)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: content}); err != nil {
+		return errors.Wrapf(err, "Cannot write key file %q", filename)
+	}
+	return f.Close()
+}
+
+// loadKeys reads the keys used by the command: public keys of --recipient, the private key of --private-key,
+// or the password otherwise
+func loadKeys(opts *cliOptions) (keys, error) {
+	var k keys
+	switch opts.Command {
+	case collectCmd, encryptCmd:
+		for _, filename := range *opts.Recipients {
+			recipient, err := loadPublicKey(filename)
+			if err != nil {
+				return k, err
+			}
+			k.recipients = append(k.recipients, recipient)
+		}
+	case decryptCmd:
+		if *opts.PrivateKey != "" {
+			identity, err := loadPrivateKey(*opts.PrivateKey)
+			if err != nil {
+				return k, err
+			}
+			k.identity = identity
+		}
+	}
+	if len(k.recipients) == 0 && k.identity == nil {
+		k.password = []byte(*opts.EncryptPassword)
+	}
+	return k, nil
+}
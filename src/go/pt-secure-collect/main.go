@@ -18,6 +18,8 @@ import (
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/percona/percona-toolkit/src/go/pt-secure-collect/sanitize"
 )
 
 type cliOptions struct {
@@ -27,10 +29,15 @@ type cliOptions struct {
 	DecryptCommand *kingpin.CmdClause
 	DecryptInFile  *string
 	DecryptOutFile *string
+	PrivateKey     *string // decrypt files encrypted for recipients
 
 	EncryptCommand *kingpin.CmdClause
 	EncryptInFile  *string
 	EncryptOutFile *string
+	Recipients     *[]string // public key files, the output is encrypted for them instead of with a password
+
+	KeygenCommand *kingpin.CmdClause
+	KeygenOutFile *string
 
 	CollectCommand  *kingpin.CmdClause
 	BinDir          *string
@@ -44,19 +51,50 @@ type cliOptions struct {
 	MySQLPort       *int
 	MySQLUser       *string
 	MySQLPass       *string
+	// MongoDB profile flags
+	MongoDBHost     *string
+	MongoDBPort     *int
+	MongoDBUser     *string
+	MongoDBPass     *string
+	MongoDBAuthDB   *string
+	MongoDBDatabase *string // database to profile with pt-mongodb-query-digest
+	AskMongoDBPass  *bool
+	// PostgreSQL profile flags
+	PGHost     *string
+	PGPort     *int
+	PGUser     *string
+	PGPass     *string
+	PGDatabase *string
+	AskPGPass  *bool
 
 	NoEncrypt           *bool
 	NoSanitize          *bool
 	NoSanitizeHostnames *bool
 	NoSanitizeQueries   *bool
+	NoSanitizeIPs       *bool
+	NoSanitizeEmails    *bool
+	NoSanitizeUsers     *bool
+	NoSanitizeSchemas   *bool
 	NoCollect           *bool
 	NoRemoveTempFiles   *bool
+	BinaryFiles         *string // skip or copy binary files, which can not be sanitized
 
 	SanitizeCommand       *kingpin.CmdClause
 	SanitizeInputFile     *string
 	SanitizeOutputFile    *string
 	DontSanitizeHostnames *bool
 	DontSanitizeQueries   *bool
+	DontSanitizeIPs       *bool
+	DontSanitizeEmails    *bool
+	DontSanitizeUsers     *bool
+	DontSanitizeSchemas   *bool
+
+	// shared by the collect and sanitize commands
+	Profile       *string // mysql, mongodb or postgresql
+	SanitizeRules *string // file of user-supplied rules
+	MappingFile   *string // pseudonyms and their original values, never added to the tar file
+
+	keys keys
 }
 
 type myDefaults struct {
@@ -73,15 +111,40 @@ const (
 	encryptCmd       = "encrypt"
 	collectCmd       = "collect"
 	sanitizeCmd      = "sanitize"
+	keygenCmd        = "keygen"
+	binaryFilesSkip  = "skip"
+	binaryFilesCopy  = "copy"
 	defaultMySQLHost = "127.0.0.1"
 	defaultMySQLPort = 3306
 )
 
 var (
-	defaultCmds = []string{
-		"pt-stalk --no-stalk --iterations=2 --sleep=30 --host=$mysql-host --dest=$temp-dir --port=$mysql-port --user=$mysql-user --password=$mysql-pass",
-		"pt-summary",
-		"pt-mysql-summary --host=$mysql-host --port=$mysql-port --user=$mysql-user --password=$mysql-pass",
+	// commands run by the collect command for each profile, the MySQL profile being the default
+	profileCmds = map[string][]string{
+		sanitize.MySQL: {
+			"pt-stalk --no-stalk --iterations=2 --sleep=30 --host=$mysql-host --dest=$temp-dir --port=$mysql-port --user=$mysql-user --password=$mysql-pass",
+			"pt-summary",
+			"pt-mysql-summary --host=$mysql-host --port=$mysql-port --user=$mysql-user --password=$mysql-pass",
+		},
+		sanitize.MongoDB: {
+			"pt-summary",
+			"pt-mongodb-summary $mongodb-auth $mongodb-host:$mongodb-port",
+			"pt-mongodb-query-digest $mongodb-auth --database=$mongodb-database $mongodb-host:$mongodb-port",
+			"mongosh --quiet --host=$mongodb-host --port=$mongodb-port $mongodb-auth --eval " +
+				"'EJSON.stringify({serverStatus: db.adminCommand({serverStatus: 1}), diagnosticData: db.adminCommand({getDiagnosticData: 1})}, null, 2)'",
+		},
+		sanitize.PostgreSQL: {
+			"pt-summary",
+			"pt-pg-summary $pg-conn",
+			"psql $pg-conn --dbname=$pg-database --no-password --expanded" +
+				" -c 'SELECT name, setting, unit, source FROM pg_settings'" +
+				" -c 'SELECT * FROM pg_stat_activity'" +
+				" -c 'SELECT * FROM pg_stat_database'" +
+				" -c 'SELECT * FROM pg_stat_user_tables'" +
+				" -c 'SELECT * FROM pg_stat_user_indexes'" +
+				" -c 'SELECT * FROM pg_stat_bgwriter'" +
+				" -c 'SELECT * FROM pg_stat_replication'",
+		},
 	}
 
 	// We do not set anything here, these variables are defined by the Makefile
@@ -126,6 +189,8 @@ func main() {
 		}
 	case encryptCmd, decryptCmd:
 		err = encryptorCmd(opts)
+	case keygenCmd:
+		err = generateKeys(*opts.KeygenOutFile)
 	case sanitizeCmd:
 		err = sanitizeFile(opts)
 	}
@@ -154,7 +219,7 @@ func removeTempFiles(tempDir string, removeTarFile bool) error {
 
 		filename := path.Join(tempDir, file.Name())
 		log.Debugf("Removing file %q", filename)
-		if err = os.Remove(filename); err != nil {
+		if err = os.RemoveAll(filename); err != nil {
 			log.Warnf("Cannot remove %q: %s", filename, err)
 		}
 	}
@@ -167,8 +232,11 @@ func processCliParams(baseTempPath string, usageWriter io.Writer) (*cliOptions,
 
 	// Do not remove the extra space after \n. That's to trick the help template to not to remove the new line
 	msg := "Collect, sanitize, pack and encrypt data.\nBy default, this program will collect the output of:"
-	for _, cmd := range defaultCmds {
-		msg += "\n " + cmd
+	for _, profile := range sanitize.Engines {
+		msg += fmt.Sprintf("\n \nWith --profile=%s:", profile)
+		for _, cmd := range profileCmds[profile] {
+			msg += "\n " + cmd
+		}
 	}
 	msg += "\n "
 
@@ -188,16 +256,27 @@ func processCliParams(baseTempPath string, usageWriter io.Writer) (*cliOptions,
 		CollectCommand:  app.Command(collectCmd, "Collect, sanitize, pack and encrypt data from pt-tools."),
 		DecryptCommand:  app.Command(decryptCmd, "Decrypt an encrypted file. The password will be requested from the terminal."),
 		EncryptCommand:  app.Command(encryptCmd, "Encrypt a file. The password will be requested from the terminal."),
-		SanitizeCommand: app.Command(sanitizeCmd, "Replace queries in a file by their fingerprints and obfuscate hostnames."),
+		SanitizeCommand: app.Command(sanitizeCmd, "Replace queries in a file by their fingerprints, redact credentials and replace sensitive values by pseudonyms."),
+		KeygenCommand:   app.Command(keygenCmd, "Generate a key pair, to encrypt files for its owner with --recipient."),
+		Recipients:      &[]string{},
+		Profile:         new(string),
+		SanitizeRules:   new(string),
+		MappingFile:     new(string),
 		Debug:           app.Flag("debug", "Enable debug log level.").Bool(),
 	}
 	// Decrypt command flags
 	opts.DecryptInFile = opts.DecryptCommand.Arg("infile", "Encrypted file.").Required().String()
 	opts.DecryptOutFile = opts.DecryptCommand.Flag("outfile", "Unencrypted file. Default: same name without .aes extension").String()
+	opts.PrivateKey = opts.DecryptCommand.Flag("private-key", "Private key file, to decrypt files encrypted with --recipient.").String()
 
 	// Encrypt command flags
 	opts.EncryptInFile = opts.EncryptCommand.Arg("infile", "Unencrypted file.").Required().String()
 	opts.EncryptOutFile = opts.EncryptCommand.Flag("outfile", "Encrypted file. Default: <input file>.aes").String()
+	opts.EncryptCommand.Flag("recipient", "Encrypt the file for the owner of this public key file instead of with a password."+
+		" This parameter can be used more than once.").StringsVar(opts.Recipients)
+
+	// Keygen command flags
+	opts.KeygenOutFile = opts.KeygenCommand.Arg("private-key", "Private key file. The public key is written to <private key file>.pub").Required().String()
 
 	// Collect command flags
 	opts.BinDir = opts.CollectCommand.Flag("bin-dir", "Directory having the Percona Toolkit binaries (if they are not in PATH).").String()
@@ -210,24 +289,62 @@ func processCliParams(baseTempPath string, usageWriter io.Writer) (*cliOptions,
 	opts.MySQLUser = opts.CollectCommand.Flag("mysql-user", "MySQL user name.").String()
 	opts.MySQLPass = opts.CollectCommand.Flag("mysql-password", "MySQL password.").String()
 	opts.AskMySQLPass = opts.CollectCommand.Flag("ask-mysql-pass", "Ask MySQL password.").Bool()
+	// MongoDB related flags
+	opts.MongoDBHost = opts.CollectCommand.Flag("mongodb-host", "MongoDB host.").Default(defaultMySQLHost).String()
+	opts.MongoDBPort = opts.CollectCommand.Flag("mongodb-port", "MongoDB port.").Default("27017").Int()
+	opts.MongoDBUser = opts.CollectCommand.Flag("mongodb-user", "MongoDB user name.").String()
+	opts.MongoDBPass = opts.CollectCommand.Flag("mongodb-password", "MongoDB password.").String()
+	opts.MongoDBAuthDB = opts.CollectCommand.Flag("mongodb-auth-db", "MongoDB authentication database.").Default("admin").String()
+	opts.MongoDBDatabase = opts.CollectCommand.Flag("mongodb-database", "Database to profile with pt-mongodb-query-digest."+
+		" If omitted, pt-mongodb-query-digest is not run.").String()
+	opts.AskMongoDBPass = opts.CollectCommand.Flag("ask-mongodb-pass", "Ask MongoDB password.").Bool()
+	// PostgreSQL related flags
+	opts.PGHost = opts.CollectCommand.Flag("pg-host", "PostgreSQL host.").String()
+	opts.PGPort = opts.CollectCommand.Flag("pg-port", "PostgreSQL port.").Int()
+	opts.PGUser = opts.CollectCommand.Flag("pg-user", "PostgreSQL user name.").String()
+	opts.PGPass = opts.CollectCommand.Flag("pg-password", "PostgreSQL password.").String()
+	opts.PGDatabase = opts.CollectCommand.Flag("pg-database", "PostgreSQL database to connect to.").Default("postgres").String()
+	opts.AskPGPass = opts.CollectCommand.Flag("ask-pg-pass", "Ask PostgreSQL password.").Bool()
 	// Additional flags
+	opts.CollectCommand.Flag("profile", "Collect data of this engine: mysql, mongodb or postgresql.").
+		Default(sanitize.MySQL).EnumVar(opts.Profile, sanitize.Engines...)
 	opts.AdditionalCmds = opts.CollectCommand.Flag("extra-cmd",
 		"Also run this command as part of the data collection. This parameter can be used more than once.").Strings()
 	opts.EncryptPassword = opts.CollectCommand.Flag("encrypt-password", "Encrypt the output file using this password."+
 		" If omitted, the file won't be encrypted.").String()
+	opts.CollectCommand.Flag("recipient", "Encrypt the output file for the owner of this public key file instead of with a password."+
+		" This parameter can be used more than once.").StringsVar(opts.Recipients)
 	// No-Flags
 	opts.NoCollect = opts.CollectCommand.Flag("no-collect", "Do not collect data").Bool()
 	opts.NoSanitize = opts.CollectCommand.Flag("no-sanitize", "Sanitize data").Bool()
 	opts.NoEncrypt = opts.CollectCommand.Flag("no-encrypt", "Do not encrypt the output file.").Bool()
 	opts.NoSanitizeHostnames = opts.CollectCommand.Flag("no-sanitize-hostnames", "Don't sanitize host names.").Bool()
 	opts.NoSanitizeQueries = opts.CollectCommand.Flag("no-sanitize-queries", "Do not replace queries by their fingerprints.").Bool()
+	opts.NoSanitizeIPs = opts.CollectCommand.Flag("no-sanitize-ips", "Do not replace IP addresses by pseudonyms.").Bool()
+	opts.NoSanitizeEmails = opts.CollectCommand.Flag("no-sanitize-emails", "Do not replace email addresses by pseudonyms.").Bool()
+	opts.NoSanitizeUsers = opts.CollectCommand.Flag("no-sanitize-users", "Do not replace user names by pseudonyms.").Bool()
+	opts.NoSanitizeSchemas = opts.CollectCommand.Flag("no-sanitize-schemas", "Do not replace schema and table names by pseudonyms.").Bool()
 	opts.NoRemoveTempFiles = opts.CollectCommand.Flag("no-remove-temp-files", "Do not remove temporary files.").Bool()
+	opts.BinaryFiles = opts.CollectCommand.Flag("binary-files", "What to do with binary files, and compressed files"+
+		" which can not be sanitized: skip them, or copy them unmodified.").Default(binaryFilesSkip).Enum(binaryFilesSkip, binaryFilesCopy)
+	opts.CollectCommand.Flag("sanitize-rules", "File of additional sanitization rules.").StringVar(opts.SanitizeRules)
+	opts.CollectCommand.Flag("mapping-file", "Write pseudonyms and their original values to this file, it is not added to the tar file."+
+		" Default: <temp dir>-mapping.json").StringVar(opts.MappingFile)
 
 	// Sanitize command flags
 	opts.SanitizeInputFile = opts.SanitizeCommand.Flag("input-file", "Input file. If not specified, the input will be Stdin.").String()
 	opts.SanitizeOutputFile = opts.SanitizeCommand.Flag("output-file", "Output file. If not specified, the input will be Stdout.").String()
 	opts.DontSanitizeHostnames = opts.SanitizeCommand.Flag("no-sanitize-hostnames", "Don't sanitize host names.").Bool()
 	opts.DontSanitizeQueries = opts.SanitizeCommand.Flag("no-sanitize-queries", "Don't replace queries by their fingerprints.").Bool()
+	opts.DontSanitizeIPs = opts.SanitizeCommand.Flag("no-sanitize-ips", "Don't replace IP addresses by pseudonyms.").Bool()
+	opts.DontSanitizeEmails = opts.SanitizeCommand.Flag("no-sanitize-emails", "Don't replace email addresses by pseudonyms.").Bool()
+	opts.DontSanitizeUsers = opts.SanitizeCommand.Flag("no-sanitize-users", "Don't replace user names by pseudonyms.").Bool()
+	opts.DontSanitizeSchemas = opts.SanitizeCommand.Flag("no-sanitize-schemas", "Don't replace schema and table names by pseudonyms.").Bool()
+	opts.SanitizeCommand.Flag("sanitize-rules", "File of additional sanitization rules.").StringVar(opts.SanitizeRules)
+	opts.SanitizeCommand.Flag("profile", "Sanitize for the query syntax and system accounts of this engine: mysql, mongodb or postgresql.").
+		Default(sanitize.MySQL).EnumVar(opts.Profile, sanitize.Engines...)
+	opts.SanitizeCommand.Flag("mapping-file", "Write pseudonyms and their original values to this file."+
+		" Pseudonyms already in the file are kept.").StringVar(opts.MappingFile)
 
 	opts.Command, err = app.Parse(os.Args[1:])
 	if err != nil {
@@ -241,6 +358,8 @@ func processCliParams(baseTempPath string, usageWriter io.Writer) (*cliOptions,
 	*opts.BinDir = expandHomeDir(*opts.BinDir)
 	*opts.ConfigFile = expandHomeDir(*opts.ConfigFile)
 	*opts.TempDir = expandHomeDir(*opts.TempDir)
+	*opts.SanitizeRules = expandHomeDir(*opts.SanitizeRules)
+	*opts.MappingFile = expandHomeDir(*opts.MappingFile)
 	for _, incDir := range *opts.IncludeDirs {
 		incDir = expandHomeDir(incDir)
 	}
@@ -249,38 +368,59 @@ func processCliParams(baseTempPath string, usageWriter io.Writer) (*cliOptions,
 		os.Setenv("PATH", fmt.Sprintf("%s%s%s", *opts.BinDir, string(os.PathListSeparator), os.Getenv("PATH")))
 	}
 
-	lp, err := exec.LookPath("pt-summary")
-	if (err != nil || lp == "") && *opts.BinDir == "" && opts.Command == "collect" && !*opts.NoCollect {
+	lp, lpErr := exec.LookPath("pt-summary")
+	if (lpErr != nil || lp == "") && *opts.BinDir == "" && opts.Command == "collect" && !*opts.NoCollect {
 		return nil, errors.New("Cannot find Percona Toolkit binaries. Please run this tool again using --bin-dir parameter")
 	}
 
 	switch opts.Command {
 	case collectCmd:
-		mycnf, err := getParamsFromMyCnf(*opts.ConfigFile)
-		if err == nil {
-			if err = validateMySQLParams(opts, mycnf); err != nil {
-				return nil, err
+		switch *opts.Profile {
+		case sanitize.MySQL:
+			if mycnf, cnfErr := getParamsFromMyCnf(*opts.ConfigFile); cnfErr == nil {
+				if err = validateMySQLParams(opts, mycnf); err != nil {
+					return nil, err
+				}
 			}
-		}
-		if *opts.AskMySQLPass {
-			if err = askMySQLPassword(opts); err != nil {
-				return nil, err
+			if *opts.AskMySQLPass {
+				err = askPassword("MySQL", *opts.MySQLUser, opts.MySQLPass)
+			}
+		case sanitize.MongoDB:
+			if *opts.AskMongoDBPass {
+				err = askPassword("MongoDB", *opts.MongoDBUser, opts.MongoDBPass)
 			}
+		case sanitize.PostgreSQL:
+			if *opts.AskPGPass {
+				err = askPassword("PostgreSQL", *opts.PGUser, opts.PGPass)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(*opts.Recipients) == 0 {
+			err = askEncryptionPassword(opts, true)
 		}
-		err = askEncryptionPassword(opts, true)
 	case encryptCmd:
-		err = askEncryptionPassword(opts, true)
+		if len(*opts.Recipients) == 0 {
+			err = askEncryptionPassword(opts, true)
+		}
 	case decryptCmd:
 		if !strings.HasSuffix(*opts.DecryptInFile, ".aes") && *opts.DecryptOutFile == "" {
 			return nil, fmt.Errorf("Input file does not have .aes extension. I cannot infer the output file")
 		}
-		err = askEncryptionPassword(opts, false)
+		if *opts.PrivateKey == "" {
+			err = askEncryptionPassword(opts, false)
+		}
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	if opts.keys, err = loadKeys(opts); err != nil {
+		return nil, err
+	}
+
 	return opts, nil
 }
 
@@ -317,15 +457,13 @@ func validateMySQLParams(opts *cliOptions, mycnf *myDefaults) error {
 	return nil
 }
 
-func askMySQLPassword(opts *cliOptions) error {
-	if *opts.AskMySQLPass {
-		fmt.Printf("MySQL password for user %q:", *opts.MySQLUser)
-		passb, err := terminal.ReadPassword(0)
-		if err != nil {
-			return errors.Wrap(err, "Cannot read MySQL password from the terminal")
-		}
-		*opts.MySQLPass = string(passb)
+func askPassword(engine, user string, pass *string) error {
+	fmt.Printf("%s password for user %q:", engine, user)
+	passb, err := terminal.ReadPassword(0)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot read %s password from the terminal", engine)
 	}
+	*pass = string(passb)
 	return nil
 }
 
@@ -1,13 +1,28 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/percona/percona-toolkit/src/go/pt-secure-collect/sanitize"
 )
 
 func TestProcessCliParams(t *testing.T) {
@@ -41,6 +56,355 @@ func TestProcessCliParams(t *testing.T) {
 func TestCollect(t *testing.T) {
 }
 
+func TestProfileCommands(t *testing.T) {
+	tests := []struct {
+		Args     []string
+		WantCmds []string
+	}{
+		{
+			Args: []string{"--profile=mongodb", "--mongodb-user=app", "--mongodb-password=secret"},
+			WantCmds: []string{
+				"pt-summary",
+				"pt-mongodb-summary --username=app --password --authenticationDatabase=admin 127.0.0.1:27017",
+				"mongosh --quiet --host=127.0.0.1 --port=27017 --username=app --password --authenticationDatabase=admin --eval " +
+					"'EJSON.stringify({serverStatus: db.adminCommand({serverStatus: 1}), diagnosticData: db.adminCommand({getDiagnosticData: 1})}, null, 2)'",
+			},
+		},
+		{
+			Args: []string{"--profile=postgresql", "--pg-host=db1", "--pg-user=app", "--pg-password=secret"},
+			WantCmds: []string{
+				"pt-summary",
+				"pt-pg-summary --host=db1 --username=app",
+			},
+		},
+	}
+
+	binDir, err := filepath.Abs("../../../bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		os.Args = append([]string{toolname, "collect", "--bin-dir=" + binDir, "--no-encrypt"}, test.Args...)
+		opts, err := processCliParams(t.TempDir(), nil)
+		if err != nil {
+			t.Fatalf("Test #%d: cannot parse the parameters: %s", i, err)
+		}
+		cmds, safeCmds, err := getCommandsToRun(profileCmds[*opts.Profile], opts)
+		if err != nil {
+			t.Fatalf("Test #%d: cannot get the commands: %s", i, err)
+		}
+		if !reflect.DeepEqual(safeCmds[:len(test.WantCmds)], test.WantCmds) {
+			t.Errorf("Test #%d: commands don't match:\n%q\nwant\n%q", i, safeCmds, test.WantCmds)
+		}
+		for _, cmd := range cmds {
+			for _, arg := range cmd.Args {
+				if strings.Contains(arg, "secret") {
+					t.Errorf("Test #%d: the password is on the command line %q", i, cmd.Args)
+				}
+			}
+			// passwords are only given to database commands
+			database := cmd.Args[0] != "pt-summary" && !strings.HasSuffix(cmd.Args[0], "/pt-summary")
+			if pg := *opts.PGPass != "" && database; pg != (len(cmd.Env) > 0 && cmd.Env[len(cmd.Env)-1] == "PGPASSWORD=secret") {
+				t.Errorf("Test #%d: PGPASSWORD is set %v for %q, want %v", i, !pg, cmd.Args, pg)
+			}
+			stdin := ""
+			if cmd.Stdin != nil {
+				b, _ := io.ReadAll(cmd.Stdin)
+				stdin = string(b)
+			}
+			if mongo := *opts.MongoDBPass != "" && database; mongo != (stdin == "secret\n") {
+				t.Errorf("Test #%d: the password is given %v on stdin of %q, want %v", i, !mongo, cmd.Args, mongo)
+			}
+		}
+	}
+}
+
+func TestProcessFiles(t *testing.T) {
+	gzipped := func(content []byte) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Write(content)
+		gw.Close()
+		return buf.Bytes()
+	}
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	for name, content := range map[string]string{"error.log": "db1.example.com\n", "core": "\x00\x01"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	fw, _ := zw.Create("a.txt")
+	fw.Write([]byte("db1.example.com"))
+	zw.Close()
+	// truncated files, such as a log being rotated
+	truncated := func(content []byte) []byte {
+		return content[:len(content)/2]
+	}
+
+	dataDir := t.TempDir()
+	includeDir := filepath.Join(t.TempDir(), "mysql-logs")
+	files := map[string][]byte{
+		filepath.Join(dataDir, "pt-summary.out"):         []byte("Hostname | db1.example.com\n"),
+		filepath.Join(dataDir, "core"):                   {0x7f, 'E', 'L', 'F', 0},
+		filepath.Join(dataDir, "data.xz"):                []byte("\xfd7zXZ\x00\x00"),
+		filepath.Join(dataDir, "sub", "notes.txt"):       []byte("ip 10.0.0.5"),
+		filepath.Join(dataDir, "slow.log.gz"):            gzipped([]byte("SELECT * FROM t WHERE id = 1;\n")),
+		filepath.Join(dataDir, "logs.tgz"):               gzipped(tarball.Bytes()),
+		filepath.Join(dataDir, "x.zip"):                  zipped.Bytes(),
+		filepath.Join(dataDir, "old.log.gz"):             truncated(gzipped(bytes.Repeat([]byte("db1.example.com 10.0.0.5\n"), 1000))),
+		filepath.Join(dataDir, "old.tgz"):                truncated(gzipped(tarball.Bytes())),
+		filepath.Join(includeDir, "nested", "error.log"): []byte("db2.example.com\n"),
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(name), os.ModePerm)
+		if err := os.WriteFile(name, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := sanitize.New(sanitize.Options{Hostnames: true, IPs: true, Queries: true})
+	if err := processFiles(dataDir, []string{includeDir}, dataDir, s, false); err != nil {
+		t.Fatalf("Cannot process files: %s", err)
+	}
+
+	read := func(name string) []byte {
+		content, err := os.ReadFile(filepath.Join(dataDir, name))
+		if err != nil {
+			t.Errorf("Cannot read sanitized file: %s", err)
+		}
+		return content
+	}
+	gunzip := func(content []byte) *gzip.Reader {
+		gr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("Cannot read gzip file: %s", err)
+		}
+		return gr
+	}
+	for name, want := range map[string]string{
+		"pt-summary.out":              "Hostname | host-1\n",
+		"sub/notes.txt":               "ip ip-1",
+		"mysql-logs/nested/error.log": "host-2\n",
+	} {
+		if content := string(read(name)); content != want {
+			t.Errorf("Sanitized %q is %q, want %q", name, content, want)
+		}
+	}
+	if content, _ := io.ReadAll(gunzip(read("slow.log.gz"))); string(content) != "select * from t where id = ?;\n" {
+		t.Errorf("Sanitized gzip file is %q", content)
+	}
+	tr := tar.NewReader(gunzip(read("logs.tgz")))
+	header, err := tr.Next()
+	if err != nil || header.Name != "error.log" {
+		t.Fatalf("Unexpected file %v in the sanitized tar file: %v", header, err)
+	}
+	if content, _ := io.ReadAll(tr); string(content) != "host-1\n" {
+		t.Errorf("Sanitized tar file has %q", content)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("The binary file of the tar file is not skipped")
+	}
+	zipContent := read("x.zip")
+	zr, err := zip.NewReader(bytes.NewReader(zipContent), int64(len(zipContent)))
+	if err != nil || len(zr.File) != 1 {
+		t.Fatalf("Cannot read the sanitized zip file: %v", err)
+	}
+	rc, _ := zr.File[0].Open()
+	if content, _ := io.ReadAll(rc); string(content) != "host-1" {
+		t.Errorf("Sanitized zip file has %q", content)
+	}
+	for _, name := range []string{"core", "data.xz", "old.log.gz", "old.tgz"} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); !os.IsNotExist(err) {
+			t.Errorf("File %q is not skipped", name)
+		}
+	}
+	if partial, _ := filepath.Glob(filepath.Join(dataDir, ".old*")); len(partial) > 0 {
+		t.Errorf("Partially written files are kept: %v", partial)
+	}
+
+	var manifest []manifestEntry
+	if err := json.Unmarshal(read(manifestFile), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	treatments := map[string]string{}
+	for _, entry := range manifest {
+		treatments[entry.File] = entry.Treatment
+		if entry.File == "old.log.gz" && entry.Reason != "cannot read archive: unexpected EOF" {
+			t.Errorf("Truncated gzip file is skipped with reason %q", entry.Reason)
+		}
+	}
+	want := map[string]string{
+		"core":                        treatmentSkipped,
+		"data.xz":                     treatmentSkipped,
+		"logs.tgz/core":               treatmentSkipped,
+		"logs.tgz/error.log":          treatmentSanitized,
+		"pt-summary.out":              treatmentSanitized,
+		"slow.log.gz":                 treatmentSanitized,
+		"sub/notes.txt":               treatmentSanitized,
+		"x.zip/a.txt":                 treatmentSanitized,
+		"mysql-logs/nested/error.log": treatmentSanitized,
+		"old.log.gz":                  treatmentSkipped,
+		"old.tgz":                     treatmentSkipped,
+	}
+	if !reflect.DeepEqual(treatments, want) {
+		t.Errorf("Unexpected manifest %v", treatments)
+	}
+
+	// binary files are copied unmodified
+	if err := os.WriteFile(filepath.Join(dataDir, "core"), files[filepath.Join(dataDir, "core")], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := processFiles(dataDir, nil, dataDir, s, true); err != nil {
+		t.Fatalf("Cannot process files: %s", err)
+	}
+	if !bytes.Equal(read("core"), files[filepath.Join(dataDir, "core")]) {
+		t.Errorf("Binary file is not copied unmodified")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	password := keys{password: []byte("secret")}
+	for _, size := range []int{0, 1, 100, 256, 1000} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		var encrypted bytes.Buffer
+		if err := encryptStream(&encrypted, bytes.NewReader(plain), password, 128); err != nil {
+			t.Fatalf("Cannot encrypt %d bytes: %s", size, err)
+		}
+		if !bytes.HasPrefix(encrypted.Bytes(), magic) {
+			t.Errorf("Encrypted file does not start with the magic")
+		}
+
+		var decrypted bytes.Buffer
+		if err := decryptStream(&decrypted, bytes.NewReader(encrypted.Bytes()), password); err != nil {
+			t.Fatalf("Cannot decrypt %d bytes: %s", size, err)
+		}
+		if !bytes.Equal(plain, decrypted.Bytes()) {
+			t.Errorf("Decrypted content of %d bytes does not match", size)
+		}
+
+		if err := decryptStream(io.Discard, bytes.NewReader(encrypted.Bytes()), keys{password: []byte("wrong")}); err == nil {
+			t.Errorf("Decrypting %d bytes with a wrong password must fail", size)
+		}
+
+		tampered := append([]byte{}, encrypted.Bytes()...)
+		tampered[len(tampered)-1] ^= 1
+		if err := decryptStream(io.Discard, bytes.NewReader(tampered), password); err == nil {
+			t.Errorf("Decrypting %d tampered bytes must fail", size)
+		}
+
+		// truncated at a chunk boundary
+		if size > 128 {
+			truncated := encrypted.Bytes()[:len(header{keyType: keyScrypt}.marshal())+128+16]
+			if err := decryptStream(io.Discard, bytes.NewReader(truncated), password); err == nil {
+				t.Errorf("Decrypting %d truncated bytes must fail", size)
+			}
+		}
+	}
+
+	// the same password must not produce the same file
+	var a, b bytes.Buffer
+	encryptStream(&a, strings.NewReader("data"), password, 128)
+	encryptStream(&b, strings.NewReader("data"), password, 128)
+	if bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Errorf("Encrypting twice with the same password produced the same file")
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	// encrypted by older versions with the password "secret"
+	key := sha256.Sum256([]byte("secret"))
+	block, _ := aes.NewCipher(key[:])
+	var iv [aes.BlockSize]byte
+	legacy := make([]byte, 11)
+	cipher.NewOFB(block, iv[:]).XORKeyStream(legacy, []byte("legacy data"))
+
+	dir := t.TempDir()
+	infile, outfile := filepath.Join(dir, "data.aes"), filepath.Join(dir, "data")
+	if err := os.WriteFile(infile, legacy, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := decrypt(infile, outfile, keys{password: []byte("secret")}); err != nil {
+		t.Fatalf("Cannot decrypt the legacy file: %s", err)
+	}
+	if content, _ := os.ReadFile(outfile); string(content) != "legacy data" {
+		t.Errorf("Decrypted legacy file is %q", content)
+	}
+
+	if err := encrypt(outfile, infile, keys{password: []byte("secret")}); err != nil {
+		t.Fatalf("Cannot encrypt: %s", err)
+	}
+	if err := decrypt(infile, outfile, keys{password: []byte("wrong")}); err == nil {
+		t.Errorf("Decrypting with a wrong password must fail")
+	}
+	if _, err := os.Stat(outfile); !os.IsNotExist(err) {
+		t.Errorf("Output file must be removed when decryption fails")
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	dir := t.TempDir()
+	x25519Key := filepath.Join(dir, "x25519.pem")
+	if err := generateKeys(x25519Key); err != nil {
+		t.Fatalf("Cannot generate keys: %s", err)
+	}
+	if err := generateKeys(x25519Key); err == nil {
+		t.Errorf("An existing private key must not be overwritten")
+	}
+	rsaKey := filepath.Join(dir, "rsa.pem")
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writePEM(rsaKey, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), os.O_EXCL, 0o600)
+	public, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	writePEM(rsaKey+".pub", "PUBLIC KEY", public, os.O_EXCL, 0o644)
+	otherKey := filepath.Join(dir, "other.pem")
+	generateKeys(otherKey)
+
+	var k keys
+	for _, filename := range []string{x25519Key + ".pub", rsaKey + ".pub"} {
+		recipient, err := loadPublicKey(filename)
+		if err != nil {
+			t.Fatalf("Cannot load public key %q: %s", filename, err)
+		}
+		k.recipients = append(k.recipients, recipient)
+	}
+	if _, err := loadPublicKey(x25519Key); err == nil {
+		t.Errorf("A private key must not be loaded as a public key")
+	}
+
+	var encrypted bytes.Buffer
+	if err := encryptStream(&encrypted, strings.NewReader("bundle"), k, 128); err != nil {
+		t.Fatalf("Cannot encrypt: %s", err)
+	}
+
+	for _, filename := range []string{x25519Key, rsaKey} {
+		identity, err := loadPrivateKey(filename)
+		if err != nil {
+			t.Fatalf("Cannot load private key %q: %s", filename, err)
+		}
+		var decrypted bytes.Buffer
+		if err := decryptStream(&decrypted, bytes.NewReader(encrypted.Bytes()), keys{identity: identity}); err != nil {
+			t.Errorf("Cannot decrypt with %q: %s", filename, err)
+		}
+		if decrypted.String() != "bundle" {
+			t.Errorf("Decrypted content with %q is %q", filename, decrypted.String())
+		}
+	}
+
+	identity, _ := loadPrivateKey(otherKey)
+	err := decryptStream(io.Discard, bytes.NewReader(encrypted.Bytes()), keys{identity: identity})
+	if err == nil || !strings.Contains(err.Error(), "not one of the recipients") {
+		t.Errorf("Decrypting with a key which is not a recipient must fail, have %v", err)
+	}
+	err = decryptStream(io.Discard, bytes.NewReader(encrypted.Bytes()), keys{password: []byte("secret")})
+	if err == nil || !strings.Contains(err.Error(), "--private-key") {
+		t.Errorf("Decrypting a file encrypted for recipients with a password must fail, have %v", err)
+	}
+}
+
 /*
 Option --version
 */
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/percona/percona-toolkit/src/go/pt-secure-collect/sanitize"
+)
+
+// Treatments of files, recorded in the manifest
+const (
+	treatmentSanitized = "sanitized"
+	treatmentCopied    = "copied"
+	treatmentSkipped   = "skipped"
+
+	// Types of files
+	typeText   = "text"
+	typeBinary = "binary"
+	typeGzip   = "gzip"
+	typeTar    = "tar"
+	typeZip    = "zip"
+
+	manifestFile = "manifest.json"
+	// archives nested deeper are handled as binary files
+	maxArchiveDepth = 4
+	// bytes read to detect the type of a file
+	sniffSize = 8000
+)
+
+// compressions which can be read but not written back, their files are handled as binary files
+var unsupportedCompressions = []struct {
+	name  string
+	magic []byte
+}{
+	{"bzip2", []byte("BZh")},
+	{"xz", []byte("\xfd7zXZ\x00")},
+	{"zstd", []byte("\x28\xb5\x2f\xfd")},
+	{"7z", []byte("7z\xbc\xaf\x27\x1c")},
+}
+
+// manifestEntry records how a file was handled. Files of archives are named after the archive, such as logs.tar.gz/error.log
+type manifestEntry struct {
+	File      string `json:"file"`
+	Type      string `json:"type"`
+	Treatment string `json:"treatment"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// archiveError is an error reading the content of an archive, such as a truncated file.
+// The archive is skipped, instead of failing the whole sanitization
+type archiveError struct {
+	error
+}
+
+// archiveReader reads the content of an archive, its errors are archiveErrors
+type archiveReader struct {
+	r io.Reader
+}
+
+func (a archiveReader) Read(b []byte) (int, error) {
+	n, err := a.r.Read(b)
+	if err != nil && err != io.EOF {
+		err = archiveError{err}
+	}
+	return n, err
+}
+
+type fileProcessor struct {
+	s *sanitize.Sanitizer
+	// copyBinary copies binary files unmodified, instead of skipping them
+	copyBinary bool
+	manifest   []manifestEntry
+}
+
+// processFiles sanitizes the trees of dataDir and includeDirs into outputDir, with the same sanitizer for pseudonyms
+// to be consistent. Files of include dirs are written into a directory named after the include dir.
+// Archives are sanitized file by file, binary files are skipped unless copyBinary is set,
+// and the treatment of every file is written into the manifest
+func processFiles(dataDir string, includeDirs []string, outputDir string, s *sanitize.Sanitizer, copyBinary bool) error {
+	p := &fileProcessor{s: s, copyBinary: copyBinary}
+	log.Debug("Sanitization process start")
+
+	dirs := []string{dataDir}
+	dirs = append(dirs, includeDirs...)
+	for i, dir := range dirs {
+		prefix := ""
+		if i > 0 {
+			prefix = filepath.Base(dir)
+		}
+		files := 0
+		err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return errors.Wrapf(err, "Cannot get the listing of %q", file)
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return err
+			}
+			// the manifest and tar files of previous runs
+			if i == 0 && (rel == manifestFile || strings.HasSuffix(rel, ".tar.gz") && filepath.Dir(rel) == ".") {
+				return nil
+			}
+			files++
+			name := filepath.ToSlash(filepath.Join(prefix, rel))
+			if !d.Type().IsRegular() {
+				p.record(name, d.Type().String(), treatmentSkipped, "not a regular file")
+				return nil
+			}
+			return p.processFile(file, filepath.Join(outputDir, prefix, rel), name)
+		})
+		if err != nil {
+			return err
+		}
+		if files == 0 {
+			return errors.Errorf("There are no files to sanitize in %q", dir)
+		}
+	}
+	return p.writeManifest(filepath.Join(outputDir, manifestFile))
+}
+
+// processFile sanitizes inputFile into outputFile, which can be the same file.
+// The output is written into a temporary file first, it is renamed once the file is completely sanitized
+func (p *fileProcessor) processFile(inputFile, outputFile, name string) error {
+	log.Debugf("Sanitizing %q", inputFile)
+	fh, err := os.Open(inputFile)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot open %q for reading", inputFile)
+	}
+	defer fh.Close()
+
+	if err := os.MkdirAll(filepath.Dir(outputFile), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "Cannot create directory for %q", outputFile)
+	}
+	ofh, err := os.CreateTemp(filepath.Dir(outputFile), "."+filepath.Base(outputFile)+"-*")
+	if err != nil {
+		return errors.Wrapf(err, "Cannot create a temporary file for %q", outputFile)
+	}
+	defer os.Remove(ofh.Name())
+	defer ofh.Close()
+
+	kept, err := p.process(name, fh, ofh, 0)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot sanitize %q", inputFile)
+	}
+	if err := ofh.Close(); err != nil {
+		return errors.Wrapf(err, "Cannot write sanitized file %q", outputFile)
+	}
+	if !kept {
+		// a skipped file must not be added to the tar file, even when sanitizing in place
+		if err := os.Remove(outputFile); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Cannot remove skipped file %q", outputFile)
+		}
+		return nil
+	}
+	log.Debugf("Writing sanitized file to %q", outputFile)
+	return errors.Wrapf(os.Rename(ofh.Name(), outputFile), "Cannot write sanitized file %q", outputFile)
+}
+
+// process sanitizes r into w according to its type, depth being the number of archives it is in.
+// It returns whether the output must be kept, w can not be used otherwise
+func (p *fileProcessor) process(name string, r io.Reader, w io.Writer, depth int) (bool, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+
+	fileType, reason := detectType(head)
+	if fileType != typeText && fileType != typeBinary && depth >= maxArchiveDepth {
+		fileType, reason = typeBinary, fileType+" archive nested too deeply"
+	}
+	switch fileType {
+	case typeText:
+		if err := p.s.SanitizeReader(br, w); err != nil {
+			return false, err
+		}
+		p.record(name, fileType, treatmentSanitized, "")
+		return true, nil
+	case typeGzip:
+		return p.processGzip(name, br, w, depth)
+	case typeTar:
+		return p.processTar(name, br, w, depth)
+	case typeZip:
+		return p.processZip(name, br, w, depth)
+	}
+
+	if !p.copyBinary {
+		p.record(name, fileType, treatmentSkipped, reason)
+		return false, nil
+	}
+	if _, err := io.Copy(w, br); err != nil {
+		return false, err
+	}
+	p.record(name, fileType, treatmentCopied, reason)
+	return true, nil
+}
+
+// processGzip sanitizes the content of a gzip file, it is compressed again
+func (p *fileProcessor) processGzip(name string, r io.Reader, w io.Writer, depth int) (bool, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		p.record(name, typeGzip, treatmentSkipped, "cannot read archive: "+err.Error())
+		return false, nil
+	}
+	gw := gzip.NewWriter(w)
+	gw.Name = gr.Name
+	entries := len(p.manifest)
+	kept, err := p.process(name, archiveReader{gr}, gw, depth+1)
+	if err != nil {
+		return p.skipArchive(name, typeGzip, entries, err)
+	}
+	if !kept {
+		return false, nil
+	}
+	return true, gw.Close()
+}
+
+// processTar sanitizes the files of a tar archive. Sanitized files are written into temporary files first,
+// because their size is written before their content
+func (p *fileProcessor) processTar(name string, r io.Reader, w io.Writer, depth int) (bool, error) {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	entries := len(p.manifest)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return p.skipArchive(name, typeTar, entries, archiveError{err})
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			// directories and links have no content to sanitize
+			if err := tw.WriteHeader(header); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		// files of a tar archive can not be read once one of them can't
+		tmp, kept, err := p.processToTemp(path.Join(name, header.Name), archiveReader{tr}, depth)
+		if err != nil {
+			return p.skipArchive(name, typeTar, entries, err)
+		}
+		if !kept {
+			continue
+		}
+		err = p.copyFromTemp(tmp, func(size int64) (io.Writer, error) {
+			header.Size = size
+			delete(header.PAXRecords, "size")
+			return tw, tw.WriteHeader(header)
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, tw.Close()
+}
+
+// processZip sanitizes the files of a zip archive, it is copied into a temporary file to be read
+func (p *fileProcessor) processZip(name string, r io.Reader, w io.Writer, depth int) (bool, error) {
+	archive, err := os.CreateTemp("", "pt-secure-collect-*.zip")
+	if err != nil {
+		return false, errors.Wrap(err, "Cannot create a temporary file")
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	size, err := io.Copy(archive, r)
+	if err != nil {
+		return false, err
+	}
+
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		p.record(name, typeZip, treatmentSkipped, "cannot read archive: "+err.Error())
+		return false, nil
+	}
+	zw := zip.NewWriter(w)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			if _, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Modified: f.Modified}); err != nil {
+				return false, err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			p.record(path.Join(name, f.Name), typeZip, treatmentSkipped, "cannot read archive: "+err.Error())
+			continue
+		}
+		// files of a zip archive are read independently, only the one which can not be read is skipped
+		entries := len(p.manifest)
+		tmp, kept, err := p.processToTemp(path.Join(name, f.Name), archiveReader{rc}, depth)
+		rc.Close()
+		if err != nil {
+			if _, err := p.skipArchive(path.Join(name, f.Name), typeZip, entries, err); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if !kept {
+			continue
+		}
+		err = p.copyFromTemp(tmp, func(int64) (io.Writer, error) {
+			return zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified})
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, zw.Close()
+}
+
+// processToTemp sanitizes a file of an archive into a temporary file, which is nil if the file is not kept
+func (p *fileProcessor) processToTemp(name string, r io.Reader, depth int) (*os.File, bool, error) {
+	tmp, err := os.CreateTemp("", "pt-secure-collect-*")
+	if err != nil {
+		return nil, false, errors.Wrap(err, "Cannot create a temporary file")
+	}
+	kept, err := p.process(name, r, tmp, depth+1)
+	if err != nil || !kept {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, false, err
+	}
+	return tmp, true, nil
+}
+
+// copyFromTemp copies and removes a temporary file, into the writer returned by create for its size
+func (p *fileProcessor) copyFromTemp(tmp *os.File, create func(size int64) (io.Writer, error)) error {
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w, err := create(size)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, tmp)
+	return err
+}
+
+// skipArchive records an archive which can not be read as skipped, instead of the files read before the error.
+// Other errors, such as writing the output, are returned
+func (p *fileProcessor) skipArchive(name, fileType string, entries int, err error) (bool, error) {
+	var readErr archiveError
+	if !errors.As(err, &readErr) {
+		return false, err
+	}
+	p.manifest = p.manifest[:entries]
+	p.record(name, fileType, treatmentSkipped, "cannot read archive: "+readErr.error.Error())
+	return false, nil
+}
+
+func (p *fileProcessor) record(name, fileType, treatment, reason string) {
+	log.Debugf("File %q (%s): %s %s", name, fileType, treatment, reason)
+	p.manifest = append(p.manifest, manifestEntry{File: name, Type: fileType, Treatment: treatment, Reason: reason})
+}
+
+func (p *fileProcessor) writeManifest(manifestFile string) error {
+	counts := map[string]int{}
+	for _, entry := range p.manifest {
+		counts[entry.Treatment]++
+	}
+	log.Infof("Files sanitized: %d, copied: %d, skipped: %d. See %q", counts[treatmentSanitized], counts[treatmentCopied],
+		counts[treatmentSkipped], manifestFile)
+
+	content, err := json.MarshalIndent(p.manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Cannot encode the manifest")
+	}
+	return errors.Wrapf(os.WriteFile(manifestFile, append(content, '\n'), 0o644), "Cannot write manifest %q", manifestFile)
+}
+
+// detectType detects archives by their magic number, and binary files by NUL, or many control characters and invalid UTF-8
+func detectType(head []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		return typeGzip, ""
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return typeZip, ""
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return typeTar, ""
+	}
+	for _, c := range unsupportedCompressions {
+		if bytes.HasPrefix(head, c.magic) {
+			return typeBinary, c.name + " compression is not supported"
+		}
+	}
+
+	// control characters and invalid UTF-8 sequences
+	suspicious := 0
+	for i := 0; i < len(head); {
+		r, size := utf8.DecodeRune(head[i:])
+		switch {
+		case r == 0:
+			return typeBinary, "binary content"
+		case r == utf8.RuneError && size == 1 && len(head)-i >= utf8.UTFMax:
+			suspicious++
+		// tabs, new lines, form feeds and escape sequences of colored output are text
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' && r != '\b' && r != 0x1b:
+			suspicious++
+		}
+		i += size
+	}
+	if suspicious*10 > len(head) {
+		return typeBinary, "binary content"
+	}
+	return typeText, ""
+}
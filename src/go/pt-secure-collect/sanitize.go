@@ -4,9 +4,9 @@ import (
 	"os"
 
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/percona/percona-toolkit/src/go/pt-secure-collect/sanitize"
-	"github.com/percona/percona-toolkit/src/go/pt-secure-collect/sanitize/util"
 )
 
 func sanitizeFile(opts *cliOptions) error {
@@ -28,16 +28,75 @@ func sanitizeFile(opts *cliOptions) error {
 		}
 	}
 
-	lines, err := util.ReadLinesFromFile(ifh)
+	s, err := newSanitizer(sanitize.Options{
+		Hostnames: !*opts.DontSanitizeHostnames,
+		IPs:       !*opts.DontSanitizeIPs,
+		Emails:    !*opts.DontSanitizeEmails,
+		Users:     !*opts.DontSanitizeUsers,
+		Schemas:   !*opts.DontSanitizeSchemas,
+		Queries:   !*opts.DontSanitizeQueries,
+		Engine:    *opts.Profile,
+	}, *opts.SanitizeRules, *opts.MappingFile)
 	if err != nil {
-		return errors.Wrapf(err, "Cannot read input file %q", *opts.SanitizeInputFile)
+		return err
+	}
+	if err = s.SanitizeReader(ifh, ofh); err != nil {
+		return errors.Wrapf(err, "Cannot sanitize input file %q", *opts.SanitizeInputFile)
 	}
 
-	sanitized := sanitize.Sanitize(lines, !*opts.DontSanitizeHostnames, !*opts.DontSanitizeQueries)
+	if *opts.MappingFile != "" {
+		return writeMapping(s, *opts.MappingFile)
+	}
+	return nil
+}
 
-	if err = util.WriteLinesToFile(ofh, sanitized); err != nil {
-		return errors.Wrapf(err, "Cannot write output file %q", *opts.SanitizeOutputFile)
+// newSanitizer creates a sanitizer with the rules of rulesFile, if any,
+// restoring pseudonyms of mappingFile if it exists, so that values keep their pseudonyms across runs
+func newSanitizer(opts sanitize.Options, rulesFile, mappingFile string) (*sanitize.Sanitizer, error) {
+	if rulesFile != "" {
+		fh, err := os.Open(rulesFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot open rules file %q", rulesFile)
+		}
+		defer fh.Close()
+		opts.Rules, err = sanitize.LoadRules(fh)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot load rules file %q", rulesFile)
+		}
 	}
 
-	return nil
+	s := sanitize.New(opts)
+	if mappingFile == "" {
+		return s, nil
+	}
+	fh, err := os.Open(mappingFile)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot open mapping file %q", mappingFile)
+	}
+	defer fh.Close()
+	mapping, err := sanitize.ReadMapping(fh)
+	if err == nil {
+		err = s.LoadMapping(mapping)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot load mapping file %q", mappingFile)
+	}
+	return s, nil
+}
+
+// writeMapping writes pseudonyms and their original values. The file must not be shared: it reverts the sanitization
+func writeMapping(s *sanitize.Sanitizer, mappingFile string) error {
+	log.Infof("Writing pseudonyms and their original values to %q, keep this file private", mappingFile)
+	fh, err := os.OpenFile(mappingFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot create mapping file %q", mappingFile)
+	}
+	defer fh.Close()
+	if err := s.WriteMapping(fh); err != nil {
+		return errors.Wrapf(err, "Cannot write mapping file %q", mappingFile)
+	}
+	return fh.Close()
 }
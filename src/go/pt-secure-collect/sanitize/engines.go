@@ -0,0 +1,333 @@
+package sanitize
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Engines whose data can be sanitized, they differ by their query syntax and system accounts
+const (
+	MySQL      = "mysql"
+	MongoDB    = "mongodb"
+	PostgreSQL = "postgresql"
+)
+
+// Engines lists the supported engines, MySQL is the default
+var Engines = []string{MySQL, MongoDB, PostgreSQL}
+
+type engine struct {
+	// sql engines have queries spanning several lines joined, and identifiers in queries replaced
+	sql bool
+	// fingerprint replaces literals of a SQL query
+	fingerprint   func(query string) string
+	identifierRE  *regexp.Regexp
+	quote         string
+	systemUsers   map[string]bool
+	systemSchemas map[string]bool
+}
+
+var (
+	engines = map[string]*engine{
+		MySQL: {
+			sql:           true,
+			fingerprint:   queryToFingerprint,
+			identifierRE:  identifierRE,
+			quote:         "`",
+			systemUsers:   systemUsers,
+			systemSchemas: systemSchemas,
+		},
+		PostgreSQL: {
+			sql:          true,
+			fingerprint:  pgFingerprint,
+			identifierRE: regexp.MustCompile(`(?i)(\b(?:FROM|JOIN|INTO|UPDATE|TABLE|DATABASE|SCHEMA)\s+)("[^"]+"|[\w$]+)(?:\.("[^"]+"|[\w$]+))?`),
+			quote:        `"`,
+			systemUsers:  map[string]bool{"postgres": true, "pg_monitor": true, "pg_read_all_stats": true},
+			systemSchemas: map[string]bool{"postgres": true, "template0": true, "template1": true, "public": true,
+				"pg_catalog": true, "pg_toast": true, "information_schema": true, "null": true},
+		},
+		MongoDB: {
+			systemUsers:   map[string]bool{"__system": true},
+			systemSchemas: map[string]bool{"admin": true, "local": true, "config": true},
+		},
+	}
+
+	// MongoDB queries, such as # Query {...} of pt-mongodb-query-digest, or "command": {...} of logs and currentOp
+	mongoQueryRE = regexp.MustCompile(`(?:#\s*Query\s+|"(?:command|filter|query|originatingCommand)"\s*:\s*)\{`)
+	// MongoDB documents keys, the values of which are kept in fingerprints: they are collections, pseudonymized apart
+	mongoCollectionKeys = map[string]bool{"find": true, "insert": true, "update": true, "delete": true, "aggregate": true,
+		"count": true, "distinct": true, "findAndModify": true, "findandmodify": true, "mapReduce": true, "collection": true,
+		"create": true, "drop": true, "createIndexes": true, "listIndexes": true, "$db": true}
+	mongoUserRE       = regexp.MustCompile(`((?:"|\b)(?:user|username)"?\s*:\s*")([^"]+)(")`)
+	mongoSchemaRE     = regexp.MustCompile(`("(?:db|\$db|database)"\s*:\s*")([^"]+)(")`)
+	mongoCollectionRE = regexp.MustCompile(`("(?:find|insert|update|delete|aggregate|count|distinct|findAndModify|findandmodify|mapReduce|collection|create|drop|createIndexes|listIndexes)"\s*:\s*")([^"]+)(")`)
+	// namespaces, database.collection
+	mongoNamespaceRE = regexp.MustCompile(`("ns"\s*:\s*"|#\s*Namespace\s+)([\w\-]+)\.([^"\s]+)`)
+	pgInListRE       = regexp.MustCompile(`(?i)\bin\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	// columns of pg_stat_* views, in the expanded output of psql, such as usename | app
+	pgUserColumnRE   = regexp.MustCompile(`^(\s*(?:usename|rolname)\s*\|\s*)(\S+)`)
+	pgSchemaColumnRE = regexp.MustCompile(`^(\s*(?:datname|schemaname)\s*\|\s*)(\S+)`)
+	pgTableColumnRE  = regexp.MustCompile(`^(\s*relname\s*\|\s*)(\S+)`)
+)
+
+func (s *Sanitizer) sanitizeMongoQueries(line string) string {
+	var b strings.Builder
+	for {
+		loc := mongoQueryRE.FindStringIndex(line)
+		if loc == nil {
+			break
+		}
+		b.WriteString(line[:loc[1]-1])
+		query, n := fingerprintDocument(line[loc[1]-1:])
+		b.WriteString(query)
+		line = line[loc[1]-1+n:]
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+func (s *Sanitizer) sanitizeMongoUsers(line string) string {
+	return replaceGroups(mongoUserRE, line, func(m []string) string {
+		return m[1] + s.user(m[2]) + m[3]
+	})
+}
+
+func (s *Sanitizer) sanitizeMongoSchemas(line string) string {
+	line = replaceGroups(mongoNamespaceRE, line, func(m []string) string {
+		return m[1] + s.schema(m[2]) + "." + s.collection(m[3])
+	})
+	line = replaceGroups(mongoSchemaRE, line, func(m []string) string {
+		return m[1] + s.schema(m[2]) + m[3]
+	})
+	return replaceGroups(mongoCollectionRE, line, func(m []string) string {
+		return m[1] + s.collection(m[2]) + m[3]
+	})
+}
+
+func (s *Sanitizer) sanitizePGColumns(line string, users bool) string {
+	if users {
+		return replaceGroups(pgUserColumnRE, line, func(m []string) string {
+			return m[1] + s.user(m[2])
+		})
+	}
+	line = replaceGroups(pgSchemaColumnRE, line, func(m []string) string {
+		return m[1] + s.schema(m[2])
+	})
+	return replaceGroups(pgTableColumnRE, line, func(m []string) string {
+		return m[1] + s.table(m[2])
+	})
+}
+
+// collection keeps system collections and commands, such as system.profile or $cmd
+func (s *Sanitizer) collection(name string) string {
+	if strings.HasPrefix(name, "system.") || strings.HasPrefix(name, "$") {
+		return name
+	}
+	return s.pseudonym("collection", name)
+}
+
+// fingerprintDocument replaces values of the JSON, or mongo shell, document at the start of doc,
+// and returns it with its length. Values of keys naming collections are kept
+func fingerprintDocument(doc string) (string, int) {
+	var b strings.Builder
+	// keys of the documents and arrays being read
+	keys := []string{}
+	key := ""
+	for i := 0; i < len(doc); {
+		c := doc[i]
+		switch {
+		case c == '{' || c == '[':
+			keys = append(keys, key)
+			b.WriteByte(c)
+			i++
+		case c == '}' || c == ']':
+			b.WriteByte(c)
+			i++
+			if len(keys) == 0 {
+				return b.String(), i
+			}
+			key, keys = keys[len(keys)-1], keys[:len(keys)-1]
+			if len(keys) == 0 {
+				return b.String(), i
+			}
+		case c == '"' || c == '\'':
+			end := stringEnd(doc, i, true)
+			if isKey(doc[end:]) {
+				key = strings.Trim(doc[i:end], `"'`)
+				b.WriteString(doc[i:end])
+			} else if mongoCollectionKeys[key] {
+				b.WriteString(doc[i:end])
+			} else {
+				b.WriteString(`"?"`)
+			}
+			i = end
+		case isIdentByte(c) || c == '-' || c == '.':
+			end := i
+			for end < len(doc) && (isIdentByte(doc[end]) || doc[end] == '-' || doc[end] == '.') {
+				end++
+			}
+			word := doc[i:end]
+			switch {
+			case isKey(doc[end:]):
+				key = word
+				b.WriteString(word)
+			case end < len(doc) && doc[end] == '(':
+				// constructors of the mongo shell, such as ObjectId("...") or NumberLong(1)
+				end = parenthesesEnd(doc, end)
+				b.WriteString("?")
+			default:
+				b.WriteString("?")
+			}
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), len(doc)
+}
+
+// isKey returns whether rest, following a word or a string, starts with a colon
+func isKey(rest string) bool {
+	return strings.HasPrefix(strings.TrimLeft(rest, " \t"), ":")
+}
+
+// stringEnd returns the index following the string starting at start, backslashes escape quotes when escapes is set
+func stringEnd(s string, start int, escapes bool) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && escapes:
+			i++
+		case s[i] == quote:
+			if !escapes && i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func parenthesesEnd(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			i = stringEnd(s, i, true) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// pgFingerprint replaces literals of a PostgreSQL query by ?, and lowercases its keywords and unquoted identifiers,
+// as PostgreSQL does. Strings can be E'...' or dollar quoted, and quoted identifiers are kept to be pseudonymized
+func pgFingerprint(query string) string {
+	var b strings.Builder
+	space := false
+	write := func(token string) {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(token)
+	}
+	for i := 0; i < len(query); {
+		c := query[i]
+		prevIdent := i > 0 && isIdentByte(query[i-1])
+		switch {
+		case strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+			space = true
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+			space = true
+		case unicode.IsSpace(rune(c)):
+			space = true
+			i++
+		case c == '\'':
+			i = stringEnd(query, i, false)
+			write("?")
+		case (c == 'E' || c == 'e') && !prevIdent && strings.HasPrefix(query[i+1:], "'"):
+			i = stringEnd(query, i+1, true)
+			write("?")
+		case c == '$' && !prevIdent:
+			if tag := dollarTag(query[i:]); tag != "" {
+				if end := strings.Index(query[i+len(tag):], tag); end >= 0 {
+					i += 2*len(tag) + end
+				} else {
+					i = len(query)
+				}
+				write("?")
+				continue
+			}
+			// parameters, such as $1
+			end := i + 1
+			for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+				end++
+			}
+			if end == i+1 {
+				write("$")
+			} else {
+				write("?")
+			}
+			i = end
+		case c == '"':
+			end := stringEnd(query, i, false)
+			write(query[i:end])
+			i = end
+		case c >= '0' && c <= '9' && !prevIdent:
+			end := i
+			for end < len(query) && (query[end] >= '0' && query[end] <= '9' || query[end] == '.' ||
+				query[end] == 'e' || query[end] == 'E') {
+				end++
+			}
+			write("?")
+			i = end
+		case isIdentByte(c):
+			end := i
+			for end < len(query) && isIdentByte(query[end]) {
+				end++
+			}
+			write(strings.ToLower(query[i:end]))
+			i = end
+		default:
+			write(string(c))
+			i++
+		}
+	}
+	return pgInListRE.ReplaceAllString(b.String(), "in(?+)")
+}
+
+// dollarTag returns the tag starting a dollar quoted string, such as $$ or $body$
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '$':
+			return s[:i+1]
+		case i == 1 && s[i] >= '0' && s[i] <= '9', !isIdentByte(s[i]):
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package sanitize
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	kindRE      = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	pseudonymRE = regexp.MustCompile(`^([a-z][a-z0-9_]*)-([0-9]+)$`)
+)
+
+// Rule is a user-supplied regular expression, its matches are replaced by pseudonyms of Kind, or redacted
+// When the expression has groups, only the first group is replaced
+type Rule struct {
+	Kind   string
+	Redact bool
+	re     *regexp.Regexp
+}
+
+// LoadRules reads a rules file. Each line is a rule, empty lines and lines starting with # are ignored:
+//
+//	pseudonymize <kind> <regular expression>
+//	redact <regular expression>
+//
+// kind names pseudonyms, such as customer for customer-1. Using a built-in kind, such as host, extends it
+func LoadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		action, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+
+		var rule Rule
+		switch action {
+		case "pseudonymize":
+			rule.Kind, rest, _ = strings.Cut(rest, " ")
+			rest = strings.TrimSpace(rest)
+			if !kindRE.MatchString(rule.Kind) {
+				return nil, errors.Errorf("line %d: invalid kind %q, use lower case letters, digits and _", n, rule.Kind)
+			}
+		case "redact":
+			rule.Redact = true
+		default:
+			return nil, errors.Errorf("line %d: unknown action %q, use pseudonymize or redact", n, action)
+		}
+		if rest == "" {
+			return nil, errors.Errorf("line %d: missing regular expression", n)
+		}
+		re, err := regexp.Compile(rest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Cannot read rules")
+	}
+	return rules, nil
+}
+
+func (r Rule) apply(s *Sanitizer, line string) string {
+	return r.re.ReplaceAllStringFunc(line, func(match string) string {
+		value, prefix, suffix := match, "", ""
+		if r.re.NumSubexp() > 0 {
+			loc := r.re.FindStringSubmatchIndex(match)
+			if loc[2] < 0 {
+				return match
+			}
+			value, prefix, suffix = match[loc[2]:loc[3]], match[:loc[2]], match[loc[3]:]
+		}
+		if r.Redact {
+			return prefix + Redacted + suffix
+		}
+		return prefix + s.pseudonym(r.Kind, value) + suffix
+	})
+}
+
+// Mapping returns original values by pseudonym, to de-anonymize findings
+func (s *Sanitizer) Mapping() map[string]string {
+	mapping := make(map[string]string, len(s.originals))
+	for p, value := range s.originals {
+		mapping[p] = value
+	}
+	return mapping
+}
+
+// LoadMapping restores pseudonyms of a previous run, so that values keep them, and new values get new ones
+func (s *Sanitizer) LoadMapping(mapping map[string]string) error {
+	for p, value := range mapping {
+		m := pseudonymRE.FindStringSubmatch(p)
+		if m == nil {
+			return errors.Errorf("Invalid pseudonym %q", p)
+		}
+		kind := m[1]
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return errors.Wrapf(err, "Invalid pseudonym %q", p)
+		}
+		if s.pseudonyms[kind] == nil {
+			s.pseudonyms[kind] = map[string]string{}
+		}
+		s.pseudonyms[kind][pseudonymKey(kind, value)] = p
+		s.originals[p] = value
+		if n > s.counters[kind] {
+			s.counters[kind] = n
+		}
+	}
+	return nil
+}
+
+// WriteMapping writes the mapping as JSON, by kind and number of pseudonyms
+func (s *Sanitizer) WriteMapping(w io.Writer) error {
+	pseudonyms := make([]string, 0, len(s.originals))
+	for p := range s.originals {
+		pseudonyms = append(pseudonyms, p)
+	}
+	sort.Slice(pseudonyms, func(i, j int) bool {
+		a, b := pseudonymRE.FindStringSubmatch(pseudonyms[i]), pseudonymRE.FindStringSubmatch(pseudonyms[j])
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		na, _ := strconv.Atoi(a[2])
+		nb, _ := strconv.Atoi(b[2])
+		return na < nb
+	})
+
+	// encoding/json sorts map keys as strings, host-10 would come before host-2
+	var b strings.Builder
+	b.WriteString("{")
+	for i, p := range pseudonyms {
+		key, _ := json.Marshal(p)
+		value, _ := json.Marshal(s.originals[p])
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  " + string(key) + ": " + string(value))
+	}
+	if len(pseudonyms) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return errors.Wrap(err, "Cannot write the mapping")
+}
+
+// ReadMapping reads a mapping written by WriteMapping
+func ReadMapping(r io.Reader) (map[string]string, error) {
+	mapping := map[string]string{}
+	if err := json.NewDecoder(r).Decode(&mapping); err != nil {
+		return nil, errors.Wrap(err, "Cannot read the mapping")
+	}
+	return mapping, nil
+}
@@ -1,16 +1,45 @@
 package sanitize
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"regexp"
 	"strings"
 
 	"github.com/percona/go-mysql/query"
 )
 
+// Redacted replaces credentials, they are never pseudonymized
+const Redacted = "********"
+
 var (
-	hostnameRE    = regexp.MustCompile(`(([a-zA-Z0-9]|[a-zA-Z0-9\-]*[a-zA-Z0-9])\.)+([A-Za-z]+)|([0-9]{1,3}\.){3}[0-9]{1,3}`)
+	hostnameRE    = regexp.MustCompile(`(([a-zA-Z0-9]|[a-zA-Z0-9\-]*[a-zA-Z0-9])\.)+([A-Za-z]+)`)
+	ipRE          = regexp.MustCompile(`\b([0-9]{1,3}\.){3}[0-9]{1,3}\b`)
+	emailRE       = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9\-]+\.)+[A-Za-z]{2,}`)
 	queryLineRe   []*regexp.Regexp
 	queryInLineRe []*regexp.Regexp
+
+	// credentials, such as password = secret in my.cnf, --password=secret or IDENTIFIED BY 'secret'
+	credentialRE = regexp.MustCompile(`(?i)(\b(?:password|passwd|pwd|secret|token|access[_-]?key)\s*[=:]\s*)('[^']*'|"[^"]*"|\S+)`)
+	identifiedRE = regexp.MustCompile(`(?i)(\bIDENTIFIED\s+(?:WITH\s+\S+\s+)?(?:BY|AS)\s+)('[^']*'|"[^"]*")`)
+	uriRE        = regexp.MustCompile(`(://[^:/@\s]+:)([^@\s]+)(@)`)
+	// credentials of JSON documents, such as "pwd": "secret", of PostgreSQL roles, such as PASSWORD 'secret', and password hashes
+	jsonCredentialRE = regexp.MustCompile(`(?i)("(?:pwd|password|passwd|secret|token)"\s*:\s*)("(?:[^"\\]|\\.)*")`)
+	rolePasswordRE   = regexp.MustCompile(`(?i)(\bPASSWORD\s+)('[^']*')`)
+	passwordHashRE   = regexp.MustCompile(`\bmd5[0-9a-f]{32}\b|\bSCRAM-SHA-256\$[^\s|]+`)
+
+	// accounts, such as 'app'@'10.0.0.5', User@Host: app[app] @ host, or user = app
+	accountRE     = regexp.MustCompile(`'([^'@]*)'@'([^']*)'`)
+	userHostRE    = regexp.MustCompile(`(User@Host:\s*)([^\[\s]+)\[([^\]]*)\]`)
+	userKeyRE     = regexp.MustCompile(`(?i)(\b(?:user|username)\s*[=:]\s*)([\w.$\-]+)`)
+	schemaKeyRE   = regexp.MustCompile(`(?i)(\b(?:db|dbname|database|schema)\s*[=:]\s*)([\w$]+)`)
+	identifierRE  = regexp.MustCompile("(?i)(\\b(?:FROM|JOIN|INTO|UPDATE|TABLE|DATABASE|SCHEMA|USE)\\s+)(`[^`]+`|[\\w$]+)(?:\\.(`[^`]+`|[\\w$]+))?")
+	systemUsers   = map[string]bool{"root": true, "mysql.sys": true, "mysql.session": true, "mysql.infoschema": true, "event_scheduler": true, "system": true, "unauthenticated": true}
+	systemHosts   = map[string]bool{"%": true, "localhost": true, "127.0.0.1": true, "::1": true}
+	systemSchemas = map[string]bool{"mysql": true, "information_schema": true, "performance_schema": true, "sys": true, "null": true}
+	// words following FROM and other keywords which are not identifiers
+	sqlKeywords = map[string]bool{"select": true, "dual": true, "if": true, "not": true, "exists": true, "temporary": true, "ignore": true, "low_priority": true, "set": true}
 )
 
 func init() {
@@ -33,72 +62,365 @@ func init() {
 	}
 }
 
-func Sanitize(lines []string, hostnames, queries bool) []string {
-	joined := joinQueryLines(lines)
-	if queries {
-		sanitizeQueries(joined)
+// Options selects what is sanitized. Credentials are always redacted
+type Options struct {
+	Hostnames bool
+	IPs       bool
+	Emails    bool
+	Users     bool
+	Schemas   bool
+	Queries   bool
+	// Engine selects the query syntax and the system accounts, MySQL by default
+	Engine string
+	// Rules are user-supplied, applied before the built-in ones
+	Rules []Rule
+}
+
+// Sanitizer replaces sensitive values by pseudonyms, such as host-3, the same value always getting the same pseudonym
+// so that files sanitized by the same Sanitizer can still be correlated. It is not safe for concurrent use
+type Sanitizer struct {
+	opts   Options
+	engine *engine
+	// pseudonyms by kind, then by pseudonymKey
+	pseudonyms map[string]map[string]string
+	// originals are values by pseudonym, to de-anonymize findings
+	originals map[string]string
+	counters  map[string]int
+}
+
+func New(opts Options) *Sanitizer {
+	e, ok := engines[opts.Engine]
+	if !ok {
+		e = engines[MySQL]
 	}
-	if hostnames {
-		sanitizeHostnames(joined)
+	return &Sanitizer{
+		opts:       opts,
+		engine:     e,
+		pseudonyms: map[string]map[string]string{},
+		originals:  map[string]string{},
+		counters:   map[string]int{},
 	}
-	return joined
 }
 
-func sanitizeHostnames(lines []string) {
-	for i := range lines {
-		lines[i] = hostnameRE.ReplaceAllStringFunc(lines[i], replaceHostname)
+// Sanitize returns lines with queries replaced by their fingerprints, credentials redacted,
+// and sensitive values replaced by pseudonyms. SQL queries spanning several lines are joined
+func (s *Sanitizer) Sanitize(lines []string) []string {
+	sanitized := make([]string, 0, len(lines))
+	j := &queryJoiner{}
+	for _, line := range lines {
+		for _, text := range s.join(j, line) {
+			sanitized = append(sanitized, s.sanitizeText(text))
+		}
 	}
+	for _, text := range j.flush() {
+		sanitized = append(sanitized, s.sanitizeText(text))
+	}
+	return sanitized
 }
 
-func sanitizeQueries(lines []string) {
-	for i := range lines {
-		for _, re := range queryInLineRe {
-			lines[i] = re.ReplaceAllStringFunc(lines[i], queryToFingerprint)
+// SanitizeReader sanitizes r into w as Sanitize does, line by line, so that large files are not loaded in memory.
+// A missing newline at the end of r is kept
+func (s *Sanitizer) SanitizeReader(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	first, newline := true, false
+	write := func(texts []string) {
+		for _, text := range texts {
+			if !first {
+				bw.WriteByte('\n')
+			}
+			first = false
+			bw.WriteString(s.sanitizeText(text))
 		}
 	}
+
+	j := &queryJoiner{}
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			newline = strings.HasSuffix(line, "\n")
+			write(s.join(j, strings.TrimSuffix(line, "\n")))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	write(j.flush())
+	if newline {
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
 }
 
-func joinQueryLines(lines []string) []string {
-	inQuery := false
-	joined := []string{}
-	queryString := ""
+// join returns the texts to sanitize once line is read: none while a SQL query is incomplete
+func (s *Sanitizer) join(j *queryJoiner, line string) []string {
+	if !s.engine.sql {
+		return []string{line}
+	}
+	return j.add(line)
+}
 
-	separator := ""
+// sanitizeText sanitizes a line, or the lines of a joined query
+func (s *Sanitizer) sanitizeText(text string) string {
+	if s.opts.Queries {
+		if s.engine.sql {
+			for _, re := range queryInLineRe {
+				text = re.ReplaceAllStringFunc(text, s.engine.fingerprint)
+			}
+		} else {
+			text = s.sanitizeMongoQueries(text)
+		}
+	}
+	return s.sanitizeLine(text)
+}
 
-	for _, line := range lines {
-		if !inQuery && mightBeAQueryLine(line) {
-			inQuery = true
+// sanitizeLine applies rules from the most to the least specific: emails contain host names,
+// and schema qualified names look like host names
+func (s *Sanitizer) sanitizeLine(line string) string {
+	line = redactCredentials(line)
+	for _, rule := range s.opts.Rules {
+		line = rule.apply(s, line)
+	}
+	if s.opts.Emails {
+		line = emailRE.ReplaceAllStringFunc(line, func(email string) string {
+			return s.pseudonym("email", email)
+		})
+	}
+	if s.opts.Users {
+		line = s.sanitizeUsers(line)
+	}
+	if s.opts.Schemas {
+		line = s.sanitizeSchemas(line)
+	}
+	if s.opts.IPs {
+		line = ipRE.ReplaceAllStringFunc(line, s.ip)
+	}
+	if s.opts.Hostnames {
+		line = s.sanitizeHostnames(line)
+	}
+	return line
+}
+
+// pseudonym returns the pseudonym of value, it is created on first use
+func (s *Sanitizer) pseudonym(kind, value string) string {
+	key := pseudonymKey(kind, value)
+	if s.pseudonyms[kind] == nil {
+		s.pseudonyms[kind] = map[string]string{}
+	}
+	if p, ok := s.pseudonyms[kind][key]; ok {
+		return p
+	}
+	s.counters[kind]++
+	p := fmt.Sprintf("%s-%d", kind, s.counters[kind])
+	s.pseudonyms[kind][key] = p
+	s.originals[p] = value
+	return p
+}
+
+// pseudonymKey identifies a value within its kind, host names and emails are not case-sensitive
+func pseudonymKey(kind, value string) string {
+	if kind == "host" || kind == "email" {
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+func (s *Sanitizer) hostname(host string) string {
+	return s.pseudonym("host", host)
+}
+
+// sanitizeHostnames keeps names made of pseudonyms, such as the db-1.collection-1 namespace, which look like host names
+func (s *Sanitizer) sanitizeHostnames(line string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range hostnameRE.FindAllStringIndex(line, -1) {
+		end := loc[1]
+		for end < len(line) && (isIdentByte(line[end]) || line[end] == '-') {
+			end++
 		}
-		if inQuery {
-			if strings.HasPrefix(line, "***") {
-				joined = append(joined, queryString)
-				queryString = ""
-				joined = append(joined, line)
-				inQuery = false
-				separator = ""
-				continue
-			}
-			queryString += separator + line
-			separator = "\n"
-			if !strings.HasSuffix(strings.TrimSpace(line), ";") {
-				continue
+		b.WriteString(line[last:loc[0]])
+		if s.isPseudonyms(line[loc[0]:end]) {
+			b.WriteString(line[loc[0]:loc[1]])
+		} else {
+			b.WriteString(s.hostname(line[loc[0]:loc[1]]))
+		}
+		last = loc[1]
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+func (s *Sanitizer) isPseudonyms(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if _, ok := s.originals[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Sanitizer) ip(ip string) string {
+	if systemHosts[ip] {
+		return ip
+	}
+	return s.pseudonym("ip", ip)
+}
+
+func (s *Sanitizer) user(user string) string {
+	if user == "" || s.engine.systemUsers[strings.ToLower(user)] {
+		return user
+	}
+	return s.pseudonym("user", user)
+}
+
+func (s *Sanitizer) sanitizeUsers(line string) string {
+	line = accountRE.ReplaceAllStringFunc(line, func(account string) string {
+		m := accountRE.FindStringSubmatch(account)
+		user, host := s.user(m[1]), m[2]
+		if !systemHosts[host] {
+			host = s.host(host)
+		}
+		return "'" + user + "'@'" + host + "'"
+	})
+	line = replaceGroups(userHostRE, line, func(m []string) string {
+		return m[1] + s.user(m[2]) + "[" + s.user(m[3]) + "]"
+	})
+	line = replaceGroups(userKeyRE, line, func(m []string) string {
+		return m[1] + s.user(m[2])
+	})
+	switch s.engine {
+	case engines[MongoDB]:
+		line = s.sanitizeMongoUsers(line)
+	case engines[PostgreSQL]:
+		line = s.sanitizePGColumns(line, true)
+	}
+	return line
+}
+
+// host returns the pseudonym of an IP address or a host name, unless they are not sanitized
+func (s *Sanitizer) host(host string) string {
+	switch {
+	case ipRE.MatchString(host) && s.opts.IPs:
+		return s.ip(host)
+	case !ipRE.MatchString(host) && s.opts.Hostnames:
+		return s.hostname(host)
+	}
+	return host
+}
+
+func (s *Sanitizer) schema(name string) string {
+	if s.engine.systemSchemas[strings.ToLower(name)] {
+		return name
+	}
+	return s.pseudonym("db", name)
+}
+
+func (s *Sanitizer) sanitizeSchemas(line string) string {
+	line = replaceGroups(schemaKeyRE, line, func(m []string) string {
+		return m[1] + s.schema(m[2])
+	})
+	switch s.engine {
+	case engines[MongoDB]:
+		return s.sanitizeMongoSchemas(line)
+	case engines[PostgreSQL]:
+		line = s.sanitizePGColumns(line, false)
+	}
+	// identifiers are only looked for in queries
+	for _, re := range queryInLineRe {
+		line = re.ReplaceAllStringFunc(line, s.sanitizeIdentifiers)
+	}
+	return line
+}
+
+func (s *Sanitizer) sanitizeIdentifiers(query string) string {
+	return replaceGroups(s.engine.identifierRE, query, func(m []string) string {
+		first, quoted := s.unquote(m[2])
+		if sqlKeywords[strings.ToLower(first)] {
+			return m[0]
+		}
+		if m[3] == "" {
+			// a table, or a schema after DATABASE, SCHEMA and USE
+			keyword := strings.ToUpper(strings.TrimSpace(m[1]))
+			if keyword == "DATABASE" || keyword == "SCHEMA" || keyword == "USE" {
+				return m[1] + s.quote(s.schema(first), quoted)
 			}
-			inQuery = false
-			separator = ""
-			joined = append(joined, queryString)
-			queryString = ""
-			continue
+			return m[1] + s.quote(s.table(first), quoted)
 		}
-		joined = append(joined, line)
+		table, _ := s.unquote(m[3])
+		// qualified names are quoted, so that they can not be mistaken for host names
+		return m[1] + s.quote(s.schema(first), true) + "." + s.quote(s.table(table), true)
+	})
+}
+
+func (s *Sanitizer) table(name string) string {
+	return s.pseudonym("table", name)
+}
+
+func (s *Sanitizer) unquote(identifier string) (string, bool) {
+	if strings.HasPrefix(identifier, s.engine.quote) {
+		return strings.Trim(identifier, s.engine.quote), true
+	}
+	return identifier, false
+}
+
+func (s *Sanitizer) quote(identifier string, quoted bool) string {
+	if quoted {
+		return s.engine.quote + identifier + s.engine.quote
+	}
+	return identifier
+}
+
+// replaceGroups replaces every match of re, using its submatches
+func replaceGroups(re *regexp.Regexp, line string, replace func(m []string) string) string {
+	return re.ReplaceAllStringFunc(line, func(match string) string {
+		return replace(re.FindStringSubmatch(match))
+	})
+}
+
+func redactCredentials(line string) string {
+	line = credentialRE.ReplaceAllString(line, "${1}"+Redacted)
+	line = identifiedRE.ReplaceAllString(line, "${1}'"+Redacted+"'")
+	line = rolePasswordRE.ReplaceAllString(line, "${1}'"+Redacted+"'")
+	line = jsonCredentialRE.ReplaceAllString(line, "${1}\""+Redacted+"\"")
+	line = passwordHashRE.ReplaceAllString(line, Redacted)
+	return uriRE.ReplaceAllString(line, "${1}"+Redacted+"${3}")
+}
+
+// queryJoiner joins the lines of queries, which end with ; or a *** separator of the vertical output.
+// Queries longer than maxQuerySize are not joined further, so that a missing ; does not keep a whole file in memory
+type queryJoiner struct {
+	lines []string
+	size  int
+}
+
+const maxQuerySize = 1 << 20
+
+func (j *queryJoiner) add(line string) []string {
+	if len(j.lines) == 0 && !mightBeAQueryLine(line) {
+		return []string{line}
+	}
+	if strings.HasPrefix(line, "***") {
+		return append(j.flush(), line)
+	}
+	j.lines = append(j.lines, line)
+	j.size += len(line)
+	if strings.HasSuffix(strings.TrimSpace(line), ";") || j.size > maxQuerySize {
+		return j.flush()
 	}
-	return joined
+	return nil
 }
 
-func replaceHostname(s string) string {
-	if strings.HasSuffix(s, ":") {
-		return "<hostname>:"
+// flush returns the query being joined, if any
+func (j *queryJoiner) flush() []string {
+	if len(j.lines) == 0 {
+		return nil
 	}
-	return "hostname"
+	query := strings.Join(j.lines, "\n")
+	j.lines, j.size = nil, 0
+	return []string{query}
 }
 
 func queryToFingerprint(q string) string {